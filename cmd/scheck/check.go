@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+	"github.com/tigrannajaryan/telemetry-schema/schema/validate"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// Rules that problems are reported by.
+const (
+	ruleParse     = "parse"
+	ruleCompile   = "compile"
+	ruleValidate  = "validate"
+	ruleFileName  = "file-name"
+	ruleSchemaURL = "schema-url"
+)
+
+// ruleDescriptions describe the rules in SARIF output.
+var ruleDescriptions = map[string]string{
+	ruleParse:     "The schema file must be valid YAML that matches the schema file format.",
+	ruleCompile:   "The changes of each version must compile to translation actions.",
+	ruleValidate:  "Renames must not collide, be chained within a version or form cycles across versions.",
+	ruleFileName:  "The schema file must be named after a version it defines.",
+	ruleSchemaURL: "schema_url must be set and must end with the version the file is named after.",
+}
+
+var ruleOrder = []string{ruleParse, ruleCompile, ruleValidate, ruleFileName, ruleSchemaURL}
+
+// problem is a problem found in a schema file. Line and Column are 1-based,
+// zero if unknown.
+type problem struct {
+	Severity string                   `json:"severity"`
+	Rule     string                   `json:"rule"`
+	Line     int                      `json:"line,omitempty"`
+	Column   int                      `json:"column,omitempty"`
+	Versions []types.TelemetryVersion `json:"versions,omitempty"`
+	Section  string                   `json:"section,omitempty"`
+	Message  string                   `json:"message"`
+}
+
+// check returns all problems found in the schema file. Returns an error if the
+// file cannot be read.
+func check(inputFile string, strict bool) ([]problem, error) {
+	content, err := ioutil.ReadFile(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	loc := newLocator(content)
+
+	var problems []problem
+	ts, err := schema.ParseBytesWithOptions(inputFile, content, schema.ParseOptions{Strict: strict})
+	if err != nil {
+		problems = append(problems, parseProblems(err)...)
+	}
+	if ts == nil {
+		// Not valid YAML, there is nothing else to check.
+		return problems, nil
+	}
+
+	_, diags := schema.Compile(ts)
+	for _, diag := range diags {
+		p := problem{Severity: severityError, Rule: ruleCompile, Section: diag.Section, Message: diag.Message}
+		if diag.Severity == schema.SeverityWarning {
+			p.Severity = severityWarning
+		}
+		if diag.Version != "" {
+			p.Versions = []types.TelemetryVersion{diag.Version}
+		}
+		p.Line, p.Column = loc.find(diag.Version, diag.Section)
+		problems = append(problems, p)
+	}
+
+	for _, vp := range validate.Validate(ts) {
+		p := problem{
+			Severity: severityError,
+			Rule:     ruleValidate,
+			Versions: vp.Versions,
+			Section:  vp.Section,
+			Message:  vp.Message,
+		}
+		p.Line, p.Column = loc.find(vp.Versions[len(vp.Versions)-1], vp.Section)
+		problems = append(problems, p)
+	}
+
+	return append(problems, checkNaming(inputFile, ts, loc)...), nil
+}
+
+func parseProblems(err error) []problem {
+	var parseErrs schema.ParseErrors
+	if !errors.As(err, &parseErrs) {
+		return []problem{{Severity: severityError, Rule: ruleParse, Message: err.Error()}}
+	}
+	problems := make([]problem, len(parseErrs))
+	for i, parseErr := range parseErrs {
+		problems[i] = problem{
+			Severity: severityError,
+			Rule:     ruleParse,
+			Line:     parseErr.Line,
+			Column:   parseErr.Column,
+			Message:  parseErr.Msg,
+		}
+	}
+	return problems
+}
+
+// checkNaming checks that the file is named after a version that it defines and
+// that schema_url points to that version.
+func checkNaming(inputFile string, ts *ast.Schema, loc locator) []problem {
+	var problems []problem
+	report := func(rule string, line, column int, format string, args ...interface{}) {
+		problems = append(
+			problems, problem{
+				Severity: severityError,
+				Rule:     rule,
+				Line:     line,
+				Column:   column,
+				Message:  fmt.Sprintf(format, args...),
+			},
+		)
+	}
+
+	schemaVerInFileName := path.Base(inputFile)
+	if _, ok := ts.Versions[types.TelemetryVersion(schemaVerInFileName)]; !ok {
+		line, column := loc.find("", "")
+		report(
+			ruleFileName, line, column, "schema version %s according to file name is not found in the file",
+			schemaVerInFileName,
+		)
+	}
+
+	line, column := loc.key("schema_url")
+	if ts.SchemaURL == "" {
+		report(ruleSchemaURL, 0, 0, "schema_url is missing")
+		return problems
+	}
+
+	surl, err := url.Parse(ts.SchemaURL)
+	if err != nil {
+		report(ruleSchemaURL, line, column, "schema_url cannot be parsed: %v", err)
+		return problems
+	}
+
+	paths := strings.Split(surl.Path, "/")
+	schemaVerInPath := paths[len(paths)-1]
+	if schemaVerInPath == "" {
+		report(ruleSchemaURL, line, column, "schema_url path should not be empty")
+	} else if schemaVerInPath != schemaVerInFileName {
+		report(
+			ruleSchemaURL, line, column, "the last part of schema_url path is %s but expected %s",
+			schemaVerInPath, schemaVerInFileName,
+		)
+	}
+	return problems
+}
+
+// locator finds the positions of the entries of a schema file.
+type locator struct {
+	doc *yaml.Node
+}
+
+func newLocator(content []byte) locator {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil || len(root.Content) == 0 {
+		return locator{}
+	}
+	return locator{doc: root.Content[0]}
+}
+
+// key returns the position of the top level key or zeros if there is no such key.
+func (l locator) key(key string) (line, column int) {
+	if keyNode, _ := mappingEntry(l.doc, key); keyNode != nil {
+		return keyNode.Line, keyNode.Column
+	}
+	return 0, 0
+}
+
+// find returns the position of the section of the version. Returns the
+// position of the version if the section is empty or is not found, and the
+// position of "versions" if the version is empty or is not found.
+func (l locator) find(version types.TelemetryVersion, section string) (line, column int) {
+	found, versions := mappingEntry(l.doc, "versions")
+	if found == nil {
+		return 0, 0
+	}
+	if versionKey, def := mappingEntry(versions, string(version)); version != "" && versionKey != nil {
+		found = versionKey
+		if sectionKey, _ := mappingEntry(def, section); section != "" && sectionKey != nil {
+			found = sectionKey
+		}
+	}
+	return found.Line, found.Column
+}
+
+// mappingEntry returns the key and the value nodes of the key in the mapping
+// node or nils if there is no such key.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAfterParseErrors(t *testing.T) {
+	// The unknown action is a parse error, and the compiler warns about the
+	// entry without an action. The other checks still run.
+	file := writeFile(
+		t, t.TempDir(), "1.1.0", `file_format: 1.1.0
+schema_url: https://example.com/schemas/1.0.0
+versions:
+  1.1.0:
+    resources:
+      changes:
+        - rename_attributes:
+            a: c
+            b: c
+        - rename_atributes:
+            d: e
+  1.0.0:
+`,
+	)
+
+	problems, err := check(file, false)
+	require.NoError(t, err)
+	rules := map[string]bool{}
+	for _, p := range problems {
+		rules[p.Rule] = true
+	}
+	assert.Equal(
+		t, map[string]bool{ruleParse: true, ruleCompile: true, ruleValidate: true, ruleSchemaURL: true},
+		rules, problems,
+	)
+}
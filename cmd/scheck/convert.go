@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+	"github.com/tigrannajaryan/telemetry-schema/schema/converter"
+	"github.com/tigrannajaryan/telemetry-schema/schema/otlp"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// Payload formats.
+const (
+	formatAuto  = "auto"
+	formatProto = "proto"
+	formatJSON  = "json"
+)
+
+// convertCommand converts an OTLP export request file using a schema. Returns
+// the exit code.
+func convertCommand(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(
+			flags.Output(), "Usage: scheck convert -schema file [flags] input-file\n\n"+
+				"Converts the OTLP trace, metric or log export request in the input file using the\n"+
+				"schema and writes the converted request. A summary of the changes is printed to\n"+
+				"standard error. Exits with 1 if the input cannot be converted and with 4 if the schema\n"+
+				"cannot be parsed.\n\n",
+		)
+		flags.PrintDefaults()
+	}
+	schemaFile := flags.String("schema", "", "schema file to convert with")
+	from := flags.String("from", "", "version of the input data, taken from its schema URLs if empty")
+	to := flags.String("to", "", "version to convert to, the latest version of the schema if empty")
+	signal := flags.String("signal", "", "traces, metrics or logs, detected from OTLP/JSON input if empty")
+	inFormat := flags.String("format", formatAuto, "input format: auto, proto or json")
+	outFormat := flags.String("out-format", "", "output format: proto or json, same as input if empty")
+	output := flags.String("o", "", "output file, standard output if empty")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *schemaFile == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	content, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if *inFormat == formatAuto {
+		*inFormat = detectFormat(content)
+	}
+	if *outFormat == "" {
+		*outFormat = *inFormat
+	}
+
+	var request otlp.ExportRequest
+	if *signal == "" && *inFormat == formatJSON {
+		request, err = otlp.UnmarshalJSONRequest(content)
+	} else {
+		if request, err = newRequest(*signal); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		err = unmarshalRequest(content, *inFormat, request)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(0), err)
+		return exitErrors
+	}
+
+	cs, err := compileSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		var parseErrs schema.ParseErrors
+		var pathErr *os.PathError
+		switch {
+		case errors.As(err, &parseErrs):
+			return exitParseErrors
+		case errors.As(err, &pathErr):
+			return exitUsage
+		}
+		return exitErrors
+	}
+
+	before := proto.Clone(request)
+	opts := converter.Options{
+		SourceVersion: types.TelemetryVersion(*from),
+		TargetVersion: types.TelemetryVersion(*to),
+	}
+	if err := converter.ConvertRequestWithOptions(request, cs, opts, &compiled.ChangeLog{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitErrors
+	}
+
+	var out bytes.Buffer
+	if err := marshalRequest(&out, *outFormat, request); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+	} else {
+		err = ioutil.WriteFile(*output, out.Bytes(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	for _, line := range summarize(before, request) {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	return exitOK
+}
+
+func compileSchema(file string) (*compiled.Schema, error) {
+	ts, err := schema.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	cs, diags := schema.Compile(ts)
+	if err := diags.Err(schema.SeverityError); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return cs, nil
+}
+
+// detectFormat returns formatJSON if the content looks like a JSON object and
+// formatProto otherwise.
+func detectFormat(content []byte) string {
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		return formatJSON
+	}
+	return formatProto
+}
+
+func newRequest(signal string) (otlp.ExportRequest, error) {
+	switch signal {
+	case "traces":
+		return &otlptracecol.ExportTraceServiceRequest{}, nil
+	case "metrics":
+		return &otlpmetriccol.ExportMetricsServiceRequest{}, nil
+	case "logs":
+		return &otlplogscol.ExportLogsServiceRequest{}, nil
+	case "":
+		return nil, errors.New("the signal of protobuf input is unknown, use -signal")
+	}
+	return nil, fmt.Errorf("unknown signal %q", signal)
+}
+
+func unmarshalRequest(content []byte, format string, request otlp.ExportRequest) error {
+	switch format {
+	case formatProto:
+		return proto.Unmarshal(content, request)
+	case formatJSON:
+		return otlp.UnmarshalJSON(content, request)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func marshalRequest(w io.Writer, format string, request otlp.ExportRequest) error {
+	switch format {
+	case formatProto:
+		content, err := proto.Marshal(request)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	case formatJSON:
+		content, err := otlp.MarshalJSON(request)
+		if err != nil {
+			return err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, content, "", "  "); err != nil {
+			return err
+		}
+		indented.WriteByte('\n')
+		_, err = indented.WriteTo(w)
+		return err
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// summarize describes the changes made by converting the request.
+func summarize(before, after otlp.ExportRequest) []string {
+	var s conversionSummary
+	switch b := before.(type) {
+	case *otlptracecol.ExportTraceServiceRequest:
+		a := after.(*otlptracecol.ExportTraceServiceRequest)
+		for i, rss := range b.ResourceSpans {
+			converted := a.ResourceSpans[i]
+			s.resource(rss.Resource, converted.Resource)
+			s.schemaURL(rss.SchemaUrl, converted.SchemaUrl)
+			for j, ss := range rss.ScopeSpans {
+				s.schemaURL(ss.SchemaUrl, converted.ScopeSpans[j].SchemaUrl)
+				for k, span := range ss.Spans {
+					s.item("spans", span, converted.ScopeSpans[j].Spans[k])
+				}
+			}
+		}
+
+	case *otlpmetriccol.ExportMetricsServiceRequest:
+		a := after.(*otlpmetriccol.ExportMetricsServiceRequest)
+		s.metricNames = map[string]int{}
+		for i, rms := range b.ResourceMetrics {
+			converted := a.ResourceMetrics[i]
+			s.resource(rms.Resource, converted.Resource)
+			s.schemaURL(rms.SchemaUrl, converted.SchemaUrl)
+			for j, sm := range rms.ScopeMetrics {
+				convertedMetrics := converted.ScopeMetrics[j].Metrics
+				s.schemaURL(sm.SchemaUrl, converted.ScopeMetrics[j].SchemaUrl)
+				for k, metric := range sm.Metrics {
+					s.metricNames[metric.Name]--
+					s.item("metrics", metric, matchMetric(sm.Metrics, convertedMetrics, k))
+				}
+				for _, metric := range convertedMetrics {
+					s.metricNames[metric.Name]++
+				}
+			}
+		}
+
+	case *otlplogscol.ExportLogsServiceRequest:
+		a := after.(*otlplogscol.ExportLogsServiceRequest)
+		for i, rls := range b.ResourceLogs {
+			converted := a.ResourceLogs[i]
+			s.resource(rls.Resource, converted.Resource)
+			s.schemaURL(rls.SchemaUrl, converted.SchemaUrl)
+			for j, sl := range rls.ScopeLogs {
+				s.schemaURL(sl.SchemaUrl, converted.ScopeLogs[j].SchemaUrl)
+				for k, record := range sl.LogRecords {
+					s.item("log records", record, converted.ScopeLogs[j].LogRecords[k])
+				}
+			}
+		}
+	}
+	return s.lines()
+}
+
+// matchMetric returns the converted metric that corresponds to the metric at
+// index i of the scope, nil if there is none. Metrics are matched by position
+// if the conversion did not add or remove metrics of the scope, by name
+// otherwise.
+func matchMetric(before, after []*otlpmetric.Metric, i int) *otlpmetric.Metric {
+	if len(before) == len(after) {
+		return after[i]
+	}
+	for _, metric := range after {
+		if metric.Name == before[i].Name {
+			return metric
+		}
+	}
+	return nil
+}
+
+// conversionSummary counts the changes made by a conversion.
+type conversionSummary struct {
+	resources, changedResources int
+	schemaURLs                  map[string]int
+	kind                        string
+	items, changedItems         int
+	// metricNames is the number of metrics of each name after the conversion
+	// minus the number before the conversion.
+	metricNames map[string]int
+}
+
+func (s *conversionSummary) resource(before, after proto.Message) {
+	s.resources++
+	if !proto.Equal(before, after) {
+		s.changedResources++
+	}
+}
+
+func (s *conversionSummary) schemaURL(before, after string) {
+	if before == after {
+		return
+	}
+	if s.schemaURLs == nil {
+		s.schemaURLs = map[string]int{}
+	}
+	s.schemaURLs[fmt.Sprintf("%q -> %q", before, after)]++
+}
+
+func (s *conversionSummary) item(kind string, before, after proto.Message) {
+	s.kind = kind
+	s.items++
+	if !proto.Equal(before, after) {
+		s.changedItems++
+	}
+}
+
+func (s *conversionSummary) lines() []string {
+	lines := []string{fmt.Sprintf("resources: %d of %d changed", s.changedResources, s.resources)}
+	if s.kind != "" {
+		lines = append(lines, fmt.Sprintf("%s: %d of %d changed", s.kind, s.changedItems, s.items))
+	}
+
+	if s.metricNames != nil {
+		var added, removed []string
+		for name, delta := range s.metricNames {
+			switch {
+			case delta > 0:
+				added = append(added, fmt.Sprintf("%s (%d)", name, delta))
+			case delta < 0:
+				removed = append(removed, fmt.Sprintf("%s (%d)", name, -delta))
+			}
+		}
+		sort.Strings(added)
+		sort.Strings(removed)
+		if len(added)+len(removed) == 0 {
+			lines = append(lines, "metrics: no metrics added or removed")
+		}
+		if len(removed) > 0 {
+			lines = append(lines, "metrics removed: "+strings.Join(removed, ", "))
+		}
+		if len(added) > 0 {
+			lines = append(lines, "metrics added: "+strings.Join(added, ", "))
+		}
+	}
+
+	urls := make([]string, 0, len(s.schemaURLs))
+	for change := range s.schemaURLs {
+		urls = append(urls, change)
+	}
+	sort.Strings(urls)
+	for _, change := range urls {
+		lines = append(lines, fmt.Sprintf("schema URL %s: %d time(s)", change, s.schemaURLs[change]))
+	}
+	return lines
+}
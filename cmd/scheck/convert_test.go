@@ -0,0 +1,238 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/otlp"
+)
+
+const (
+	exampleSchema = "../../schema/testdata/schema-example.yaml"
+	schemaURL100  = "https://opentelemetry.io/schemas/1.0.0"
+	schemaURL110  = "https://opentelemetry.io/schemas/1.1.0"
+)
+
+func stringAttr(key, value string) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{
+		Key:   key,
+		Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func gaugeMetric(name string, attrs ...*otlpcommon.KeyValue) *otlpmetric.Metric {
+	return &otlpmetric.Metric{
+		Name: name,
+		Data: &otlpmetric.Metric_Gauge{
+			Gauge: &otlpmetric.Gauge{
+				DataPoints: []*otlpmetric.NumberDataPoint{
+					{Attributes: attrs, Value: &otlpmetric.NumberDataPoint_AsInt{AsInt: 1}},
+				},
+			},
+		},
+	}
+}
+
+func sumMetric(name string, value int64) *otlpmetric.Metric {
+	return &otlpmetric.Metric{
+		Name: name,
+		Unit: "By",
+		Data: &otlpmetric.Metric_Sum{
+			Sum: &otlpmetric.Sum{
+				AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints: []*otlpmetric.NumberDataPoint{
+					{
+						Attributes: []*otlpcommon.KeyValue{stringAttr("device", "sda")},
+						Value:      &otlpmetric.NumberDataPoint_AsInt{AsInt: value},
+					},
+				},
+			},
+		},
+	}
+}
+
+func metricsRequest(schemaURL string) *otlpmetriccol.ExportMetricsServiceRequest {
+	return &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{
+				SchemaUrl: schemaURL,
+				Resource: &otlpresource.Resource{
+					Attributes: []*otlpcommon.KeyValue{stringAttr("k8s.pod.name", "pod")},
+				},
+				ScopeMetrics: []*otlpmetric.ScopeMetrics{
+					{
+						Metrics: []*otlpmetric.Metric{
+							sumMetric("system.disk.io.read", 1),
+							sumMetric("system.disk.io.write", 2),
+							gaugeMetric("unrelated", stringAttr("http.status_code", "200")),
+							gaugeMetric("other", stringAttr("x", "1")),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func traceRequest(schemaURL string) *otlptracecol.ExportTraceServiceRequest {
+	return &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				SchemaUrl: schemaURL,
+				ScopeSpans: []*otlptrace.ScopeSpans{
+					{
+						Spans: []*otlptrace.Span{
+							{
+								TraceId:    []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+								SpanId:     []byte{1, 2, 3, 4, 5, 6, 7, 8},
+								Name:       "changed",
+								Attributes: []*otlpcommon.KeyValue{stringAttr("peer.service", "db")},
+							},
+							{Name: "unchanged", Attributes: []*otlpcommon.KeyValue{stringAttr("x", "1")}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func summaryLines(stderr string) []string {
+	return strings.Split(strings.TrimSuffix(stderr, "\n"), "\n")
+}
+
+func TestConvertProto(t *testing.T) {
+	dir := t.TempDir()
+	request := metricsRequest(schemaURL100)
+	content, err := proto.Marshal(request)
+	require.NoError(t, err)
+	input := writeFile(t, dir, "input.pb", string(content))
+	output := filepath.Join(dir, "output.pb")
+
+	exitCode, stdout, stderr := run(
+		t, convertCommand, "-schema", exampleSchema, "-signal", "metrics", "-o", output, input,
+	)
+	require.Equal(t, exitOK, exitCode, stderr)
+	assert.Empty(t, stdout)
+	assert.Equal(
+		t, []string{
+			"resources: 1 of 1 changed",
+			"metrics: 3 of 4 changed",
+			"metrics removed: system.disk.io.read (1), system.disk.io.write (1)",
+			"metrics added: system.disk.io (1)",
+			`schema URL "https://opentelemetry.io/schemas/1.0.0" -> "https://opentelemetry.io/schemas/1.1.0": 1 time(s)`,
+		}, summaryLines(stderr),
+	)
+
+	content, err = ioutil.ReadFile(output)
+	require.NoError(t, err)
+	converted := &otlpmetriccol.ExportMetricsServiceRequest{}
+	require.NoError(t, proto.Unmarshal(content, converted))
+	rms := converted.ResourceMetrics[0]
+	assert.Equal(t, schemaURL110, rms.SchemaUrl)
+	assert.Equal(t, "kubernetes.pod.name", rms.Resource.Attributes[0].Key)
+	metrics := rms.ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "system.disk.io", metrics[0].Name)
+	assert.Equal(t, "http.response_status_code", metrics[1].GetGauge().DataPoints[0].Attributes[0].Key)
+
+	// Converting back restores the request.
+	exitCode, _, stderr = run(
+		t, convertCommand, "-schema", exampleSchema, "-signal", "metrics", "-to", "1.0.0", "-o", output, output,
+	)
+	require.Equal(t, exitOK, exitCode, stderr)
+	content, err = ioutil.ReadFile(output)
+	require.NoError(t, err)
+	converted = &otlpmetriccol.ExportMetricsServiceRequest{}
+	require.NoError(t, proto.Unmarshal(content, converted))
+	assert.True(t, proto.Equal(request, converted), "%v != %v", request, converted)
+}
+
+func TestConvertJSON(t *testing.T) {
+	dir := t.TempDir()
+	request := traceRequest(schemaURL100)
+	content, err := otlp.MarshalJSON(request)
+	require.NoError(t, err)
+	input := writeFile(t, dir, "input.json", string(content))
+
+	exitCode, stdout, stderr := run(t, convertCommand, "-schema", exampleSchema, input)
+	require.Equal(t, exitOK, exitCode, stderr)
+	assert.Equal(
+		t, []string{
+			"resources: 0 of 1 changed",
+			"spans: 1 of 2 changed",
+			`schema URL "https://opentelemetry.io/schemas/1.0.0" -> "https://opentelemetry.io/schemas/1.1.0": 1 time(s)`,
+		}, summaryLines(stderr),
+	)
+	assert.True(t, strings.HasSuffix(stdout, "}\n"))
+
+	converted, err := otlp.UnmarshalJSONRequest([]byte(stdout))
+	require.NoError(t, err)
+	rss := converted.(*otlptracecol.ExportTraceServiceRequest).ResourceSpans[0]
+	assert.Equal(t, schemaURL110, rss.SchemaUrl)
+	span := rss.ScopeSpans[0].Spans[0]
+	assert.Equal(t, "peer.service.name", span.Attributes[0].Key)
+	assert.Equal(t, request.ResourceSpans[0].ScopeSpans[0].Spans[0].TraceId, span.TraceId)
+
+	// JSON input is written as protobuf if requested.
+	output := filepath.Join(dir, "output.pb")
+	exitCode, _, stderr = run(
+		t, convertCommand, "-schema", exampleSchema, "-out-format", "proto", "-o", output, input,
+	)
+	require.Equal(t, exitOK, exitCode, stderr)
+	content, err = ioutil.ReadFile(output)
+	require.NoError(t, err)
+	fromProto := &otlptracecol.ExportTraceServiceRequest{}
+	require.NoError(t, proto.Unmarshal(content, fromProto))
+	assert.True(t, proto.Equal(converted, fromProto))
+}
+
+func TestConvertFromTo(t *testing.T) {
+	dir := t.TempDir()
+	// The data has no schema URLs, the versions are given on the command line.
+	content, err := otlp.MarshalJSON(traceRequest(""))
+	require.NoError(t, err)
+	input := writeFile(t, dir, "input.json", string(content))
+	output := filepath.Join(dir, "output.json")
+
+	exitCode, _, stderr := run(
+		t, convertCommand, "-schema", exampleSchema, "-from", "1.0.0", "-to", "1.1.0", "-o", output, input,
+	)
+	require.Equal(t, exitOK, exitCode, stderr)
+	assert.Contains(t, summaryLines(stderr), "spans: 1 of 2 changed")
+	content, err = ioutil.ReadFile(output)
+	require.NoError(t, err)
+	converted, err := otlp.UnmarshalJSONRequest(content)
+	require.NoError(t, err)
+	span := converted.(*otlptracecol.ExportTraceServiceRequest).ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "peer.service.name", span.Attributes[0].Key)
+
+	exitCode, _, stderr = run(
+		t, convertCommand, "-schema", exampleSchema, "-from", "1.1.0", "-to", "1.0.0", "-o", output, output,
+	)
+	require.Equal(t, exitOK, exitCode, stderr)
+	content, err = ioutil.ReadFile(output)
+	require.NoError(t, err)
+	converted, err = otlp.UnmarshalJSONRequest(content)
+	require.NoError(t, err)
+	span = converted.(*otlptracecol.ExportTraceServiceRequest).ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "peer.service", span.Attributes[0].Key)
+
+	exitCode, stdout, stderr := run(t, convertCommand, "-schema", exampleSchema, "-to", "9.9.9", input)
+	assert.Equal(t, exitErrors, exitCode)
+	assert.Empty(t, stdout)
+	assert.Equal(t, "unknown target version 9.9.9\n", stderr)
+}
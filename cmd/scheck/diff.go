@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/diff"
+)
+
+// diffCommand prints the changes between two schema files. Returns the exit
+// code: exitErrors if a published version is changed and exitParseErrors if a
+// file cannot be parsed.
+func diffCommand(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(
+			flags.Output(), "Usage: scheck diff [-format text|json] old-file new-file\n\n"+
+				"Lists the versions and the rules that are added, removed or changed in the new file.\n"+
+				"Versions of the old file up to the version of its schema_url are published and\n"+
+				"must not change. Exits with 1 if they do and with 4 if a file cannot be parsed.\n\n",
+		)
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "text", "output format: text or json")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 2 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var schemas [2]*ast.Schema
+	for i, file := range flags.Args() {
+		ts, err := schema.Parse(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			var parseErrs schema.ParseErrors
+			if errors.As(err, &parseErrs) {
+				return exitParseErrors
+			}
+			return exitUsage
+		}
+		schemas[i] = ts
+	}
+
+	changes := diff.Diff(schemas[0], schemas[1])
+	var err error
+	if *format == "json" {
+		err = reportDiffJSON(os.Stdout, changes)
+	} else {
+		err = reportDiffText(os.Stdout, changes)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	for _, c := range changes {
+		if c.Published {
+			return exitErrors
+		}
+	}
+	return exitOK
+}
+
+func reportDiffText(w io.Writer, changes []diff.Change) error {
+	published := 0
+	for _, c := range changes {
+		if c.Published {
+			published++
+		}
+		if _, err := fmt.Fprintln(w, c.String()); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch {
+	case len(changes) == 0:
+		_, err = fmt.Fprintln(w, "No changes.")
+	case published > 0:
+		_, err = fmt.Fprintf(
+			w, "%d change(s), %d of them to published versions which must not change.\n", len(changes), published,
+		)
+	default:
+		_, err = fmt.Fprintf(w, "%d change(s).\n", len(changes))
+	}
+	return err
+}
+
+func reportDiffJSON(w io.Writer, changes []diff.Change) error {
+	if changes == nil {
+		changes = []diff.Change{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Changes []diff.Change `json:"changes"`
+	}{changes})
+}
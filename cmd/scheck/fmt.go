@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+)
+
+// fmtCommand rewrites schema files in the canonical form. Returns the exit code.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(), "Usage: scheck fmt [-w] [-l] [file ...]\n\n"+
+				"Prints schema files in the canonical form. Reads standard input if no files are given.\n"+
+				"Comments are not preserved. Unknown keys are errors. If a file cannot be parsed nothing\n"+
+				"is written and the exit code is 4.\n\n",
+		)
+		flags.PrintDefaults()
+	}
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	list := flags.Bool("l", false, "list files whose formatting differs from the canonical form")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		if *write || *list {
+			fmt.Fprintln(os.Stderr, "-w and -l require file arguments")
+			return exitUsage
+		}
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		formatted, err := formatSchema("<stdin>", content)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitParseErrors
+		}
+		_, _ = os.Stdout.Write(formatted)
+		return exitOK
+	}
+
+	// All files are parsed before anything is written, so that a file that
+	// cannot be parsed prevents all changes.
+	var files []formattedFile
+	exitCode := exitOK
+	for _, file := range flags.Args() {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		formatted, err := formatSchema(file, content)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = exitParseErrors
+			continue
+		}
+		files = append(files, formattedFile{name: file, content: content, formatted: formatted})
+	}
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	for _, file := range files {
+		if err := file.output(*write, *list); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = exitErrors
+		}
+	}
+	return exitCode
+}
+
+type formattedFile struct {
+	name      string
+	content   []byte
+	formatted []byte
+}
+
+func (f formattedFile) output(write, list bool) error {
+	changed := !bytes.Equal(f.content, f.formatted)
+	if list && changed {
+		fmt.Println(f.name)
+	}
+	if write {
+		if !changed {
+			return nil
+		}
+		info, err := os.Stat(f.name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(f.name, f.formatted, info.Mode().Perm())
+	}
+	if !list {
+		_, err := os.Stdout.Write(f.formatted)
+		return err
+	}
+	return nil
+}
+
+// formatSchema returns the content in the canonical form. Unknown keys are
+// errors, since they would be dropped from the output.
+func formatSchema(name string, content []byte) ([]byte, error) {
+	ts, err := schema.ParseBytesWithOptions(name, content, schema.ParseOptions{Strict: true})
+	if err != nil {
+		return nil, err
+	}
+	return schema.Marshal(ts)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyFile copies the file to the temporary directory of the test and returns
+// the path of the copy and the content.
+func copyFile(t *testing.T, file string) (string, []byte) {
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), filepath.Base(file))
+	require.NoError(t, ioutil.WriteFile(path, content, 0644))
+	return path, content
+}
+
+func TestFmtWrite(t *testing.T) {
+	file, content := copyFile(t, "../../schema/testdata/schema-example.yaml")
+
+	exitCode, _, _ := run(t, fmtCommand, "-w", file)
+	assert.Equal(t, exitOK, exitCode)
+	formatted, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotEqual(t, content, formatted)
+
+	// The canonical form is stable.
+	exitCode, _, _ = run(t, fmtCommand, "-w", file)
+	assert.Equal(t, exitOK, exitCode)
+	again, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, formatted, again)
+}
+
+func TestFmtWriteUnknownKeys(t *testing.T) {
+	misspelled, misspelledContent := copyFile(t, "../../schema/testdata/schema-misspelled.yaml")
+	example, exampleContent := copyFile(t, "../../schema/testdata/schema-example.yaml")
+
+	// Unknown keys would be dropped from the output, so nothing is written.
+	exitCode, _, _ := run(t, fmtCommand, "-w", example, misspelled)
+	assert.Equal(t, exitParseErrors, exitCode)
+	content, err := ioutil.ReadFile(misspelled)
+	require.NoError(t, err)
+	assert.Equal(t, misspelledContent, content)
+	content, err = ioutil.ReadFile(example)
+	require.NoError(t, err)
+	assert.Equal(t, exampleContent, content)
+}
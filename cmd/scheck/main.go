@@ -1,72 +1,106 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"net/url"
 	"os"
-	"path"
-	"strings"
+)
 
-	"github.com/tigrannajaryan/telemetry-schema/schema"
-	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+// Exit codes of scheck.
+const (
+	// exitOK is returned if no problems are found.
+	exitOK = 0
+	// exitErrors is returned if at least one error is found.
+	exitErrors = 1
+	// exitWarnings is returned if warnings but no errors are found.
+	exitWarnings = 2
+	// exitUsage is returned if the command line is invalid or the input
+	// cannot be read.
+	exitUsage = 3
+	// exitParseErrors is returned by fmt, diff and convert if a schema file
+	// cannot be parsed.
+	exitParseErrors = 4
 )
 
-func main() {
-	var inputFile string
-	flag.StringVar(&inputFile, "i", "", "schema file to check")
-	flag.Parse()
-	if inputFile == "" {
-		fmt.Print("Must specify a schema file to check.\n")
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
+const usage = `Usage: scheck -i file [flags]
+       scheck fmt [-w] [-l] [file ...]
+       scheck diff [-format text|json] old-file new-file
+       scheck convert -schema file [-from version] [-to version] [flags] input-file
 
-	ts, err := schema.Parse(inputFile)
-	if err != nil {
-		fmt.Print(err.Error())
-		os.Exit(1)
-	}
+Checks the schema file and reports all problems found.
 
-	if ts.FileFormat != "1.0.0" {
-		fmt.Printf("file_format must be 1.0.0.\n")
-		os.Exit(1)
-	}
+Exit codes:
+  0  no problems found
+  1  errors found by check, a published version changed (diff), the input
+     cannot be converted (convert) or a file cannot be written (fmt)
+  2  warnings found by check, but no errors
+  3  invalid command line, a file cannot be read or the output of convert
+     cannot be written
+  4  a schema file cannot be parsed (fmt, diff and convert); check reports
+     parse errors as errors
 
-	if ts == nil {
-		panic("Schema is empty")
-	}
+`
 
-	schemaVerInFileName := path.Base(inputFile)
-	fmt.Printf("Schema version according to file name is %s.\n", schemaVerInFileName)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(fmtCommand(os.Args[2:]))
+		case "diff":
+			os.Exit(diffCommand(os.Args[2:]))
+		case "convert":
+			os.Exit(convertCommand(os.Args[2:]))
+		}
+	}
+	os.Exit(checkCommand(os.Args[1:]))
+}
 
-	if _, ok := ts.Versions[types.TelemetryVersion(schemaVerInFileName)]; !ok {
-		fmt.Printf("Schema version %s is not found in the file.\n", schemaVerInFileName)
-		os.Exit(1)
+// checkCommand checks the schema file. Returns the exit code.
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("scheck", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	inputFile := flags.String("i", "", "schema file to check")
+	strict := flags.Bool("strict", false, "report unknown and misspelled keys")
+	format := flags.String("format", "text", "output format: text, json or sarif")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
 
-	if ts.SchemaURL == "" {
-		fmt.Printf("schema_url is missing.\n")
-		os.Exit(1)
+	report, exists := reporters[*format]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *format)
+		flags.Usage()
+		return exitUsage
+	}
+	if *inputFile == "" {
+		fmt.Fprintln(os.Stderr, "Must specify a schema file to check.")
+		flags.Usage()
+		return exitUsage
 	}
 
-	surl, err := url.Parse(ts.SchemaURL)
+	problems, err := check(*inputFile, *strict)
 	if err != nil {
-		fmt.Printf("schema_url cannot be parsed: %v.\n", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
 	}
-
-	paths := strings.Split(surl.Path, "/")
-	if len(paths) == 0 {
-		fmt.Printf("schema_url path should not be empty.\n")
-		os.Exit(1)
+	if err := report(os.Stdout, *inputFile, problems); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
 	}
 
-	schemaVerInPath := paths[len(paths)-1]
-	if schemaVerInPath != schemaVerInFileName {
-		fmt.Printf("The last part of schema_url path is %s but expected %s\n", schemaVerInPath, schemaVerInFileName)
-		os.Exit(5)
+	exitCode := exitOK
+	for _, p := range problems {
+		if p.Severity == severityError {
+			return exitErrors
+		}
+		exitCode = exitWarnings
 	}
-
-	fmt.Printf("%s schema file checks are successful.\n", inputFile)
+	return exitCode
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run calls the command with the standard output and error redirected. Returns
+// the exit code and the output.
+func run(t *testing.T, command func([]string) int, args ...string) (int, string, string) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	require.NoError(t, err)
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	require.NoError(t, err)
+	defer stderr.Close()
+
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	exitCode := command(args)
+	os.Stdout, os.Stderr = savedStdout, savedStderr
+
+	stdoutContent, err := ioutil.ReadFile(stdout.Name())
+	require.NoError(t, err)
+	stderrContent, err := ioutil.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	return exitCode, string(stdoutContent), string(stderrContent)
+}
+
+// writeFile writes the content to the file in the directory and returns the
+// path of the file.
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+const (
+	validSchema = `file_format: 1.1.0
+schema_url: https://example.com/schemas/1.1.0
+versions:
+  1.1.0:
+    resources:
+      changes:
+        - rename_attributes:
+            a: b
+  1.0.0:
+`
+	// changedSchema changes the published version 1.1.0 of validSchema.
+	changedSchema = `file_format: 1.1.0
+schema_url: https://example.com/schemas/1.1.0
+versions:
+  1.1.0:
+    resources:
+      changes:
+        - rename_attributes:
+            a: c
+  1.0.0:
+`
+	// warningSchema has an entry without an action.
+	warningSchema = `file_format: 1.1.0
+schema_url: https://example.com/schemas/1.1.0
+versions:
+  1.1.0:
+    resources:
+      changes:
+        - {}
+  1.0.0:
+`
+	// errorSchema has schema_url that does not match the file name.
+	errorSchema = `file_format: 1.1.0
+schema_url: https://example.com/schemas/1.0.0
+versions:
+  1.1.0:
+  1.0.0:
+`
+	invalidSchema = "versions: [\n"
+)
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	valid := writeFile(t, t.TempDir(), "1.1.0", validSchema)
+	changed := writeFile(t, t.TempDir(), "1.1.0", changedSchema)
+	warning := writeFile(t, t.TempDir(), "1.1.0", warningSchema)
+	withErrors := writeFile(t, t.TempDir(), "1.1.0", errorSchema)
+	invalid := writeFile(t, dir, "invalid.yaml", invalidSchema)
+	misspelled := writeFile(t, dir, "misspelled.yaml", validSchema+"    logz: {}\n")
+	missing := filepath.Join(dir, "missing.yaml")
+	// An empty protobuf request.
+	request := writeFile(t, dir, "request.pb", "")
+
+	tests := []struct {
+		name     string
+		command  func([]string) int
+		args     []string
+		exitCode int
+	}{
+		{name: "check ok", command: checkCommand, args: []string{"-i", valid}, exitCode: exitOK},
+		{name: "check errors", command: checkCommand, args: []string{"-i", withErrors}, exitCode: exitErrors},
+		{name: "check parse errors", command: checkCommand, args: []string{"-i", invalid}, exitCode: exitErrors},
+		{name: "check warnings", command: checkCommand, args: []string{"-i", warning}, exitCode: exitWarnings},
+		{name: "check missing file", command: checkCommand, args: []string{"-i", missing}, exitCode: exitUsage},
+		{
+			name: "check unknown format", command: checkCommand, args: []string{"-i", valid, "-format", "xml"},
+			exitCode: exitUsage,
+		},
+		{name: "check no file", command: checkCommand, exitCode: exitUsage},
+
+		{name: "diff ok", command: diffCommand, args: []string{valid, valid}, exitCode: exitOK},
+		{name: "diff published", command: diffCommand, args: []string{valid, changed}, exitCode: exitErrors},
+		{name: "diff parse errors", command: diffCommand, args: []string{valid, invalid}, exitCode: exitParseErrors},
+		{name: "diff missing file", command: diffCommand, args: []string{valid, missing}, exitCode: exitUsage},
+		{name: "diff one file", command: diffCommand, args: []string{valid}, exitCode: exitUsage},
+
+		{
+			name: "convert parse errors", command: convertCommand,
+			args: []string{"-schema", invalid, "-signal", "traces", request}, exitCode: exitParseErrors,
+		},
+		{
+			name: "convert missing schema", command: convertCommand,
+			args: []string{"-schema", missing, "-signal", "traces", request}, exitCode: exitUsage,
+		},
+		{name: "convert no schema", command: convertCommand, args: []string{request}, exitCode: exitUsage},
+
+		// fmt returns exitErrors only if a file cannot be written.
+		{name: "fmt ok", command: fmtCommand, args: []string{valid}, exitCode: exitOK},
+		{name: "fmt parse errors", command: fmtCommand, args: []string{invalid}, exitCode: exitParseErrors},
+		{name: "fmt unknown keys", command: fmtCommand, args: []string{"-l", misspelled}, exitCode: exitParseErrors},
+		{name: "fmt missing file", command: fmtCommand, args: []string{valid, missing}, exitCode: exitUsage},
+		{name: "fmt unknown flag", command: fmtCommand, args: []string{"-x"}, exitCode: exitUsage},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				exitCode, _, stderr := run(t, test.command, test.args...)
+				assert.Equal(t, test.exitCode, exitCode, stderr)
+			},
+		)
+	}
+}
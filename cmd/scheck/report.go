@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// reporter writes the problems found in the file to w.
+type reporter func(w io.Writer, file string, problems []problem) error
+
+var reporters = map[string]reporter{
+	"text":  reportText,
+	"json":  reportJSON,
+	"sarif": reportSARIF,
+}
+
+func reportText(w io.Writer, file string, problems []problem) error {
+	for _, p := range problems {
+		pos := []string{file}
+		if p.Line > 0 {
+			pos = append(pos, strconv.Itoa(p.Line))
+			if p.Column > 0 {
+				pos = append(pos, strconv.Itoa(p.Column))
+			}
+		}
+
+		where := p.context()
+		if where != "" {
+			where += ": "
+		}
+
+		_, err := fmt.Fprintf(w, "%s: %s: %s%s [%s]\n", strings.Join(pos, ":"), p.Severity, where, p.Message, p.Rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs, warnings int
+	for _, p := range problems {
+		if p.Severity == severityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	var err error
+	if len(problems) == 0 {
+		_, err = fmt.Fprintf(w, "%s schema file checks are successful.\n", file)
+	} else {
+		_, err = fmt.Fprintf(w, "%d error(s), %d warning(s).\n", errs, warnings)
+	}
+	return err
+}
+
+// context returns the versions and the section the problem is found in or an
+// empty string if the problem is not specific to a version.
+func (p problem) context() string {
+	if len(p.Versions) == 0 {
+		return ""
+	}
+	versions := make([]string, len(p.Versions))
+	for i, v := range p.Versions {
+		versions[i] = string(v)
+	}
+	label := "version "
+	if len(versions) > 1 {
+		label = "versions "
+	}
+	context := label + strings.Join(versions, ", ")
+	if p.Section != "" {
+		context += ", section " + p.Section
+	}
+	return context
+}
+
+type jsonReport struct {
+	File     string    `json:"file"`
+	Problems []problem `json:"problems"`
+}
+
+func reportJSON(w io.Writer, file string, problems []problem) error {
+	if problems == nil {
+		problems = []problem{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonReport{File: file, Problems: problems})
+}
+
+// The subset of SARIF 2.1.0 format used to report the problems.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+func reportSARIF(w io.Writer, file string, problems []problem) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "scheck"}},
+		Results: []sarifResult{},
+	}
+	for _, id := range ruleOrder {
+		run.Tool.Driver.Rules = append(
+			run.Tool.Driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: ruleDescriptions[id]}},
+		)
+	}
+
+	uri := filepath.ToSlash(file)
+	for _, p := range problems {
+		message := p.Message
+		if where := p.context(); where != "" {
+			message = where + ": " + message
+		}
+
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}}}
+		if p.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: p.Line, StartColumn: p.Column}
+		}
+		run.Results = append(
+			run.Results, sarifResult{
+				RuleID:    p.Rule,
+				Level:     p.Severity,
+				Message:   sarifMessage{Text: message},
+				Locations: []sarifLocation{location},
+			},
+		)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(
+		sarifLog{
+			Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+			Version: "2.1.0",
+			Runs:    []sarifRun{run},
+		},
+	)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// checkGolden compares the output with the content of the golden file in
+// testdata. With -update the golden file is replaced by the output instead.
+func checkGolden(t *testing.T, name string, output []byte) {
+	golden := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, ioutil.WriteFile(golden, output, 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(output))
+}
+
+func TestReporters(t *testing.T) {
+	problems := []problem{
+		{
+			Severity: severityError,
+			Rule:     ruleCompile,
+			Line:     12,
+			Column:   7,
+			Versions: []types.TelemetryVersion{"1.1.0"},
+			Section:  "metrics",
+			Message:  "entry 0: split must set apply_to_metric, by_attribute and metrics_from_attributes",
+		},
+		{
+			Severity: severityWarning,
+			Rule:     ruleCompile,
+			Line:     20,
+			Versions: []types.TelemetryVersion{"1.0.0"},
+			Section:  "logs",
+			Message:  "entry 1 has no action",
+		},
+	}
+
+	for _, format := range []string{"text", "json", "sarif"} {
+		for _, test := range []struct {
+			name     string
+			problems []problem
+		}{
+			{name: "problems", problems: problems},
+			{name: "empty", problems: nil},
+		} {
+			t.Run(
+				format+" "+test.name, func(t *testing.T) {
+					var buf bytes.Buffer
+					require.NoError(t, reporters[format](&buf, "schemas/1.1.0", test.problems))
+					checkGolden(t, "report-"+test.name+"."+format, buf.Bytes())
+				},
+			)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/proxy"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+const usage = `Usage: schemaproxy -schema file -upstream host:port [flags]
+
+Receives OTLP traces, metrics and logs over gRPC and HTTP, converts them to the
+target version of the schema and forwards them to the upstream OTLP/gRPC receiver.
+
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	schemaFile := flag.String("schema", "", "schema file to convert with")
+	listen := flag.String("listen", "localhost:4317", "address to receive OTLP/gRPC on")
+	httpListen := flag.String("http-listen", "localhost:4318", "address to receive OTLP/HTTP on, disabled if empty")
+	upstream := flag.String("upstream", "", "address of the upstream OTLP/gRPC receiver")
+	targetVersion := flag.String("target-version", "", "version to convert to, the latest version of the schema if empty")
+	maxConcurrent := flag.Int("max-concurrent", proxy.DefaultMaxConcurrent, "maximum number of requests in progress")
+	maxPending := flag.Int(
+		"max-pending", proxy.DefaultMaxPending, "maximum number of requests waiting, further requests are rejected",
+	)
+	onError := flag.String("on-error", "reject", "handling of requests that cannot be converted: reject, drop or forward")
+	flag.Parse()
+
+	if *schemaFile == "" || *upstream == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	policy, err := proxy.ParseErrorPolicy(*onError)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ts, err := schema.Parse(*schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cs, diags := schema.Compile(ts)
+	if err := diags.Err(schema.SeverityError); err != nil {
+		log.Fatal(err)
+	}
+	target := types.TelemetryVersion(*targetVersion)
+	if target != "" {
+		if _, err := target.Parse(); err != nil {
+			log.Fatalf("invalid -target-version: %v", err)
+		}
+		if !cs.HasVersion(target) {
+			log.Fatalf("invalid -target-version: version %s is not in schema %s", target, *schemaFile)
+		}
+	}
+
+	conn, err := grpc.Dial(*upstream, grpc.WithInsecure())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	p := proxy.New(
+		cs, conn, proxy.Options{
+			TargetVersion: target,
+			MaxConcurrent: *maxConcurrent,
+			MaxPending:    *maxPending,
+			ErrorPolicy:   policy,
+		},
+	)
+	server := grpc.NewServer()
+	p.Register(server)
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	httpServer := &http.Server{Addr: *httpListen, Handler: p.Handler()}
+	if *httpListen != "" {
+		httpListener, err := net.Listen("tcp", *httpListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Receiving OTLP/HTTP on %s.", httpListener.Addr())
+		go func() {
+			if err := httpServer.Serve(httpListener); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		_ = httpServer.Shutdown(context.Background())
+		server.GracefulStop()
+	}()
+
+	log.Printf("Receiving OTLP/gRPC on %s, forwarding to %s.", listener.Addr(), *upstream)
+	if err := server.Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -3,26 +3,26 @@ package ast
 import "github.com/tigrannajaryan/telemetry-schema/schema/types"
 
 type Schema struct {
-	FileFormat string `yaml:"file_format"`
-	SchemaURL  string `yaml:"schema_url"`
-	Versions   map[types.TelemetryVersion]VersionDef
+	FileFormat string                                `yaml:"file_format,omitempty"`
+	SchemaURL  string                                `yaml:"schema_url,omitempty"`
+	Versions   map[types.TelemetryVersion]VersionDef `yaml:",omitempty"`
 }
 
 type VersionDef struct {
-	All        VersionOfAttributes
-	Resources  VersionOfAttributes
-	Spans      VersionOfSpans
-	SpanEvents VersionOfSpanEvents `yaml:"span_events"`
-	Logs       VersionOfLogs
-	Metrics    VersionOfMetrics
+	All        VersionOfAttributes `yaml:",omitempty"`
+	Resources  VersionOfAttributes `yaml:",omitempty"`
+	Spans      VersionOfSpans      `yaml:",omitempty"`
+	SpanEvents VersionOfSpanEvents `yaml:"span_events,omitempty"`
+	Metrics    VersionOfMetrics    `yaml:",omitempty"`
+	Logs       VersionOfLogs       `yaml:",omitempty"`
 }
 
 type VersionOfAttributes struct {
-	Changes []AttributeTranslationAction
+	Changes []AttributeTranslationAction `yaml:",omitempty"`
 }
 
 type AttributeTranslationAction struct {
-	RenameAttributes *MappingOfAttributes `yaml:"rename_attributes"`
+	RenameAttributes *MappingOfAttributes `yaml:"rename_attributes,omitempty"`
 }
 
 type MappingOfAttributes map[string]string
@@ -1,13 +1,17 @@
 package ast
 
+import "github.com/tigrannajaryan/telemetry-schema/schema/types"
+
 type VersionOfLogs struct {
-	Changes []LogTranslationAction
+	Changes []LogTranslationAction `yaml:",omitempty"`
 }
 
 type LogTranslationAction struct {
-	RenameAttributes *RenameLogAttributes `yaml:"rename_attributes"`
+	RenameLogs       map[types.LogName]types.LogName `yaml:"rename_logs,omitempty"`
+	RenameAttributes *RenameLogAttributes            `yaml:"rename_attributes,omitempty"`
 }
 
 type RenameLogAttributes struct {
-	AttributeMap map[string]string `yaml:"attribute_map"`
+	ApplyToLogs  []types.LogName   `yaml:"apply_to_logs,omitempty"`
+	AttributeMap map[string]string `yaml:"attribute_map,omitempty"`
 }
@@ -3,49 +3,49 @@ package ast
 import "github.com/tigrannajaryan/telemetry-schema/schema/types"
 
 type VersionOfMetrics struct {
-	Changes []MetricTranslationAction
-	Current []MetricSchema `yaml:"current_metric_schema"`
+	Changes []MetricTranslationAction `yaml:",omitempty"`
+	Current []MetricSchema            `yaml:"current_metric_schema,omitempty"`
 }
 
 type MetricTranslationAction struct {
-	RenameMetrics       map[types.MetricName]types.MetricName `yaml:"rename_metrics"`
-	RenameLabels        *AttributeMapForMetrics               `yaml:"rename_attributes"`
-	AddAttributes       *AttributeMapForMetrics               `yaml:"add_attributes"`
-	DuplicateAttributes *AttributeMapForMetrics               `yaml:"duplicate_attributes"`
-	Split               *SplitMetric                          `yaml:"split"`
-	Merge               *MergeMetric                          `yaml:"merge"`
-	ToDelta             []types.MetricName                    `yaml:"to_delta"`
+	RenameMetrics       map[types.MetricName]types.MetricName `yaml:"rename_metrics,omitempty"`
+	RenameLabels        *AttributeMapForMetrics               `yaml:"rename_attributes,omitempty"`
+	AddAttributes       *AttributeMapForMetrics               `yaml:"add_attributes,omitempty"`
+	DuplicateAttributes *AttributeMapForMetrics               `yaml:"duplicate_attributes,omitempty"`
+	Split               *SplitMetric                          `yaml:"split,omitempty"`
+	Merge               *MergeMetric                          `yaml:"merge,omitempty"`
+	ToDelta             []types.MetricName                    `yaml:"to_delta,omitempty"`
 }
 
 type AttributeMapForMetrics struct {
-	ApplyToMetrics []types.MetricName `yaml:"apply_to_metrics"`
-	AttributeMap   map[string]string  `yaml:"label_map"`
+	ApplyToMetrics []types.MetricName `yaml:"apply_to_metrics,omitempty"`
+	AttributeMap   map[string]string  `yaml:"attribute_map,omitempty"`
 }
 
 type SplitMetric struct {
-	ApplyToMetric       types.MetricName                          `yaml:"apply_to_metric"`
-	ByAttribute         types.AttributeName                       `yaml:"by_attribute"`
-	AttributesToMetrics map[types.MetricName]types.AttributeValue `yaml:"metrics_from_attributes"`
+	ApplyToMetric       types.MetricName                          `yaml:"apply_to_metric,omitempty"`
+	ByAttribute         types.AttributeName                       `yaml:"by_attribute,omitempty"`
+	AttributesToMetrics map[types.MetricName]types.AttributeValue `yaml:"metrics_from_attributes,omitempty"`
 }
 
 type MergeMetric struct {
-	CreateMetric         types.MetricName                          `yaml:"create_metric"`
-	ByAttribute          string                                    `yaml:"by_attribute"`
-	AttributesForMetrics map[types.MetricName]types.AttributeValue `yaml:"attributes_for_metrics"`
+	CreateMetric         types.MetricName                          `yaml:"create_metric,omitempty"`
+	ByAttribute          string                                    `yaml:"by_attribute,omitempty"`
+	AttributesForMetrics map[types.MetricName]types.AttributeValue `yaml:"attributes_for_metrics,omitempty"`
 }
 
 type MetricSchema struct {
-	MetricNames []string `yaml:"metric_names"`
-	Unit        string
-	ValueType   string `yaml:"value_type"`
-	Temporality string
-	Monotonic   bool
-	Attributes  map[string]AttributesSchema
+	MetricNames []string                    `yaml:"metric_names,omitempty"`
+	Unit        string                      `yaml:",omitempty"`
+	ValueType   string                      `yaml:"value_type,omitempty"`
+	Temporality string                      `yaml:",omitempty"`
+	Monotonic   bool                        `yaml:",omitempty"`
+	Attributes  map[string]AttributesSchema `yaml:",omitempty"`
 }
 
 type AttributesSchema struct {
-	Values      []string
-	Description string
-	Required    string
-	Example     string
+	Values      []string `yaml:",omitempty"`
+	Description string   `yaml:",omitempty"`
+	Required    string   `yaml:",omitempty"`
+	Example     string   `yaml:",omitempty"`
 }
@@ -3,32 +3,32 @@ package ast
 import "github.com/tigrannajaryan/telemetry-schema/schema/types"
 
 type VersionOfSpans struct {
-	Changes []SpanTranslationAction
+	Changes []SpanTranslationAction `yaml:",omitempty"`
 }
 
 type VersionOfSpanEvents struct {
-	Changes []SpanEventTranslationAction
+	Changes []SpanEventTranslationAction `yaml:",omitempty"`
 }
 
 type SpanTranslationAction struct {
-	RenameAttributes *RenameSpanAttributes `yaml:"rename_attributes"`
+	RenameAttributes *RenameSpanAttributes `yaml:"rename_attributes,omitempty"`
 }
 
 type SpanEventTranslationAction struct {
-	RenameEvents     *RenameSpanEvents          `yaml:"rename_events"`
-	RenameAttributes *RenameSpanEventAttributes `yaml:"rename_attributes"`
+	RenameEvents     *RenameSpanEvents          `yaml:"rename_events,omitempty"`
+	RenameAttributes *RenameSpanEventAttributes `yaml:"rename_attributes,omitempty"`
 }
 
 type RenameSpanAttributes struct {
-	AttributeMap map[string]string `yaml:"attribute_map"`
+	AttributeMap map[string]string `yaml:"attribute_map,omitempty"`
 }
 
 type RenameSpanEvents struct {
-	EventNameMap map[string]string `yaml:"name_map"`
+	EventNameMap map[string]string `yaml:"name_map,omitempty"`
 }
 
 type RenameSpanEventAttributes struct {
-	ApplyToSpans  []types.SpanName  `yaml:"apply_to_spans"`
-	ApplyToEvents []types.EventName `yaml:"apply_to_events"`
-	AttributeMap  map[string]string `yaml:"attribute_map"`
+	ApplyToSpans  []types.SpanName  `yaml:"apply_to_spans,omitempty"`
+	ApplyToEvents []types.EventName `yaml:"apply_to_events,omitempty"`
+	AttributeMap  map[string]string `yaml:"attribute_map,omitempty"`
 }
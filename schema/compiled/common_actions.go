@@ -4,8 +4,30 @@ import (
 	"fmt"
 
 	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
+// NewAnyValue converts an attribute value specified in the schema file to an
+// OTLP attribute value. Only scalar values are supported.
+func NewAnyValue(v types.AttributeValue) (*otlpcommon.AnyValue, error) {
+	switch v := v.(type) {
+	case string:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: v}}, nil
+	case int:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: int64(v)}}, nil
+	case int64:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: v}}, nil
+	case uint64:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: int64(v)}}, nil
+	case float64:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: v}}, nil
+	case bool:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: v}}, nil
+	}
+	return nil, fmt.Errorf("unsupported attribute value %v of type %T", v, v)
+}
+
 type AttributesRenameAction map[string]string
 
 func (at AttributesRenameAction) Apply(attrs []*otlpcommon.KeyValue, changes *ChangeLog) error {
@@ -31,9 +53,9 @@ func (at AttributesRenameAction) Apply(attrs []*otlpcommon.KeyValue, changes *Ch
 
 			if changes.Enabled && changeLog.savedAttrs == nil {
 				changeLog.origAttrs = attrs
-				changeLog.savedAttrs = make([]otlpcommon.KeyValue, len(attrs))
+				changeLog.savedAttrs = make([]keyVal, len(attrs))
 				for j, attr := range attrs {
-					changeLog.savedAttrs[j] = *attr
+					changeLog.savedAttrs[j] = keyVal{key: attr.Key, val: attr.Value}
 				}
 			}
 
@@ -50,12 +72,13 @@ func (at AttributesRenameAction) Apply(attrs []*otlpcommon.KeyValue, changes *Ch
 
 type attrsModifyLog struct {
 	origAttrs  []*otlpcommon.KeyValue
-	savedAttrs []otlpcommon.KeyValue
+	savedAttrs []keyVal
 }
 
 func (r *attrsModifyLog) Rollback() {
 	for i := 0; i < len(r.savedAttrs); i++ {
-		*r.origAttrs[i] = r.savedAttrs[i]
+		r.origAttrs[i].Key = r.savedAttrs[i].key
+		r.origAttrs[i].Value = r.savedAttrs[i].val
 	}
 }
 
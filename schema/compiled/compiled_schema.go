@@ -1,8 +1,11 @@
 package compiled
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
 	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
 	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
 	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
@@ -12,6 +15,14 @@ import (
 
 type Schema struct {
 	Versions ActionsForVersions
+
+	// SchemaURL is the schema_url of the schema file. Empty if the file does not
+	// specify it.
+	SchemaURL string
+
+	// DeltaStore keeps the state of the time series converted by to_delta
+	// actions of all versions.
+	DeltaStore *DeltaStore
 }
 
 type ActionsForVersions []*ActionsForVersion
@@ -19,11 +30,75 @@ type ActionsForVersions []*ActionsForVersion
 // ActionsForVersion is the cumulative list of actions to apply in order
 // to convert the schema from the specified Version to the latest Version.
 type ActionsForVersion struct {
-	VersionNum types.TelemetryVersion
+	VersionNum types.Version
 	Resource   ResourceActions
 	Spans      SpanActions
 	Metrics    MetricActions
-	//Logs     []LogRecordAction
+	Logs       LogActions
+
+	// Reverse holds the actions that convert data from this version back to the
+	// version that precedes it.
+	Reverse ReverseActions
+}
+
+// ReverseActions is the list of actions to apply in order to convert data from
+// a version back to the preceding version. The actions are the inverses of the
+// version's actions, listed in reverse order.
+type ReverseActions struct {
+	Resource ResourceActions
+	Spans    SpanActions
+	Metrics  MetricActions
+	Logs     LogActions
+
+	// Irreversible lists the actions of the version that have no inverse.
+	// Converting data to a lower version across this version fails if the data
+	// contains anything an irreversible action applies to.
+	Irreversible []IrreversibleAction
+}
+
+// Section names as they appear in the schema file.
+const (
+	SectionAll        = "all"
+	SectionResources  = "resources"
+	SectionSpans      = "spans"
+	SectionSpanEvents = "span_events"
+	SectionMetrics    = "metrics"
+	SectionLogs       = "logs"
+)
+
+// IrreversibleAction describes an action that cannot be inverted.
+type IrreversibleAction struct {
+	// Section is the schema file section where the action is defined.
+	Section string
+	// Reason describes the action and why it cannot be inverted.
+	Reason string
+	// Metrics is the set of metrics the action applies to, named as in the
+	// version that defines the action. Nil if the action applies to all data
+	// of the section.
+	Metrics map[types.MetricName]bool
+}
+
+// IrreversibleError is returned when data cannot be converted to a lower version
+// because some actions of Version cannot be inverted.
+type IrreversibleError struct {
+	Version types.Version
+	Actions []IrreversibleAction
+}
+
+func (e *IrreversibleError) Error() string {
+	var reasons []string
+	for _, a := range e.Actions {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", a.Section, a.Reason))
+	}
+	return fmt.Sprintf(
+		"cannot convert back across version %s, irreversible actions: %s",
+		e.VersionNum(), strings.Join(reasons, "; "),
+	)
+}
+
+// VersionNum returns the version that contains the irreversible actions.
+func (e *IrreversibleError) VersionNum() types.TelemetryVersion {
+	return e.Version.TelemetryVersion()
 }
 
 type ResourceActions []ResourceAction
@@ -41,10 +116,10 @@ type MetricActions struct {
 	Actions []MetricAction
 }
 
-func (acts MetricActions) Apply(metrics []*otlpmetric.Metric) ([]*otlpmetric.Metric, error) {
+func (acts MetricActions) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) ([]*otlpmetric.Metric, error) {
 	for _, a := range acts.Actions {
 		var err error
-		metrics, err = a.Apply(metrics)
+		metrics, err = a.Apply(metrics, changes)
 		if err != nil {
 			return metrics, err
 		}
@@ -85,6 +160,10 @@ type SpanAction interface {
 
 type SpanActions struct {
 	ForAllSpans []SpanAction
+
+	// SpanEvents are applied to each event of the span after ForAllSpans
+	// actions are applied to the span.
+	SpanEvents []SpanEventAction
 }
 
 func (acts SpanActions) Apply(span *otlptrace.Span, changes *ChangeLog) error {
@@ -93,67 +172,254 @@ func (acts SpanActions) Apply(span *otlptrace.Span, changes *ChangeLog) error {
 			return err
 		}
 	}
+	if len(acts.SpanEvents) == 0 {
+		return nil
+	}
+	for _, event := range span.Events {
+		for _, a := range acts.SpanEvents {
+			if err := a.Apply(span, event, changes); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
 type MetricAction interface {
-	Apply(metrics []*otlpmetric.Metric) ([]*otlpmetric.Metric, error)
+	Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) ([]*otlpmetric.Metric, error)
 }
 
-//type LogRecordAction interface {
-//	Apply(log pdata.LogRecord) error
-//}
+// ScopeMetricsAction is implemented by metric actions that need to see the
+// metrics of all scopes of a resource at once.
+type ScopeMetricsAction interface {
+	MetricAction
+	ApplyToScopes(resource *otlpresource.Resource, scopes []*otlpmetric.ScopeMetrics, changes *ChangeLog) error
+}
+
+func (acts MetricActions) applyToScopes(
+	resource *otlpresource.Resource, scopes []*otlpmetric.ScopeMetrics, changes *ChangeLog,
+) error {
+	for _, a := range acts.Actions {
+		if sa, ok := a.(ScopeMetricsAction); ok {
+			if err := sa.ApplyToScopes(resource, scopes, changes); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, scope := range scopes {
+			var err error
+			scope.Metrics, err = a.Apply(scope.Metrics, changes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
 func (afv ActionsForVersions) Len() int {
 	return len(afv)
 }
 
 func (afv ActionsForVersions) Less(i, j int) bool {
-	return afv[i].VersionNum < afv[j].VersionNum
+	return afv[i].VersionNum.Less(afv[j].VersionNum)
 }
 
 func (afv ActionsForVersions) Swap(i, j int) {
 	afv[i], afv[j] = afv[j], afv[i]
 }
 
-func (s *Schema) ConvertResourceToLatest(
-	fromVersion types.TelemetryVersion, resource *otlpresource.Resource, changes *ChangeLog,
-) error {
-	startIndex := sort.Search(
+// LatestVersion returns the highest version known to the schema or an empty
+// string if the schema has no versions.
+func (s *Schema) LatestVersion() types.TelemetryVersion {
+	if len(s.Versions) == 0 {
+		return ""
+	}
+	return s.Versions[len(s.Versions)-1].VersionNum.TelemetryVersion()
+}
+
+// HasVersion returns true if the version is one of the versions of the schema.
+func (s *Schema) HasVersion(version types.TelemetryVersion) bool {
+	v, err := version.Parse()
+	if err != nil {
+		return false
+	}
+	i := s.searchVersion(v)
+	return i > 0 && !s.Versions[i-1].VersionNum.Less(v)
+}
+
+// searchVersion returns the index of the first version in s.Versions that is
+// higher than v.
+func (s *Schema) searchVersion(v types.Version) int {
+	return sort.Search(
 		len(s.Versions), func(i int) bool {
-			// TODO: use proper semver comparison.
-			return s.Versions[i].VersionNum > fromVersion
+			return v.Less(s.Versions[i].VersionNum)
 		},
 	)
-	if startIndex > len(s.Versions) {
-		// Nothing to do
-		return nil
+}
+
+// startIndex returns the index of the first version in s.Versions that is
+// higher than fromVersion.
+func (s *Schema) startIndex(fromVersion types.TelemetryVersion) (int, error) {
+	from, err := fromVersion.Parse()
+	if err != nil {
+		return 0, fmt.Errorf("cannot convert from version: %w", err)
+	}
+	return s.searchVersion(from), nil
+}
+
+// versionRange returns the half-open interval [start, end) of indexes in
+// s.Versions that holds the versions in between fromVersion and toVersion. When
+// converting to a higher version the interval holds the (fromVersion, toVersion]
+// range, and reverse is false. When converting to a lower version the interval
+// holds the (toVersion, fromVersion] range, and reverse is true.
+func (s *Schema) versionRange(fromVersion, toVersion types.TelemetryVersion) (
+	start, end int, reverse bool, err error,
+) {
+	from, err := fromVersion.Parse()
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("cannot convert from version: %w", err)
+	}
+	to, err := toVersion.Parse()
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("cannot convert to version: %w", err)
+	}
+	if to.Less(from) {
+		return s.searchVersion(to), s.searchVersion(from), true, nil
+	}
+	return s.searchVersion(from), s.searchVersion(to), false, nil
+}
+
+// checkReversible returns an IrreversibleError if any of the versions in the
+// [start, end) interval has an irreversible action in one of the sections.
+func (s *Schema) checkReversible(start, end int, sections ...string) error {
+	for i := end - 1; i >= start; i-- {
+		var found []IrreversibleAction
+		for _, a := range s.Versions[i].Reverse.Irreversible {
+			for _, section := range sections {
+				if a.Section == section {
+					found = append(found, a)
+				}
+			}
+		}
+		if len(found) > 0 {
+			return &IrreversibleError{Version: s.Versions[i].VersionNum, Actions: found}
+		}
+	}
+	return nil
+}
+
+// checkMetricsReversible returns an IrreversibleError if the version at index
+// i has an irreversible action that applies to any of the metrics in the lists.
+// The metrics must be named as in that version.
+func (s *Schema) checkMetricsReversible(i int, lists ...[]*otlpmetric.Metric) error {
+	var found []IrreversibleAction
+	for _, a := range s.Versions[i].Reverse.Irreversible {
+		if a.Section != SectionAll && a.Section != SectionMetrics {
+			continue
+		}
+		if irreversibleForMetrics(a, lists) {
+			found = append(found, a)
+		}
+	}
+	if len(found) > 0 {
+		return &IrreversibleError{Version: s.Versions[i].VersionNum, Actions: found}
+	}
+	return nil
+}
+
+func irreversibleForMetrics(a IrreversibleAction, lists [][]*otlpmetric.Metric) bool {
+	for _, metrics := range lists {
+		for _, metric := range metrics {
+			if a.Metrics == nil || a.Metrics[types.MetricName(metric.Name)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Schema) ConvertResourceToLatest(
+	fromVersion types.TelemetryVersion, resource *otlpresource.Resource, changes *ChangeLog,
+) error {
+	startIndex, err := s.startIndex(fromVersion)
+	if err != nil {
+		return err
+	}
+	return s.convertResource(startIndex, len(s.Versions), resource, changes)
+}
+
+// ConvertResourceToVersion converts the resource from fromVersion to toVersion
+// by applying the actions of all versions in the (fromVersion, toVersion] range.
+// If toVersion is lower than fromVersion the inverse actions of all versions in
+// the (toVersion, fromVersion] range are applied in descending version order.
+func (s *Schema) ConvertResourceToVersion(
+	fromVersion, toVersion types.TelemetryVersion, resource *otlpresource.Resource, changes *ChangeLog,
+) error {
+	startIndex, endIndex, reverse, err := s.versionRange(fromVersion, toVersion)
+	if err != nil {
+		return err
+	}
+	if reverse {
+		return s.revertResource(startIndex, endIndex, resource, changes)
 	}
+	return s.convertResource(startIndex, endIndex, resource, changes)
+}
 
-	for i := startIndex; i < len(s.Versions); i++ {
+func (s *Schema) convertResource(
+	startIndex, endIndex int, resource *otlpresource.Resource, changes *ChangeLog,
+) error {
+	for i := startIndex; i < endIndex; i++ {
 		if err := s.Versions[i].Resource.Apply(resource, changes); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+func (s *Schema) revertResource(
+	startIndex, endIndex int, resource *otlpresource.Resource, changes *ChangeLog,
+) error {
+	if err := s.checkReversible(startIndex, endIndex, SectionAll, SectionResources); err != nil {
+		return err
+	}
+	for i := endIndex - 1; i >= startIndex; i-- {
+		if err := s.Versions[i].Reverse.Resource.Apply(resource, changes); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (s *Schema) ConvertSpansToLatest(
 	fromVersion types.TelemetryVersion, spans []*otlptrace.Span, changes *ChangeLog,
 ) error {
-	startIndex := sort.Search(
-		len(s.Versions), func(i int) bool {
-			// TODO: use proper semver comparison.
-			return s.Versions[i].VersionNum > fromVersion
-		},
-	)
-	if startIndex > len(s.Versions) {
-		// Nothing to do
-		return nil
+	startIndex, err := s.startIndex(fromVersion)
+	if err != nil {
+		return err
+	}
+	return s.convertSpans(startIndex, len(s.Versions), spans, changes)
+}
+
+// ConvertSpansToVersion converts the spans from fromVersion to toVersion.
+// See ConvertResourceToVersion for the order in which actions are applied.
+func (s *Schema) ConvertSpansToVersion(
+	fromVersion, toVersion types.TelemetryVersion, spans []*otlptrace.Span, changes *ChangeLog,
+) error {
+	startIndex, endIndex, reverse, err := s.versionRange(fromVersion, toVersion)
+	if err != nil {
+		return err
+	}
+	if reverse {
+		return s.revertSpans(startIndex, endIndex, spans, changes)
 	}
+	return s.convertSpans(startIndex, endIndex, spans, changes)
+}
 
-	for i := startIndex; i < len(s.Versions); i++ {
+func (s *Schema) convertSpans(
+	startIndex, endIndex int, spans []*otlptrace.Span, changes *ChangeLog,
+) error {
+	for i := startIndex; i < endIndex; i++ {
 		for j := 0; j < len(spans); j++ {
 			span := spans[j]
 			if err := s.Versions[i].Spans.Apply(span, changes); err != nil {
@@ -164,27 +430,192 @@ func (s *Schema) ConvertSpansToLatest(
 	return nil
 }
 
+func (s *Schema) revertSpans(
+	startIndex, endIndex int, spans []*otlptrace.Span, changes *ChangeLog,
+) error {
+	if len(spans) > 0 {
+		if err := s.checkReversible(startIndex, endIndex, SectionAll, SectionSpans, SectionSpanEvents); err != nil {
+			return err
+		}
+	}
+	for i := endIndex - 1; i >= startIndex; i-- {
+		for j := 0; j < len(spans); j++ {
+			if err := s.Versions[i].Reverse.Spans.Apply(spans[j], changes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (s *Schema) ConvertMetricsToLatest(
-	fromVersion types.TelemetryVersion, metrics *[]*otlpmetric.Metric,
+	fromVersion types.TelemetryVersion, metrics *[]*otlpmetric.Metric, changes *ChangeLog,
 ) error {
-	startIndex := sort.Search(
-		len(s.Versions), func(i int) bool {
-			// TODO: use proper semver comparison.
-			return s.Versions[i].VersionNum > fromVersion
-		},
-	)
-	if startIndex > len(s.Versions) {
-		// Nothing to do
-		return nil
+	startIndex, err := s.startIndex(fromVersion)
+	if err != nil {
+		return err
 	}
+	return s.convertMetrics(startIndex, len(s.Versions), metrics, changes)
+}
+
+// ConvertMetricsToVersion converts the metrics from fromVersion to toVersion.
+// See ConvertResourceToVersion for the order in which actions are applied.
+func (s *Schema) ConvertMetricsToVersion(
+	fromVersion, toVersion types.TelemetryVersion, metrics *[]*otlpmetric.Metric, changes *ChangeLog,
+) error {
+	startIndex, endIndex, reverse, err := s.versionRange(fromVersion, toVersion)
+	if err != nil {
+		return err
+	}
+	if reverse {
+		return s.revertMetrics(startIndex, endIndex, metrics, changes)
+	}
+	return s.convertMetrics(startIndex, endIndex, metrics, changes)
+}
+
+func (s *Schema) convertMetrics(
+	startIndex, endIndex int, metrics *[]*otlpmetric.Metric, changes *ChangeLog,
+) error {
+	if changes.Enabled && startIndex < endIndex {
+		changes.Append(&metricsSliceLog{metrics: metrics, savedMetrics: *metrics})
+	}
+	for i := startIndex; i < endIndex; i++ {
+		var err error
+		*metrics, err = s.Versions[i].Metrics.Apply(*metrics, changes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	for i := startIndex; i < len(s.Versions); i++ {
+func (s *Schema) revertMetrics(
+	startIndex, endIndex int, metrics *[]*otlpmetric.Metric, changes *ChangeLog,
+) error {
+	if changes.Enabled && startIndex < endIndex {
+		changes.Append(&metricsSliceLog{metrics: metrics, savedMetrics: *metrics})
+	}
+	for i := endIndex - 1; i >= startIndex; i-- {
+		if err := s.checkMetricsReversible(i, *metrics); err != nil {
+			return err
+		}
 		var err error
-		*metrics, err = s.Versions[i].Metrics.Apply(*metrics)
+		*metrics, err = s.Versions[i].Reverse.Metrics.Apply(*metrics, changes)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+func (s *Schema) ConvertLogsToLatest(
+	fromVersion types.TelemetryVersion, logs []*otlplogs.LogRecord, changes *ChangeLog,
+) error {
+	startIndex, err := s.startIndex(fromVersion)
+	if err != nil {
+		return err
+	}
+	return s.convertLogs(startIndex, len(s.Versions), logs, changes)
+}
+
+// ConvertLogsToVersion converts the log records from fromVersion to toVersion.
+// See ConvertResourceToVersion for the order in which actions are applied.
+func (s *Schema) ConvertLogsToVersion(
+	fromVersion, toVersion types.TelemetryVersion, logs []*otlplogs.LogRecord, changes *ChangeLog,
+) error {
+	startIndex, endIndex, reverse, err := s.versionRange(fromVersion, toVersion)
+	if err != nil {
+		return err
+	}
+	if reverse {
+		return s.revertLogs(startIndex, endIndex, logs, changes)
+	}
+	return s.convertLogs(startIndex, endIndex, logs, changes)
+}
+
+func (s *Schema) convertLogs(
+	startIndex, endIndex int, logs []*otlplogs.LogRecord, changes *ChangeLog,
+) error {
+	for i := startIndex; i < endIndex; i++ {
+		for j := 0; j < len(logs); j++ {
+			if err := s.Versions[i].Logs.Apply(logs[j], changes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) revertLogs(
+	startIndex, endIndex int, logs []*otlplogs.LogRecord, changes *ChangeLog,
+) error {
+	if len(logs) > 0 {
+		if err := s.checkReversible(startIndex, endIndex, SectionAll, SectionLogs); err != nil {
+			return err
+		}
+	}
+	for i := endIndex - 1; i >= startIndex; i-- {
+		for j := 0; j < len(logs); j++ {
+			if err := s.Versions[i].Reverse.Logs.Apply(logs[j], changes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// metricsSliceLog restores the list of metrics that was replaced by actions
+// that add or remove metrics. Such actions never modify the input slice.
+type metricsSliceLog struct {
+	metrics      *[]*otlpmetric.Metric
+	savedMetrics []*otlpmetric.Metric
+}
+
+func (r *metricsSliceLog) Rollback() {
+	*r.metrics = r.savedMetrics
+}
+
+// ConvertScopeMetricsToVersion converts the metrics of all scopes of a resource
+// from fromVersion to toVersion. Unlike ConvertMetricsToVersion it allows actions
+// such as merge to combine metrics that are in different ScopeMetrics of the
+// same instrumentation scope, and to_delta to tell apart the time series of
+// different resources.
+// See ConvertResourceToVersion for the order in which actions are applied.
+func (s *Schema) ConvertScopeMetricsToVersion(
+	fromVersion, toVersion types.TelemetryVersion, resource *otlpresource.Resource,
+	scopes []*otlpmetric.ScopeMetrics, changes *ChangeLog,
+) error {
+	startIndex, endIndex, reverse, err := s.versionRange(fromVersion, toVersion)
+	if err != nil {
+		return err
+	}
+
+	if changes.Enabled && startIndex < endIndex {
+		for _, scope := range scopes {
+			changes.Append(&metricsSliceLog{metrics: &scope.Metrics, savedMetrics: scope.Metrics})
+		}
+	}
 
+	if reverse {
+		for i := endIndex - 1; i >= startIndex; i-- {
+			lists := make([][]*otlpmetric.Metric, len(scopes))
+			for j, scope := range scopes {
+				lists[j] = scope.Metrics
+			}
+			if err := s.checkMetricsReversible(i, lists...); err != nil {
+				return err
+			}
+			if err := s.Versions[i].Reverse.Metrics.applyToScopes(resource, scopes, changes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := startIndex; i < endIndex; i++ {
+		if err := s.Versions[i].Metrics.applyToScopes(resource, scopes, changes); err != nil {
+			return err
+		}
+	}
 	return nil
 }
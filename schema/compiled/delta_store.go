@@ -0,0 +1,175 @@
+package compiled
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDeltaStoreMaxSeries is the default maximum number of time series
+	// that a DeltaStore keeps.
+	DefaultDeltaStoreMaxSeries = 100000
+
+	// DefaultDeltaStoreTTL is the default time after which a time series that
+	// received no data points is removed from a DeltaStore.
+	DefaultDeltaStoreTTL = 10 * time.Minute
+)
+
+// DeltaStore keeps the last cumulative value of each time series that is
+// converted to delta temporality. The number of kept time series is bounded.
+// When the limit is reached the least recently updated time series is evicted.
+// Time series that are not updated for longer than the TTL are evicted too.
+// DeltaStore is safe for concurrent use.
+type DeltaStore struct {
+	mutex     sync.Mutex
+	maxSeries int
+	ttl       time.Duration
+	now       func() time.Time
+
+	// Time series by key. Elements of lru are *deltaSeries.
+	series map[string]*list.Element
+
+	// Time series ordered by the time of last update, the most recently updated
+	// in the front.
+	lru *list.List
+}
+
+// deltaSeries is the state of one time series.
+type deltaSeries struct {
+	key      string
+	lastSeen time.Time
+
+	// Start and end timestamps of the last cumulative data point.
+	startTime uint64
+	time      uint64
+
+	// The last cumulative value. Only the fields that correspond to the data
+	// point type are set.
+	isInt        bool
+	intValue     int64
+	doubleValue  float64
+	count        uint64
+	sum          *float64
+	bucketCounts []uint64
+	bounds       []float64
+}
+
+// NewDeltaStore creates a DeltaStore that keeps at most maxSeries time series
+// and evicts the time series that are not updated for longer than ttl.
+// Zero or negative maxSeries or ttl disable the corresponding limit.
+func NewDeltaStore(maxSeries int, ttl time.Duration) *DeltaStore {
+	return &DeltaStore{
+		maxSeries: maxSeries,
+		ttl:       ttl,
+		now:       time.Now,
+		series:    map[string]*list.Element{},
+		lru:       list.New(),
+	}
+}
+
+// SetLimits changes the limits of the store. Time series that exceed the new
+// limits are evicted.
+func (s *DeltaStore) SetLimits(maxSeries int, ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.maxSeries = maxSeries
+	s.ttl = ttl
+	s.evict()
+}
+
+// Len returns the number of time series in the store.
+func (s *DeltaStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.evict()
+	return s.lru.Len()
+}
+
+// update replaces the state of the time series with the state returned by f,
+// atomically. f is called with a copy of the current state, nil if the store
+// does not have the time series, and returns nil to keep the current state.
+// Returns the state f was called with and whether it was replaced.
+func (s *DeltaStore) update(key string, f func(prev *deltaSeries) *deltaSeries) (*deltaSeries, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.evict()
+	var prev *deltaSeries
+	if elem, exists := s.series[key]; exists {
+		series := *elem.Value.(*deltaSeries)
+		prev = &series
+	}
+
+	state := f(prev)
+	if state == nil {
+		return prev, false
+	}
+	s.set(key, state)
+	return prev, true
+}
+
+// put stores the state of the time series and marks it as the most recently
+// updated. A nil state removes the time series.
+func (s *DeltaStore) put(key string, state *deltaSeries) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.set(key, state)
+}
+
+// set is put that must be called with mutex held.
+func (s *DeltaStore) set(key string, state *deltaSeries) {
+	if elem, exists := s.series[key]; exists {
+		s.lru.Remove(elem)
+		delete(s.series, key)
+	}
+
+	if state != nil {
+		series := *state
+		series.key = key
+		series.lastSeen = s.now()
+		s.series[key] = s.lru.PushFront(&series)
+	}
+
+	s.evict()
+}
+
+// evict removes the expired time series and the least recently updated
+// time series that exceed the limit. Must be called with mutex held.
+func (s *DeltaStore) evict() {
+	if s.ttl > 0 {
+		expireBefore := s.now().Add(-s.ttl)
+		for elem := s.lru.Back(); elem != nil; elem = s.lru.Back() {
+			series := elem.Value.(*deltaSeries)
+			if !series.lastSeen.Before(expireBefore) {
+				break
+			}
+			s.removeElement(elem)
+		}
+	}
+
+	if s.maxSeries > 0 {
+		for s.lru.Len() > s.maxSeries {
+			s.removeElement(s.lru.Back())
+		}
+	}
+}
+
+func (s *DeltaStore) removeElement(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.series, elem.Value.(*deltaSeries).key)
+}
+
+// deltaStoreLog restores the state of the time series that was changed.
+type deltaStoreLog struct {
+	store      *DeltaStore
+	key        string
+	savedState *deltaSeries
+}
+
+func (r *deltaStoreLog) Rollback() {
+	r.store.put(r.key, r.savedState)
+}
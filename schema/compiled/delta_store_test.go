@@ -0,0 +1,64 @@
+package compiled
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaStoreLimits(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewDeltaStore(3, time.Minute)
+	store.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		store.put(strconv.Itoa(i), &deltaSeries{intValue: int64(i)})
+	}
+	assert.Equal(t, 3, store.Len())
+
+	// Updating "0" makes "1" the least recently updated series.
+	store.put("0", &deltaSeries{intValue: 10})
+	store.put("3", &deltaSeries{intValue: 3})
+	assert.Equal(t, 3, store.Len())
+	assert.Nil(t, seriesState(store, "1"))
+	assert.EqualValues(t, 10, seriesState(store, "0").intValue)
+
+	now = now.Add(30 * time.Second)
+	store.put("4", &deltaSeries{intValue: 4})
+
+	// All but "4" are expired.
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, 1, store.Len())
+	assert.NotNil(t, seriesState(store, "4"))
+
+	store.put("4", nil)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestDeltaStoreSetLimits(t *testing.T) {
+	store := NewDeltaStore(0, 0)
+	for i := 0; i < 10; i++ {
+		store.put(strconv.Itoa(i), &deltaSeries{})
+	}
+	assert.Equal(t, 10, store.Len())
+
+	store.SetLimits(4, 0)
+	assert.Equal(t, 4, store.Len())
+	assert.NotNil(t, seriesState(store, "9"))
+	assert.Nil(t, seriesState(store, "5"))
+}
+
+// seriesState returns the state of the time series or nil if the store does not
+// have the time series.
+func seriesState(store *DeltaStore, key string) *deltaSeries {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	elem, exists := store.series[key]
+	if !exists {
+		return nil
+	}
+	return elem.Value.(*deltaSeries)
+}
@@ -0,0 +1,91 @@
+package compiled
+
+import (
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// LogNameAttribute is the attribute that holds the name of a log record. OTLP
+// LogRecord has no dedicated field for the name.
+const LogNameAttribute = "event.name"
+
+type LogAction interface {
+	Apply(log *otlplogs.LogRecord, changes *ChangeLog) error
+}
+
+type LogActions []LogAction
+
+func (acts LogActions) Apply(log *otlplogs.LogRecord, changes *ChangeLog) error {
+	for _, a := range acts {
+		if err := a.Apply(log, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logName returns the name of the log record and the attribute that holds it.
+// Returns nil attribute if the log record has no name.
+func logName(log *otlplogs.LogRecord) (types.LogName, *otlpcommon.KeyValue) {
+	for _, attr := range log.Attributes {
+		if attr.Key == LogNameAttribute {
+			if sv, ok := attr.Value.GetValue().(*otlpcommon.AnyValue_StringValue); ok {
+				return types.LogName(sv.StringValue), attr
+			}
+			return "", nil
+		}
+	}
+	return "", nil
+}
+
+type LogRenameAction map[types.LogName]types.LogName
+
+func (act LogRenameAction) Apply(log *otlplogs.LogRecord, changes *ChangeLog) error {
+	name, attr := logName(log)
+	if attr == nil {
+		return nil
+	}
+	newName, exists := act[name]
+	if !exists {
+		return nil
+	}
+
+	if changes.Enabled {
+		changes.Append(&attrValueModifyLog{attr: attr, savedVal: attr.Value})
+	}
+	attr.Value = &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: string(newName)}}
+	return nil
+}
+
+type LogAttributeRenameAction struct {
+	AttributesRenameAction
+
+	// ApplyOnlyToLogs limits which logs this action should apply to. If empty then
+	// there is no limitation.
+	ApplyOnlyToLogs map[types.LogName]bool
+}
+
+func (act LogAttributeRenameAction) Apply(log *otlplogs.LogRecord, changes *ChangeLog) error {
+	if len(act.ApplyOnlyToLogs) > 0 {
+		name, attr := logName(log)
+		if attr == nil {
+			return nil
+		}
+		if _, exists := act.ApplyOnlyToLogs[name]; !exists {
+			return nil
+		}
+	}
+
+	return act.AttributesRenameAction.Apply(log.Attributes, changes)
+}
+
+type attrValueModifyLog struct {
+	attr     *otlpcommon.KeyValue
+	savedVal *otlpcommon.AnyValue
+}
+
+func (r *attrValueModifyLog) Rollback() {
+	r.attr.Value = r.savedVal
+}
@@ -1,23 +1,41 @@
 package compiled
 
 import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
 	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
 
 	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
 type MetricRenameAction map[types.MetricName]types.MetricName
 
-func (act MetricRenameAction) Apply(metrics []*otlpmetric.Metric) ([]*otlpmetric.Metric, error) {
+func (act MetricRenameAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) ([]*otlpmetric.Metric, error) {
 	for _, metric := range metrics {
 		newName, exists := act[types.MetricName(metric.Name)]
 		if exists {
+			if changes.Enabled {
+				changes.Append(&metricNameModifyLog{metric: metric, savedName: metric.Name})
+			}
 			metric.Name = string(newName)
 		}
 	}
 	return metrics, nil
 }
 
+type metricNameModifyLog struct {
+	metric    *otlpmetric.Metric
+	savedName string
+}
+
+func (r *metricNameModifyLog) Rollback() {
+	r.metric.Name = r.savedName
+}
+
 type MetricLabelRenameAction struct {
 	// ApplyOnlyToMetrics limits which metrics this action should apply to. If empty then
 	// there is no limitation.
@@ -25,118 +43,535 @@ type MetricLabelRenameAction struct {
 	LabelMap           map[string]string
 }
 
-func (act MetricLabelRenameAction) Apply(metrics []*otlpmetric.Metric) (
+func (act MetricLabelRenameAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) (
 	[]*otlpmetric.Metric, error,
 ) {
-	var retErr error
-	/*	for _, metric := range metrics {
-
+	renameAction := AttributesRenameAction(act.LabelMap)
+	for _, metric := range metrics {
 		if len(act.ApplyOnlyToMetrics) > 0 {
 			if _, exists := act.ApplyOnlyToMetrics[types.MetricName(metric.Name)]; !exists {
 				continue
 			}
 		}
 
-		dt := metric.MetricDescriptor.Type
-		switch dt {
-		case otlpmetric.MetricDescriptor_INT64:
-			dps := metric.Int64DataPoints
-			for i := 0; i < len(dps); i++ {
-				dp := dps[i]
-				err := renameLabels(dp.Labels, act.LabelMap)
-				if err != nil {
-					retErr = err
-				}
-			}
+		err := forEachDataPointAttributes(
+			metric, true, func(attrs *[]*otlpcommon.KeyValue) error {
+				return renameAction.Apply(*attrs, changes)
+			},
+		)
+		if err != nil {
+			return metrics, fmt.Errorf("metric %s: %w", metric.Name, err)
 		}
+	}
 
-	}*/
+	return metrics, nil
+}
+
+// forEachDataPointAttributes calls f for the attributes of every data point of
+// the metric. If withExemplars is true f is also called for the filtered
+// attributes of every exemplar of the data points. Stops and returns the error
+// if f returns an error.
+func forEachDataPointAttributes(
+	metric *otlpmetric.Metric, withExemplars bool, f func(attrs *[]*otlpcommon.KeyValue) error,
+) error {
+	forExemplars := func(exemplars []*otlpmetric.Exemplar) error {
+		if !withExemplars {
+			return nil
+		}
+		for _, exemplar := range exemplars {
+			if err := f(&exemplar.FilteredAttributes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-	return metrics, retErr
+	switch data := metric.Data.(type) {
+	case *otlpmetric.Metric_Gauge:
+		return forNumberDataPoints(data.Gauge.DataPoints, f, forExemplars)
+	case *otlpmetric.Metric_Sum:
+		return forNumberDataPoints(data.Sum.DataPoints, f, forExemplars)
+	case *otlpmetric.Metric_Histogram:
+		for _, dp := range data.Histogram.DataPoints {
+			if err := f(&dp.Attributes); err != nil {
+				return err
+			}
+			if err := forExemplars(dp.Exemplars); err != nil {
+				return err
+			}
+		}
+	case *otlpmetric.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.DataPoints {
+			if err := f(&dp.Attributes); err != nil {
+				return err
+			}
+			if err := forExemplars(dp.Exemplars); err != nil {
+				return err
+			}
+		}
+	case *otlpmetric.Metric_Summary:
+		for _, dp := range data.Summary.DataPoints {
+			if err := f(&dp.Attributes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-/*
-func renameLabels(labels []*otlpcommon.StringKeyValue, renameRules map[string]string) error {
-	var err error
-	newLabels := newFastMapStr(len(labels))
-	converted := false
-	for _, label := range labels {
-		k := label.Key
-		if convertTo, exists := renameRules[string(k)]; exists {
-			k = string(convertTo)
-			converted = true
+func forNumberDataPoints(
+	dps []*otlpmetric.NumberDataPoint,
+	f func(attrs *[]*otlpcommon.KeyValue) error,
+	forExemplars func(exemplars []*otlpmetric.Exemplar) error,
+) error {
+	for _, dp := range dps {
+		if err := f(&dp.Attributes); err != nil {
+			return err
 		}
-		if exists := newLabels.exists(k); exists {
-			err = fmt.Errorf("label %s conflicts", k)
+		if err := forExemplars(dp.Exemplars); err != nil {
+			return err
 		}
-		newLabels.set(k, label.Value)
 	}
-	if converted {
-		newLabels.copyTo(labels)
+	return nil
+}
+
+// MetricAddAttributesAction adds attributes with constant values to every data
+// point of the metrics. It is a conflict if a data point already has one of the
+// attributes with a different value.
+type MetricAddAttributesAction struct {
+	// ApplyOnlyToMetrics limits which metrics this action should apply to. If empty then
+	// there is no limitation.
+	ApplyOnlyToMetrics map[types.MetricName]bool
+	Attributes         map[string]*otlpcommon.AnyValue
+}
+
+func (act MetricAddAttributesAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) (
+	[]*otlpmetric.Metric, error,
+) {
+	keys := sortedKeys(act.Attributes)
+	for _, metric := range metrics {
+		if !appliesToMetric(act.ApplyOnlyToMetrics, metric) {
+			continue
+		}
+
+		err := forEachDataPointAttributes(
+			metric, false, func(attrs *[]*otlpcommon.KeyValue) error {
+				var newAttrs []*otlpcommon.KeyValue
+				for _, key := range keys {
+					value := act.Attributes[key]
+					added, err := checkAddAttribute(*attrs, key, value)
+					if err != nil {
+						return err
+					}
+					if added {
+						newAttrs = append(
+							newAttrs, &otlpcommon.KeyValue{Key: key, Value: proto.Clone(value).(*otlpcommon.AnyValue)},
+						)
+					}
+				}
+				appendAttributes(attrs, newAttrs, changes)
+				return nil
+			},
+		)
+		if err != nil {
+			return metrics, fmt.Errorf("metric %s: %w", metric.Name, err)
+		}
 	}
-	return err
+	return metrics, nil
 }
-*/
 
-type MetricSplitAction struct {
+// MetricDuplicateAttributesAction copies the values of existing attributes to
+// new attributes on every data point of the metrics. AttributeMap maps the names
+// of existing attributes to the names of new attributes. Data points that do not
+// have an existing attribute are not changed. It is a conflict if a data point
+// already has a new attribute with a different value.
+type MetricDuplicateAttributesAction struct {
 	// ApplyOnlyToMetrics limits which metrics this action should apply to. If empty then
 	// there is no limitation.
-	MetricName    types.MetricName
+	ApplyOnlyToMetrics map[types.MetricName]bool
+	AttributeMap       map[string]string
+}
+
+func (act MetricDuplicateAttributesAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) (
+	[]*otlpmetric.Metric, error,
+) {
+	for _, metric := range metrics {
+		if !appliesToMetric(act.ApplyOnlyToMetrics, metric) {
+			continue
+		}
+
+		err := forEachDataPointAttributes(
+			metric, false, func(attrs *[]*otlpcommon.KeyValue) error {
+				var newAttrs []*otlpcommon.KeyValue
+				for _, attr := range *attrs {
+					newKey, exists := act.AttributeMap[attr.Key]
+					if !exists {
+						continue
+					}
+					added, err := checkAddAttribute(*attrs, newKey, attr.Value)
+					if err != nil {
+						return err
+					}
+					for _, newAttr := range newAttrs {
+						if newAttr.Key == newKey {
+							return fmt.Errorf("attribute %s conflicts", newKey)
+						}
+					}
+					if added {
+						newAttrs = append(
+							newAttrs,
+							&otlpcommon.KeyValue{Key: newKey, Value: proto.Clone(attr.Value).(*otlpcommon.AnyValue)},
+						)
+					}
+				}
+				appendAttributes(attrs, newAttrs, changes)
+				return nil
+			},
+		)
+		if err != nil {
+			return metrics, fmt.Errorf("metric %s: %w", metric.Name, err)
+		}
+	}
+	return metrics, nil
+}
+
+func appliesToMetric(applyOnlyToMetrics map[types.MetricName]bool, metric *otlpmetric.Metric) bool {
+	return len(applyOnlyToMetrics) == 0 || applyOnlyToMetrics[types.MetricName(metric.Name)]
+}
+
+// checkAddAttribute checks if the attribute can be added to attrs. Returns false
+// if attrs already have the attribute with the same value and an error if attrs
+// have the attribute with a different value.
+func checkAddAttribute(attrs []*otlpcommon.KeyValue, key string, value *otlpcommon.AnyValue) (bool, error) {
+	for _, attr := range attrs {
+		if attr.Key != key {
+			continue
+		}
+		if proto.Equal(attr.Value, value) {
+			return false, nil
+		}
+		return false, fmt.Errorf("attribute %s conflicts", key)
+	}
+	return true, nil
+}
+
+// appendAttributes appends newAttrs to attrs. The attrs slice is replaced, so
+// the change can be rolled back.
+func appendAttributes(attrs *[]*otlpcommon.KeyValue, newAttrs []*otlpcommon.KeyValue, changes *ChangeLog) {
+	if len(newAttrs) == 0 {
+		return
+	}
+	if changes.Enabled {
+		changes.Append(&attrsSliceLog{attrs: attrs, savedAttrs: *attrs})
+	}
+	result := make([]*otlpcommon.KeyValue, 0, len(*attrs)+len(newAttrs))
+	result = append(result, *attrs...)
+	*attrs = append(result, newAttrs...)
+}
+
+type attrsSliceLog struct {
+	attrs      *[]*otlpcommon.KeyValue
+	savedAttrs []*otlpcommon.KeyValue
+}
+
+func (r *attrsSliceLog) Rollback() {
+	*r.attrs = r.savedAttrs
+}
+
+func sortedKeys(m map[string]*otlpcommon.AnyValue) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricSplitAction splits a metric into several metrics by the value of an
+// attribute. The attribute is removed from the data points of the new metrics.
+// Data points that do not have the attribute or that have a value that is not
+// listed in SplitMap are kept unchanged in a metric with the original name.
+type MetricSplitAction struct {
+	// MetricName is the name of the metric to split.
+	MetricName types.MetricName
+	// AttributeName is the name of the attribute to split by.
 	AttributeName types.AttributeName
-	SplitMap      map[types.AttributeValue]types.MetricName
+	// SplitMap maps the string form of attribute values to the names of the
+	// new metrics.
+	SplitMap map[string]types.MetricName
 }
 
-func (act MetricSplitAction) Apply(metrics []*otlpmetric.Metric) ([]*otlpmetric.Metric, error) {
-	/*
-		for i := 0; i < len(metrics); i++ {
-			metric := metrics[i]
-			if act.MetricName != types.MetricName(metric.Name) {
+func (act MetricSplitAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) ([]*otlpmetric.Metric, error) {
+	// The input slice is not modified, a new slice is built if there is
+	// anything to split.
+	var result []*otlpmetric.Metric
+	for i, metric := range metrics {
+		if types.MetricName(metric.Name) != act.MetricName {
+			if result != nil {
+				result = append(result, metric)
+			}
+			continue
+		}
+
+		if result == nil {
+			result = make([]*otlpmetric.Metric, i, len(metrics)+len(act.SplitMap))
+			copy(result, metrics[:i])
+		}
+		result = append(result, act.splitMetric(metric)...)
+	}
+
+	if result == nil {
+		return metrics, nil
+	}
+	return result, nil
+}
+
+func (act MetricSplitAction) splitMetric(metric *otlpmetric.Metric) []*otlpmetric.Metric {
+	var outputMetrics []*otlpmetric.Metric
+	metricByName := map[string]*otlpmetric.Metric{}
+
+	outputMetric := func(name string) *otlpmetric.Metric {
+		output, exists := metricByName[name]
+		if !exists {
+			output = newMetricLike(metric, name)
+			metricByName[name] = output
+			outputMetrics = append(outputMetrics, output)
+		}
+		return output
+	}
+
+	for _, dp := range metricDataPoints(metric) {
+		newMetricName, attrIndex := act.splitTarget(dp.GetAttributes())
+		if attrIndex < 0 {
+			// Unmatched data point, keep it unchanged.
+			appendDataPoint(outputMetric(metric.Name), dp)
+			continue
+		}
+
+		outputDp := cloneDataPoint(dp)
+		attrs := outputDp.GetAttributes()
+		newAttrs := make([]*otlpcommon.KeyValue, 0, len(attrs)-1)
+		newAttrs = append(newAttrs, attrs[:attrIndex]...)
+		newAttrs = append(newAttrs, attrs[attrIndex+1:]...)
+		setDataPointAttributes(outputDp, newAttrs)
+
+		appendDataPoint(outputMetric(string(newMetricName)), outputDp)
+	}
+
+	if len(outputMetrics) == 0 {
+		// No data points or no data, keep the metric.
+		return []*otlpmetric.Metric{metric}
+	}
+	return outputMetrics
+}
+
+// splitTarget returns the name of the metric the data point with the specified
+// attributes should be moved to and the index of the split attribute. Returns
+// -1 index if the data point does not match any split rule.
+func (act MetricSplitAction) splitTarget(attrs []*otlpcommon.KeyValue) (types.MetricName, int) {
+	for i, attr := range attrs {
+		if attr.Key != string(act.AttributeName) {
+			continue
+		}
+		value, ok := attributeValueString(attr.Value)
+		if !ok {
+			return "", -1
+		}
+		newMetricName, exists := act.SplitMap[value]
+		if !exists {
+			return "", -1
+		}
+		return newMetricName, i
+	}
+	return "", -1
+}
+
+// MetricMergeAction merges several metrics into one new metric. An attribute
+// is added to the data points of the new metric to tell apart the data points
+// that came from different source metrics. The source metrics must have the
+// same data type, unit, aggregation temporality and monotonicity.
+type MetricMergeAction struct {
+	// CreateMetric is the name of the new metric.
+	CreateMetric types.MetricName
+	// AttributeName is the name of the attribute to add.
+	AttributeName types.AttributeName
+	// AttributeValues maps the names of source metrics to the value of the
+	// attribute to add to the data points of that source metric.
+	AttributeValues map[types.MetricName]*otlpcommon.AnyValue
+}
+
+func (act MetricMergeAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) ([]*otlpmetric.Metric, error) {
+	err := act.merge([]*[]*otlpmetric.Metric{&metrics})
+	return metrics, err
+}
+
+// ApplyToScopes merges the source metrics found in all scopes that have the
+// same instrumentation scope. The new metric is placed where the first source
+// metric was found. Source metrics of different instrumentation scopes are not
+// merged with each other, since the data points of a metric can only have one
+// scope. Each scope gets its own new metric instead.
+func (act MetricMergeAction) ApplyToScopes(
+	_ *otlpresource.Resource, scopes []*otlpmetric.ScopeMetrics, changes *ChangeLog,
+) error {
+	var groupKeys []string
+	groups := map[string][]*[]*otlpmetric.Metric{}
+	for _, scope := range scopes {
+		key := scopeKey(scope)
+		if _, exists := groups[key]; !exists {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], &scope.Metrics)
+
+		if changes.Enabled {
+			changes.Append(&metricsSliceLog{metrics: &scope.Metrics, savedMetrics: scope.Metrics})
+		}
+	}
+
+	for _, key := range groupKeys {
+		if err := act.merge(groups[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeKey returns a string that identifies the instrumentation scope of the
+// scope metrics.
+func scopeKey(scope *otlpmetric.ScopeMetrics) string {
+	return joinKey(scope.GetScope().GetName(), scope.GetScope().GetVersion(), scope.SchemaUrl)
+}
+
+type mergeSource struct {
+	listIndex int
+	metric    *otlpmetric.Metric
+}
+
+// merge merges the source metrics found in the lists. The lists are replaced
+// by new lists, the input lists are not modified.
+func (act MetricMergeAction) merge(lists []*[]*otlpmetric.Metric) error {
+	var sources []mergeSource
+	firstListIndex, firstMetricIndex := -1, -1
+	createExists := false
+	for i, list := range lists {
+		for j, metric := range *list {
+			if types.MetricName(metric.Name) == act.CreateMetric {
+				createExists = true
+			}
+			if _, exists := act.AttributeValues[types.MetricName(metric.Name)]; !exists {
 				continue
 			}
+			if firstListIndex < 0 {
+				firstListIndex, firstMetricIndex = i, j
+			}
+			sources = append(sources, mergeSource{listIndex: i, metric: metric})
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	if createExists {
+		return fmt.Errorf("metric %s already exists, cannot merge into it", act.CreateMetric)
+	}
+
+	first := sources[0].metric
+	for _, source := range sources[1:] {
+		if err := checkMergeCompatible(first, source.metric); err != nil {
+			return fmt.Errorf("cannot merge into metric %s: %w", act.CreateMetric, err)
+		}
+	}
 
-			var outputMetrics []*otlpmetric.Metric
-			dt := metric.MetricDescriptor.Type
-			switch dt {
-			case otlpmetric.MetricDescriptor_INT64:
-				dps := metric.Int64DataPoints
-				for j := 0; j < len(dps); j++ {
-					dp := dps[j]
-					outputMetric := splitMetric(act.AttributeName, act.SplitMap, metric, dp)
-					outputMetrics = append(outputMetrics, outputMetric)
+	merged := newMetricLike(first, string(act.CreateMetric))
+	for _, source := range sources {
+		if source.metric.Description != first.Description {
+			merged.Description = ""
+		}
+
+		value := act.AttributeValues[types.MetricName(source.metric.Name)]
+		for _, dp := range metricDataPoints(source.metric) {
+			for _, attr := range dp.GetAttributes() {
+				if attr.Key == string(act.AttributeName) {
+					return fmt.Errorf(
+						"metric %s: attribute %s conflicts, cannot merge into metric %s",
+						source.metric.Name, attr.Key, act.CreateMetric,
+					)
 				}
 			}
 
-			metrics = append(append(metrics[0:i], outputMetrics...), metrics[i+1:]...)
+			outputDp := cloneDataPoint(dp)
+			setDataPointAttributes(
+				outputDp, append(
+					outputDp.GetAttributes(),
+					&otlpcommon.KeyValue{
+						Key: string(act.AttributeName), Value: proto.Clone(value).(*otlpcommon.AnyValue),
+					},
+				),
+			)
+			appendDataPoint(merged, outputDp)
 		}
-	*/
-	return metrics, nil
-}
+	}
 
-/*
-func splitMetric(
-	splitByAttr types.AttributeName,
-	splitRules map[types.AttributeValue]types.MetricName,
-	input *otlpmetric.Metric,
-	inputDp *otlpmetric.Int64DataPoint,
-) *otlpmetric.Metric {
-	output := &otlpmetric.Metric{}
-	descr := *input.MetricDescriptor
-	output.MetricDescriptor = &descr
-
-	outputDp := *inputDp
-	outputDp.Labels = nil
-
-	for _, label := range inputDp.Labels {
-		if label.Key == string(splitByAttr) {
-			if convertTo, exists := splitRules[types.AttributeValue(label.Value)]; exists {
-				newMetricName := string(convertTo)
-				output.MetricDescriptor.Name = newMetricName
+	for i, list := range lists {
+		var result []*otlpmetric.Metric
+		for j, metric := range *list {
+			if i == firstListIndex && j == firstMetricIndex {
+				result = append(result, merged)
+				continue
 			}
-			continue
+			if _, exists := act.AttributeValues[types.MetricName(metric.Name)]; exists {
+				continue
+			}
+			result = append(result, metric)
 		}
-		outputDp.Labels = append(outputDp.Labels, label)
+		*list = result
+	}
+
+	return nil
+}
+
+func checkMergeCompatible(m1, m2 *otlpmetric.Metric) error {
+	t1, t2 := metricDataType(m1), metricDataType(m2)
+	if t1 != t2 {
+		return fmt.Errorf("metric %s is %s but metric %s is %s", m1.Name, t1, m2.Name, t2)
+	}
+	if m1.Unit != m2.Unit {
+		return fmt.Errorf("metric %s has unit %q but metric %s has unit %q", m1.Name, m1.Unit, m2.Name, m2.Unit)
+	}
+	temp1, temp2 := metricTemporality(m1), metricTemporality(m2)
+	if temp1 != temp2 {
+		return fmt.Errorf(
+			"metric %s has %s temporality but metric %s has %s temporality", m1.Name, temp1, m2.Name, temp2,
+		)
+	}
+	if m1.GetSum().GetIsMonotonic() != m2.GetSum().GetIsMonotonic() {
+		return fmt.Errorf("metrics %s and %s differ in monotonicity", m1.Name, m2.Name)
+	}
+	return nil
+}
+
+func metricDataType(metric *otlpmetric.Metric) string {
+	switch metric.Data.(type) {
+	case *otlpmetric.Metric_Gauge:
+		return "gauge"
+	case *otlpmetric.Metric_Sum:
+		return "sum"
+	case *otlpmetric.Metric_Histogram:
+		return "histogram"
+	case *otlpmetric.Metric_ExponentialHistogram:
+		return "exponential histogram"
+	case *otlpmetric.Metric_Summary:
+		return "summary"
+	}
+	return "empty"
+}
+
+func metricTemporality(metric *otlpmetric.Metric) otlpmetric.AggregationTemporality {
+	switch data := metric.Data.(type) {
+	case *otlpmetric.Metric_Sum:
+		return data.Sum.AggregationTemporality
+	case *otlpmetric.Metric_Histogram:
+		return data.Histogram.AggregationTemporality
+	case *otlpmetric.Metric_ExponentialHistogram:
+		return data.ExponentialHistogram.AggregationTemporality
 	}
-	output.Int64DataPoints = []*otlpmetric.Int64DataPoint{&outputDp}
-	return output
+	return otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
 }
-*/
@@ -0,0 +1,137 @@
+package compiled
+
+import (
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// dataPoint is implemented by all OTLP data point types.
+type dataPoint interface {
+	proto.Message
+	GetAttributes() []*otlpcommon.KeyValue
+}
+
+// metricDataPoints returns the data points of the metric, regardless of the
+// metric data type.
+func metricDataPoints(metric *otlpmetric.Metric) []dataPoint {
+	var dps []dataPoint
+	switch data := metric.Data.(type) {
+	case *otlpmetric.Metric_Gauge:
+		for _, dp := range data.Gauge.DataPoints {
+			dps = append(dps, dp)
+		}
+	case *otlpmetric.Metric_Sum:
+		for _, dp := range data.Sum.DataPoints {
+			dps = append(dps, dp)
+		}
+	case *otlpmetric.Metric_Histogram:
+		for _, dp := range data.Histogram.DataPoints {
+			dps = append(dps, dp)
+		}
+	case *otlpmetric.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.DataPoints {
+			dps = append(dps, dp)
+		}
+	case *otlpmetric.Metric_Summary:
+		for _, dp := range data.Summary.DataPoints {
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
+
+// newMetricLike returns a new metric with the specified name and the same
+// description, unit, data type, temporality and monotonicity as metric. The
+// returned metric has no data points.
+func newMetricLike(metric *otlpmetric.Metric, name string) *otlpmetric.Metric {
+	result := &otlpmetric.Metric{
+		Name:        name,
+		Description: metric.Description,
+		Unit:        metric.Unit,
+	}
+
+	switch data := metric.Data.(type) {
+	case *otlpmetric.Metric_Gauge:
+		result.Data = &otlpmetric.Metric_Gauge{Gauge: &otlpmetric.Gauge{}}
+	case *otlpmetric.Metric_Sum:
+		result.Data = &otlpmetric.Metric_Sum{
+			Sum: &otlpmetric.Sum{
+				AggregationTemporality: data.Sum.AggregationTemporality,
+				IsMonotonic:            data.Sum.IsMonotonic,
+			},
+		}
+	case *otlpmetric.Metric_Histogram:
+		result.Data = &otlpmetric.Metric_Histogram{
+			Histogram: &otlpmetric.Histogram{
+				AggregationTemporality: data.Histogram.AggregationTemporality,
+			},
+		}
+	case *otlpmetric.Metric_ExponentialHistogram:
+		result.Data = &otlpmetric.Metric_ExponentialHistogram{
+			ExponentialHistogram: &otlpmetric.ExponentialHistogram{
+				AggregationTemporality: data.ExponentialHistogram.AggregationTemporality,
+			},
+		}
+	case *otlpmetric.Metric_Summary:
+		result.Data = &otlpmetric.Metric_Summary{Summary: &otlpmetric.Summary{}}
+	}
+
+	return result
+}
+
+// appendDataPoint appends the data point to the metric. The data point type
+// must match the metric data type.
+func appendDataPoint(metric *otlpmetric.Metric, dp dataPoint) {
+	switch data := metric.Data.(type) {
+	case *otlpmetric.Metric_Gauge:
+		data.Gauge.DataPoints = append(data.Gauge.DataPoints, dp.(*otlpmetric.NumberDataPoint))
+	case *otlpmetric.Metric_Sum:
+		data.Sum.DataPoints = append(data.Sum.DataPoints, dp.(*otlpmetric.NumberDataPoint))
+	case *otlpmetric.Metric_Histogram:
+		data.Histogram.DataPoints = append(data.Histogram.DataPoints, dp.(*otlpmetric.HistogramDataPoint))
+	case *otlpmetric.Metric_ExponentialHistogram:
+		data.ExponentialHistogram.DataPoints = append(
+			data.ExponentialHistogram.DataPoints, dp.(*otlpmetric.ExponentialHistogramDataPoint),
+		)
+	case *otlpmetric.Metric_Summary:
+		data.Summary.DataPoints = append(data.Summary.DataPoints, dp.(*otlpmetric.SummaryDataPoint))
+	}
+}
+
+// setDataPointAttributes replaces the attributes of the data point.
+func setDataPointAttributes(dp dataPoint, attrs []*otlpcommon.KeyValue) {
+	switch dp := dp.(type) {
+	case *otlpmetric.NumberDataPoint:
+		dp.Attributes = attrs
+	case *otlpmetric.HistogramDataPoint:
+		dp.Attributes = attrs
+	case *otlpmetric.ExponentialHistogramDataPoint:
+		dp.Attributes = attrs
+	case *otlpmetric.SummaryDataPoint:
+		dp.Attributes = attrs
+	}
+}
+
+// cloneDataPoint returns a deep copy of the data point.
+func cloneDataPoint(dp dataPoint) dataPoint {
+	return proto.Clone(dp).(dataPoint)
+}
+
+// attributeValueString returns the string form of a scalar attribute value.
+// Returns false if the value is not a string, int, double or bool.
+func attributeValueString(v *otlpcommon.AnyValue) (string, bool) {
+	switch v := v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return v.StringValue, true
+	case *otlpcommon.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *otlpcommon.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64), true
+	case *otlpcommon.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	}
+	return "", false
+}
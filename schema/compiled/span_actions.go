@@ -33,3 +33,63 @@ func (act SpanAttributeRenameAction) Apply(span *otlptrace.Span, changes *Change
 
 	return act.AttributesRenameAction.Apply(span.Attributes, changes)
 }
+
+type SpanEventAction interface {
+	Apply(span *otlptrace.Span, event *otlptrace.Span_Event, changes *ChangeLog) error
+}
+
+type SpanEventRenameAction map[types.EventName]types.EventName
+
+func (act SpanEventRenameAction) Apply(
+	span *otlptrace.Span, event *otlptrace.Span_Event, changes *ChangeLog,
+) error {
+	newName, exists := act[types.EventName(event.Name)]
+	if !exists {
+		return nil
+	}
+
+	if changes.Enabled {
+		changes.Append(&eventNameModifyLog{event: event, savedName: event.Name})
+	}
+	event.Name = string(newName)
+	return nil
+}
+
+type eventNameModifyLog struct {
+	event     *otlptrace.Span_Event
+	savedName string
+}
+
+func (r *eventNameModifyLog) Rollback() {
+	r.event.Name = r.savedName
+}
+
+type SpanEventAttributeRenameAction struct {
+	AttributesRenameAction
+
+	// ApplyOnlyToSpans limits which spans this action should apply to. If empty then
+	// there is no limitation.
+	ApplyOnlyToSpans map[types.SpanName]bool
+
+	// ApplyOnlyToEvents limits which events this action should apply to. If empty then
+	// there is no limitation. Both ApplyOnlyToSpans and ApplyOnlyToEvents must match
+	// for the action to apply.
+	ApplyOnlyToEvents map[types.EventName]bool
+}
+
+func (act SpanEventAttributeRenameAction) Apply(
+	span *otlptrace.Span, event *otlptrace.Span_Event, changes *ChangeLog,
+) error {
+	if len(act.ApplyOnlyToSpans) > 0 {
+		if _, exists := act.ApplyOnlyToSpans[types.SpanName(span.Name)]; !exists {
+			return nil
+		}
+	}
+	if len(act.ApplyOnlyToEvents) > 0 {
+		if _, exists := act.ApplyOnlyToEvents[types.EventName(event.Name)]; !exists {
+			return nil
+		}
+	}
+
+	return act.AttributesRenameAction.Apply(event.Attributes, changes)
+}
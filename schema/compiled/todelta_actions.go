@@ -0,0 +1,296 @@
+package compiled
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// MetricToDeltaAction converts cumulative Sum and Histogram metrics to delta
+// temporality. The previous cumulative value of each time series is kept in
+// Store. A time series is identified by the resource, the instrumentation scope,
+// the metric name and the data point attributes.
+//
+// The first data point of a time series is converted to a delta over the
+// [start time, time] interval of the data point. A change of the start time or
+// a decrease of a monotonic value is treated as a counter reset and handled
+// the same way as the first data point. The first data point without a start
+// time is dropped since the interval it accumulates over is unknown. Data points
+// that are not newer than the previous data point of the time series are dropped.
+type MetricToDeltaAction struct {
+	Metrics map[types.MetricName]bool
+	Store   *DeltaStore
+}
+
+func (act MetricToDeltaAction) Apply(metrics []*otlpmetric.Metric, changes *ChangeLog) ([]*otlpmetric.Metric, error) {
+	act.convert("", "", metrics, changes)
+	return metrics, nil
+}
+
+func (act MetricToDeltaAction) ApplyToScopes(
+	resource *otlpresource.Resource, scopes []*otlpmetric.ScopeMetrics, changes *ChangeLog,
+) error {
+	resKey := attrsKey(resource.GetAttributes())
+	for _, scope := range scopes {
+		act.convert(resKey, scopeKey(scope), scope.Metrics, changes)
+	}
+	return nil
+}
+
+func (act MetricToDeltaAction) convert(
+	resKey string, scopeKey string, metrics []*otlpmetric.Metric, changes *ChangeLog,
+) {
+	for _, metric := range metrics {
+		if !act.Metrics[types.MetricName(metric.Name)] {
+			continue
+		}
+
+		// newMetric holds the converted data.
+		newMetric := &otlpmetric.Metric{}
+		switch data := metric.Data.(type) {
+		case *otlpmetric.Metric_Sum:
+			if data.Sum.AggregationTemporality != otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+				continue
+			}
+			sum := &otlpmetric.Sum{
+				AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				IsMonotonic:            data.Sum.IsMonotonic,
+			}
+			for _, dp := range data.Sum.DataPoints {
+				key := joinKey(resKey, scopeKey, metric.Name, attrsKey(dp.Attributes))
+				if deltaDp := act.numberDelta(key, dp, data.Sum.IsMonotonic, changes); deltaDp != nil {
+					sum.DataPoints = append(sum.DataPoints, deltaDp)
+				}
+			}
+			newMetric.Data = &otlpmetric.Metric_Sum{Sum: sum}
+
+		case *otlpmetric.Metric_Histogram:
+			if data.Histogram.AggregationTemporality != otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+				continue
+			}
+			histogram := &otlpmetric.Histogram{
+				AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			}
+			for _, dp := range data.Histogram.DataPoints {
+				key := joinKey(resKey, scopeKey, metric.Name, attrsKey(dp.Attributes))
+				if deltaDp := act.histogramDelta(key, dp, changes); deltaDp != nil {
+					histogram.DataPoints = append(histogram.DataPoints, deltaDp)
+				}
+			}
+			newMetric.Data = &otlpmetric.Metric_Histogram{Histogram: histogram}
+
+		default:
+			continue
+		}
+
+		if changes.Enabled {
+			changes.Append(&metricDataLog{metric: metric, saved: &otlpmetric.Metric{Data: metric.Data}})
+		}
+		metric.Data = newMetric.Data
+	}
+}
+
+// updateStore atomically computes the delta data point from the state of the
+// time series and replaces the state. delta returns nil if the data point is
+// out of order, in which case the state is kept.
+func (act MetricToDeltaAction) updateStore(
+	key string, changes *ChangeLog, delta func(prev *deltaSeries) *deltaSeries,
+) {
+	prev, updated := act.Store.update(key, delta)
+	if updated && changes.Enabled {
+		changes.Append(&deltaStoreLog{store: act.Store, key: key, savedState: prev})
+	}
+}
+
+func (act MetricToDeltaAction) numberDelta(
+	key string, dp *otlpmetric.NumberDataPoint, monotonic bool, changes *ChangeLog,
+) (deltaDp *otlpmetric.NumberDataPoint) {
+	act.updateStore(
+		key, changes, func(prev *deltaSeries) *deltaSeries {
+			if prev != nil && dp.TimeUnixNano <= prev.time {
+				// Out of order or duplicate data point.
+				return nil
+			}
+
+			state := &deltaSeries{startTime: dp.StartTimeUnixNano, time: dp.TimeUnixNano}
+			switch v := dp.Value.(type) {
+			case *otlpmetric.NumberDataPoint_AsInt:
+				state.isInt = true
+				state.intValue = v.AsInt
+			case *otlpmetric.NumberDataPoint_AsDouble:
+				state.doubleValue = v.AsDouble
+			}
+			deltaDp = numberDeltaDataPoint(prev, state, dp, monotonic)
+			return state
+		},
+	)
+	return deltaDp
+}
+
+// numberDeltaDataPoint returns the delta between the previous and the new
+// state of the time series, nil if the delta is not known.
+func numberDeltaDataPoint(
+	prev, state *deltaSeries, dp *otlpmetric.NumberDataPoint, monotonic bool,
+) *otlpmetric.NumberDataPoint {
+	reset := prev == nil || prev.startTime != dp.StartTimeUnixNano || prev.isInt != state.isInt
+	if !reset && monotonic {
+		reset = state.intValue < prev.intValue || state.doubleValue < prev.doubleValue
+	}
+
+	deltaDp := proto.Clone(dp).(*otlpmetric.NumberDataPoint)
+	if reset {
+		if dp.StartTimeUnixNano == 0 {
+			return nil
+		}
+		// The cumulative value is the delta since the start time.
+		return deltaDp
+	}
+
+	deltaDp.StartTimeUnixNano = prev.time
+	if state.isInt {
+		deltaDp.Value = &otlpmetric.NumberDataPoint_AsInt{AsInt: state.intValue - prev.intValue}
+	} else {
+		deltaDp.Value = &otlpmetric.NumberDataPoint_AsDouble{AsDouble: state.doubleValue - prev.doubleValue}
+	}
+	return deltaDp
+}
+
+func (act MetricToDeltaAction) histogramDelta(
+	key string, dp *otlpmetric.HistogramDataPoint, changes *ChangeLog,
+) (deltaDp *otlpmetric.HistogramDataPoint) {
+	act.updateStore(
+		key, changes, func(prev *deltaSeries) *deltaSeries {
+			if prev != nil && dp.TimeUnixNano <= prev.time {
+				// Out of order or duplicate data point.
+				return nil
+			}
+
+			deltaDp = histogramDeltaDataPoint(prev, dp)
+			return &deltaSeries{
+				startTime:    dp.StartTimeUnixNano,
+				time:         dp.TimeUnixNano,
+				count:        dp.Count,
+				sum:          dp.Sum,
+				bucketCounts: append([]uint64(nil), dp.BucketCounts...),
+				bounds:       append([]float64(nil), dp.ExplicitBounds...),
+			}
+		},
+	)
+	return deltaDp
+}
+
+// histogramDeltaDataPoint returns the delta between the previous state of the
+// time series and the data point, nil if the delta is not known.
+func histogramDeltaDataPoint(prev *deltaSeries, dp *otlpmetric.HistogramDataPoint) *otlpmetric.HistogramDataPoint {
+	reset := prev == nil ||
+		prev.startTime != dp.StartTimeUnixNano ||
+		dp.Count < prev.count ||
+		!equalBounds(prev.bounds, dp.ExplicitBounds) ||
+		len(prev.bucketCounts) != len(dp.BucketCounts)
+	if !reset {
+		for i := range dp.BucketCounts {
+			if dp.BucketCounts[i] < prev.bucketCounts[i] {
+				reset = true
+				break
+			}
+		}
+	}
+
+	deltaDp := proto.Clone(dp).(*otlpmetric.HistogramDataPoint)
+	if reset {
+		if dp.StartTimeUnixNano == 0 {
+			return nil
+		}
+		return deltaDp
+	}
+
+	deltaDp.StartTimeUnixNano = prev.time
+	deltaDp.Count = dp.Count - prev.count
+	for i := range deltaDp.BucketCounts {
+		deltaDp.BucketCounts[i] -= prev.bucketCounts[i]
+	}
+	if dp.Sum != nil && prev.sum != nil {
+		sum := *dp.Sum - *prev.sum
+		deltaDp.Sum = &sum
+	} else {
+		deltaDp.Sum = nil
+	}
+	// Min and max are not known for the delta interval.
+	deltaDp.Min = nil
+	deltaDp.Max = nil
+	return deltaDp
+}
+
+func equalBounds(b1, b2 []float64) bool {
+	if len(b1) != len(b2) {
+		return false
+	}
+	for i := range b1 {
+		if b1[i] != b2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// attrsKey returns a string that identifies the set of attributes regardless
+// of their order. Values of different types are different.
+func attrsKey(attrs []*otlpcommon.KeyValue) string {
+	pairs := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		pairs = append(pairs, joinKey(attr.Key, valueKey(attr.Value)))
+	}
+	sort.Strings(pairs)
+	return joinKey(pairs...)
+}
+
+// valueKey returns a string that identifies the attribute value and its type.
+func valueKey(v *otlpcommon.AnyValue) string {
+	switch value := v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return "s" + value.StringValue
+	case *otlpcommon.AnyValue_IntValue:
+		return "i" + strconv.FormatInt(value.IntValue, 10)
+	case *otlpcommon.AnyValue_DoubleValue:
+		return "d" + strconv.FormatFloat(value.DoubleValue, 'g', -1, 64)
+	case *otlpcommon.AnyValue_BoolValue:
+		return "b" + strconv.FormatBool(value.BoolValue)
+	case *otlpcommon.AnyValue_BytesValue:
+		return "y" + string(value.BytesValue)
+	case nil:
+		return ""
+	}
+	// Arrays and key-value lists. The text format names the fields and quotes
+	// the strings.
+	return "t" + proto.CompactTextString(v)
+}
+
+// joinKey joins the parts of a key. Each part is prefixed with its length, so
+// that different parts give different keys whatever the parts contain.
+func joinKey(parts ...string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(strconv.Itoa(len(part)))
+		b.WriteByte(':')
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// metricDataLog restores the data of the metric. The data is kept in the Data
+// field of saved.
+type metricDataLog struct {
+	metric *otlpmetric.Metric
+	saved  *otlpmetric.Metric
+}
+
+func (r *metricDataLog) Rollback() {
+	r.metric.Data = r.saved.Data
+}
@@ -0,0 +1,117 @@
+package compiled
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+func TestMetricToDeltaConcurrent(t *testing.T) {
+	act := MetricToDeltaAction{
+		Metrics: map[types.MetricName]bool{"requests": true},
+		Store:   NewDeltaStore(0, 0),
+	}
+
+	// Data points of the same time series are converted concurrently and in
+	// any order. Out of order data points are dropped, the deltas of the
+	// others must add up to the last cumulative value.
+	const workers, count = 8, 1000
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	deltas := make([]int64, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			<-start
+			for i := w; i < count; i += workers {
+				metrics := []*otlpmetric.Metric{
+					{
+						Name: "requests",
+						Data: &otlpmetric.Metric_Sum{
+							Sum: &otlpmetric.Sum{
+								AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+								IsMonotonic:            true,
+								DataPoints: []*otlpmetric.NumberDataPoint{
+									{
+										StartTimeUnixNano: 1,
+										TimeUnixNano:      uint64(i + 2),
+										Value:             &otlpmetric.NumberDataPoint_AsInt{AsInt: int64(i * 10)},
+									},
+								},
+							},
+						},
+					},
+				}
+				_, err := act.Apply(metrics, &ChangeLog{Enabled: true})
+				assert.NoError(t, err)
+				for _, dp := range metrics[0].GetSum().DataPoints {
+					deltas[w] += dp.GetAsInt()
+				}
+			}
+		}(w)
+	}
+	close(start)
+	wg.Wait()
+
+	var sum int64
+	for _, delta := range deltas {
+		sum += delta
+	}
+	assert.EqualValues(t, (count-1)*10, sum)
+
+	series := seriesState(act.Store, joinKey("", "", "requests", attrsKey(nil)))
+	require.NotNil(t, series)
+	assert.EqualValues(t, (count-1)*10, series.intValue)
+}
+
+func TestAttrsKey(t *testing.T) {
+	str := func(value string) *otlpcommon.AnyValue {
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}}
+	}
+	integer := &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 1}}
+	boolean := &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: true}}
+	array := func(value *otlpcommon.AnyValue) *otlpcommon.AnyValue {
+		return &otlpcommon.AnyValue{
+			Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{Values: []*otlpcommon.AnyValue{value}}},
+		}
+	}
+	kv := func(key string, value *otlpcommon.AnyValue) *otlpcommon.KeyValue {
+		return &otlpcommon.KeyValue{Key: key, Value: value}
+	}
+
+	// The order of the attributes does not matter.
+	assert.Equal(
+		t, attrsKey([]*otlpcommon.KeyValue{kv("a", str("1")), kv("b", integer)}),
+		attrsKey([]*otlpcommon.KeyValue{kv("b", integer), kv("a", str("1"))}),
+	)
+
+	// Each set identifies a different time series.
+	sets := [][]*otlpcommon.KeyValue{
+		nil,
+		{kv("a", str("1"))},
+		{kv("a", integer)},
+		{kv("a", str("true"))},
+		{kv("a", boolean)},
+		{kv("a", str("b=c"))},
+		{kv("a=b", str("c"))},
+		{kv("a", str("1")), kv("b", str("2"))},
+		{kv("a", str("1\x00b=2"))},
+		{kv("a", array(str("1")))},
+		{kv("a", array(integer))},
+	}
+	keys := map[string]int{}
+	for i, set := range sets {
+		key := attrsKey(set)
+		if prev, exists := keys[key]; exists {
+			t.Errorf("attributes %v and %v have the same key %q", sets[prev], set, key)
+		}
+		keys[key] = i
+	}
+}
@@ -1,47 +1,104 @@
 package schema
 
 import (
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
 
 	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
 	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
 	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
-func Compile(schema *ast.Schema) *compiled.Schema {
-	compiledSchema := &compiled.Schema{}
+// Compile compiles the schema. The returned Diagnostics list the problems found
+// in the schema. If any of them is an error the returned schema is nil.
+// Warnings do not prevent compilation, callers that want to reject schemas with
+// warnings can check diags.Err(SeverityWarning).
+func Compile(schema *ast.Schema) (*compiled.Schema, Diagnostics) {
+	var diags Diagnostics
+	schemaReporter := diagnosticReporter{diags: &diags}
+
+	compiledSchema := &compiled.Schema{
+		SchemaURL:  schema.SchemaURL,
+		DeltaStore: compiled.NewDeltaStore(compiled.DefaultDeltaStoreMaxSeries, compiled.DefaultDeltaStoreTTL),
+	}
 
-	compiledActionsForVersion := map[types.TelemetryVersion]*compiled.ActionsForVersion{}
+	if schema.SchemaURL != "" {
+		if _, _, err := types.SplitSchemaURL(schema.SchemaURL); err != nil {
+			schemaReporter.errorf("", "%v", err)
+		}
+	}
+
+	// Compile the versions in a stable order, so that diagnostics are
+	// reported in the same order every time.
+	versionNums := make([]string, 0, len(schema.Versions))
+	for versionNum := range schema.Versions {
+		versionNums = append(versionNums, string(versionNum))
+	}
+	sort.Strings(versionNums)
 
 	// Loop through and compile each version.
-	for versionNum, versionDescr := range schema.Versions {
-		actionsForVer, exists := compiledActionsForVersion[versionNum]
-		if !exists {
-			actionsForVer = &compiled.ActionsForVersion{}
-			compiledActionsForVersion[versionNum] = actionsForVer
+	for _, v := range versionNums {
+		versionNum := types.TelemetryVersion(v)
+		versionDescr := schema.Versions[versionNum]
+		r := diagnosticReporter{version: versionNum, diags: &diags}
+
+		version, err := versionNum.Parse()
+		if err != nil {
+			r.errorf("", "%v", err)
+			continue
 		}
 
+		actionsForVer := &compiled.ActionsForVersion{VersionNum: version}
+		compiledSchema.Versions = append(compiledSchema.Versions, actionsForVer)
+
+		checkAttributeActions(compiled.SectionAll, versionDescr.All.Changes, r)
+		checkAttributeActions(compiled.SectionResources, versionDescr.Resources.Changes, r)
+
 		actionsForVer.Resource = compileResourceActions(
 			versionDescr.All.Changes, versionDescr.Resources.Changes,
 		)
 		actionsForVer.Metrics = compileMetricActions(
-			versionDescr.All.Changes, versionDescr.Metrics.Changes,
+			versionDescr.All.Changes, versionDescr.Metrics.Changes, compiledSchema.DeltaStore, r,
 		)
 		actionsForVer.Spans = compileSpanActions(
-			versionDescr.All.Changes, versionDescr.Spans.Changes,
+			versionDescr.All.Changes, versionDescr.Spans.Changes, versionDescr.SpanEvents.Changes, r,
 		)
-	}
-
-	// Convert map by version to a slice.
-	for versionNum, actions := range compiledActionsForVersion {
-		actions.VersionNum = versionNum
-		compiledSchema.Versions = append(compiledSchema.Versions, actions)
+		actionsForVer.Logs = compileLogActions(
+			versionDescr.All.Changes, versionDescr.Logs.Changes, r,
+		)
+		actionsForVer.Reverse = compileReverseActions(versionDescr)
 	}
 
 	// Order the slice by version.
 	sort.Sort(compiledSchema.Versions)
 
-	return compiledSchema
+	// Versions that differ only by build metadata have the same precedence and
+	// cannot be ordered relative to each other.
+	for i := 1; i < len(compiledSchema.Versions); i++ {
+		prev, cur := compiledSchema.Versions[i-1].VersionNum, compiledSchema.Versions[i].VersionNum
+		if prev.Compare(cur) == 0 {
+			schemaReporter.errorf("", "versions %s and %s have the same precedence", prev, cur)
+		}
+	}
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return compiledSchema, diags
+}
+
+// checkAttributeActions reports the entries of "all" and "resources" sections
+// that have no action.
+func checkAttributeActions(section string, actions []ast.AttributeTranslationAction, r diagnosticReporter) {
+	for i, action := range actions {
+		if action.RenameAttributes == nil {
+			r.warnf(section, "entry %d has no action", i)
+		}
+	}
 }
 
 func compileResourceActions(
@@ -73,6 +130,8 @@ func compileResourceActions(
 func compileMetricActions(
 	allActions []ast.AttributeTranslationAction,
 	metricActions []ast.MetricTranslationAction,
+	deltaStore *compiled.DeltaStore,
+	r diagnosticReporter,
 ) (result compiled.MetricActions) {
 
 	// First add actions in "all" section.
@@ -87,37 +146,136 @@ func compileMetricActions(
 	}
 
 	// Now compile metric actions and add one by one.
-	for _, srcAction := range metricActions {
+	for i, srcAction := range metricActions {
 		var compiledAction compiled.MetricAction
 
+		actionNames := metricActionNames(srcAction)
+		switch {
+		case len(actionNames) == 0:
+			r.warnf(compiled.SectionMetrics, "entry %d has no action", i)
+			continue
+		case len(actionNames) > 1:
+			r.warnf(
+				compiled.SectionMetrics, "entry %d sets several actions (%s), only %s is applied",
+				i, strings.Join(actionNames, ", "), actionNames[0],
+			)
+		}
+
 		if srcAction.RenameMetrics != nil {
 			compiledAction = compiled.MetricRenameAction(srcAction.RenameMetrics)
-			result.Actions = append(result.Actions, compiledAction)
 		} else if srcAction.RenameLabels != nil {
 			compiledAction = compiled.MetricLabelRenameAction{
 				ApplyOnlyToMetrics: metricNamesToMap(srcAction.RenameLabels.ApplyToMetrics),
 				LabelMap:           srcAction.RenameLabels.AttributeMap,
 			}
-
-			result.Actions = append(result.Actions, compiledAction)
+		} else if srcAction.AddAttributes != nil {
+			compiledAction = compileAddAttributesAction(srcAction.AddAttributes)
+		} else if srcAction.DuplicateAttributes != nil {
+			compiledAction = compiled.MetricDuplicateAttributesAction{
+				ApplyOnlyToMetrics: metricNamesToMap(srcAction.DuplicateAttributes.ApplyToMetrics),
+				AttributeMap:       srcAction.DuplicateAttributes.AttributeMap,
+			}
 		} else if srcAction.Split != nil {
+			split := srcAction.Split
+			if split.ApplyToMetric == "" || split.ByAttribute == "" || len(split.AttributesToMetrics) == 0 {
+				r.errorf(
+					compiled.SectionMetrics,
+					"entry %d: split must set apply_to_metric, by_attribute and metrics_from_attributes", i,
+				)
+				continue
+			}
 			compiledAction = compiled.MetricSplitAction{
-				MetricName:    srcAction.Split.ApplyToMetric,
-				AttributeName: srcAction.Split.ByAttribute,
-				SplitMap:      compileSplitMap(srcAction.Split.AttributesToMetrics),
+				MetricName:    split.ApplyToMetric,
+				AttributeName: split.ByAttribute,
+				SplitMap:      compileSplitMap(split.AttributesToMetrics),
+			}
+		} else if srcAction.Merge != nil {
+			var err error
+			compiledAction, err = compileMergeAction(srcAction.Merge)
+			if err != nil {
+				r.errorf(compiled.SectionMetrics, "entry %d: %v", i, err)
+				continue
+			}
+		} else if len(srcAction.ToDelta) > 0 {
+			compiledAction = compiled.MetricToDeltaAction{
+				Metrics: metricNamesToMap(srcAction.ToDelta),
+				Store:   deltaStore,
 			}
-
-			result.Actions = append(result.Actions, compiledAction)
 		}
+
+		result.Actions = append(result.Actions, compiledAction)
 	}
 
 	return result
 }
 
-func compileSplitMap(m map[types.MetricName]types.AttributeValue) map[types.AttributeValue]types.MetricName {
-	r := map[types.AttributeValue]types.MetricName{}
+// metricActionNames returns the names of the actions set in the entry, in the
+// order of precedence used by compileMetricActions.
+func metricActionNames(action ast.MetricTranslationAction) []string {
+	var names []string
+	if action.RenameMetrics != nil {
+		names = append(names, "rename_metrics")
+	}
+	if action.RenameLabels != nil {
+		names = append(names, "rename_attributes")
+	}
+	if action.AddAttributes != nil {
+		names = append(names, "add_attributes")
+	}
+	if action.DuplicateAttributes != nil {
+		names = append(names, "duplicate_attributes")
+	}
+	if action.Split != nil {
+		names = append(names, "split")
+	}
+	if action.Merge != nil {
+		names = append(names, "merge")
+	}
+	if len(action.ToDelta) > 0 {
+		names = append(names, "to_delta")
+	}
+	return names
+}
+
+func compileMergeAction(merge *ast.MergeMetric) (compiled.MetricMergeAction, error) {
+	if merge.CreateMetric == "" || merge.ByAttribute == "" || len(merge.AttributesForMetrics) == 0 {
+		return compiled.MetricMergeAction{}, errors.New(
+			"merge must set create_metric, by_attribute and attributes_for_metrics",
+		)
+	}
+
+	compiledAction := compiled.MetricMergeAction{
+		CreateMetric:    merge.CreateMetric,
+		AttributeName:   types.AttributeName(merge.ByAttribute),
+		AttributeValues: map[types.MetricName]*otlpcommon.AnyValue{},
+	}
+	for metricName, attrValue := range merge.AttributesForMetrics {
+		value, err := compiled.NewAnyValue(attrValue)
+		if err != nil {
+			return compiledAction, fmt.Errorf("merge into metric %s: %w", merge.CreateMetric, err)
+		}
+		compiledAction.AttributeValues[metricName] = value
+	}
+	return compiledAction, nil
+}
+
+func compileAddAttributesAction(add *ast.AttributeMapForMetrics) compiled.MetricAddAttributesAction {
+	compiledAction := compiled.MetricAddAttributesAction{
+		ApplyOnlyToMetrics: metricNamesToMap(add.ApplyToMetrics),
+		Attributes:         map[string]*otlpcommon.AnyValue{},
+	}
+	for name, value := range add.AttributeMap {
+		compiledAction.Attributes[name] = &otlpcommon.AnyValue{
+			Value: &otlpcommon.AnyValue_StringValue{StringValue: value},
+		}
+	}
+	return compiledAction
+}
+
+func compileSplitMap(m map[types.MetricName]types.AttributeValue) map[string]types.MetricName {
+	r := map[string]types.MetricName{}
 	for k, v := range m {
-		r[v] = k
+		r[fmt.Sprint(v)] = k
 	}
 	return r
 }
@@ -133,6 +291,8 @@ func metricNamesToMap(metrics []types.MetricName) map[types.MetricName]bool {
 func compileSpanActions(
 	allActions []ast.AttributeTranslationAction,
 	spanActions []ast.SpanTranslationAction,
+	spanEventActions []ast.SpanEventTranslationAction,
+	r diagnosticReporter,
 ) (result compiled.SpanActions) {
 
 	var compiledActionSeq []compiled.SpanAction
@@ -150,9 +310,13 @@ func compileSpanActions(
 	}
 
 	// Now compile span actions and add one by one.
-	for _, srcAction := range spanActions {
+	for i, srcAction := range spanActions {
 		var compiledAction compiled.SpanAction
 
+		if srcAction.RenameAttributes == nil {
+			r.warnf(compiled.SectionSpans, "entry %d has no action", i)
+		}
+
 		if srcAction.RenameAttributes != nil {
 			compiledAction = compiled.SpanAttributeRenameAction{
 				AttributesRenameAction: srcAction.RenameAttributes.AttributeMap,
@@ -166,9 +330,59 @@ func compileSpanActions(
 		}
 	}
 
+	// Actions in "all" section apply to span event attributes too.
+	for _, action := range allActions {
+		if action.RenameAttributes != nil {
+			result.SpanEvents = append(
+				result.SpanEvents, compiled.SpanEventAttributeRenameAction{
+					AttributesRenameAction: map[string]string(*action.RenameAttributes),
+				},
+			)
+		}
+	}
+
+	// Now compile span event actions and add one by one.
+	for i, srcAction := range spanEventActions {
+		if srcAction.RenameEvents == nil && srcAction.RenameAttributes == nil {
+			r.warnf(compiled.SectionSpanEvents, "entry %d has no action", i)
+		}
+
+		if srcAction.RenameEvents != nil {
+			result.SpanEvents = append(
+				result.SpanEvents, compileSpanEventRenameAction(srcAction.RenameEvents.EventNameMap),
+			)
+		}
+
+		if srcAction.RenameAttributes != nil {
+			result.SpanEvents = append(
+				result.SpanEvents, compiled.SpanEventAttributeRenameAction{
+					AttributesRenameAction: srcAction.RenameAttributes.AttributeMap,
+					ApplyOnlyToSpans:       spanNamesToMap(srcAction.RenameAttributes.ApplyToSpans),
+					ApplyOnlyToEvents:      eventNamesToMap(srcAction.RenameAttributes.ApplyToEvents),
+				},
+			)
+		}
+	}
+
 	return result
 }
 
+func compileSpanEventRenameAction(m map[string]string) compiled.SpanEventRenameAction {
+	r := compiled.SpanEventRenameAction{}
+	for k, v := range m {
+		r[types.EventName(k)] = types.EventName(v)
+	}
+	return r
+}
+
+func eventNamesToMap(events []types.EventName) map[types.EventName]bool {
+	m := map[types.EventName]bool{}
+	for _, event := range events {
+		m[event] = true
+	}
+	return m
+}
+
 func spanNamesToMap(spans []types.SpanName) map[types.SpanName]bool {
 	m := map[types.SpanName]bool{}
 	for _, span := range spans {
@@ -176,3 +390,50 @@ func spanNamesToMap(spans []types.SpanName) map[types.SpanName]bool {
 	}
 	return m
 }
+
+func compileLogActions(
+	allActions []ast.AttributeTranslationAction,
+	logActions []ast.LogTranslationAction,
+	r diagnosticReporter,
+) (result compiled.LogActions) {
+
+	// First add actions in "all" section.
+	for _, action := range allActions {
+		if action.RenameAttributes != nil {
+			compiledAction := compiled.LogAttributeRenameAction{
+				AttributesRenameAction: map[string]string(*action.RenameAttributes),
+			}
+			// Should apply to all logs.
+			result = append(result, compiledAction)
+		}
+	}
+
+	// Now compile log actions and add one by one.
+	for i, srcAction := range logActions {
+		if srcAction.RenameLogs == nil && srcAction.RenameAttributes == nil {
+			r.warnf(compiled.SectionLogs, "entry %d has no action", i)
+		}
+
+		if srcAction.RenameLogs != nil {
+			result = append(result, compiled.LogRenameAction(srcAction.RenameLogs))
+		}
+
+		if srcAction.RenameAttributes != nil {
+			compiledAction := compiled.LogAttributeRenameAction{
+				AttributesRenameAction: srcAction.RenameAttributes.AttributeMap,
+				ApplyOnlyToLogs:        logNamesToMap(srcAction.RenameAttributes.ApplyToLogs),
+			}
+			result = append(result, compiledAction)
+		}
+	}
+
+	return result
+}
+
+func logNamesToMap(logs []types.LogName) map[types.LogName]bool {
+	m := map[types.LogName]bool{}
+	for _, log := range logs {
+		m[log] = true
+	}
+	return m
+}
@@ -0,0 +1,389 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// compileReverseActions compiles the actions that undo the changes made by
+// the version. Inverse actions are listed in the reverse order of the actions
+// they undo, so the section specific actions are undone before the actions
+// of "all" section.
+func compileReverseActions(versionDescr ast.VersionDef) (result compiled.ReverseActions) {
+	var allRenames []map[string]string
+	for _, action := range versionDescr.All.Changes {
+		if action.RenameAttributes == nil {
+			continue
+		}
+		inverse, err := invertMapping(*action.RenameAttributes)
+		if err != nil {
+			result.Irreversible = append(
+				result.Irreversible, compiled.IrreversibleAction{
+					Section: compiled.SectionAll,
+					Reason:  "rename_attributes " + err.Error(),
+				},
+			)
+			continue
+		}
+		allRenames = append(allRenames, inverse)
+	}
+
+	result.Resource = compileReverseResourceActions(versionDescr.Resources.Changes, allRenames, &result)
+	result.Spans = compileReverseSpanActions(
+		versionDescr.Spans.Changes, versionDescr.SpanEvents.Changes, allRenames, &result,
+	)
+	result.Metrics = compileReverseMetricActions(versionDescr.Metrics.Changes, allRenames, &result)
+	result.Logs = compileReverseLogActions(versionDescr.Logs.Changes, allRenames, &result)
+
+	return result
+}
+
+func compileReverseResourceActions(
+	resourceActions []ast.AttributeTranslationAction,
+	allRenames []map[string]string,
+	reverse *compiled.ReverseActions,
+) (result compiled.ResourceActions) {
+	for i := len(resourceActions) - 1; i >= 0; i-- {
+		action := resourceActions[i]
+		if action.RenameAttributes == nil {
+			continue
+		}
+		inverse, err := invertMapping(*action.RenameAttributes)
+		if err != nil {
+			reverse.Irreversible = append(
+				reverse.Irreversible, compiled.IrreversibleAction{
+					Section: compiled.SectionResources,
+					Reason:  "rename_attributes " + err.Error(),
+				},
+			)
+			continue
+		}
+		result = append(result, compiled.ResourceAttributesRenameAction(inverse))
+	}
+
+	for i := len(allRenames) - 1; i >= 0; i-- {
+		result = append(result, compiled.ResourceAttributesRenameAction(allRenames[i]))
+	}
+
+	return result
+}
+
+func compileReverseSpanActions(
+	spanActions []ast.SpanTranslationAction,
+	spanEventActions []ast.SpanEventTranslationAction,
+	allRenames []map[string]string,
+	reverse *compiled.ReverseActions,
+) (result compiled.SpanActions) {
+	for i := len(spanActions) - 1; i >= 0; i-- {
+		action := spanActions[i]
+		if action.RenameAttributes == nil {
+			continue
+		}
+		inverse, err := invertMapping(action.RenameAttributes.AttributeMap)
+		if err != nil {
+			reverse.Irreversible = append(
+				reverse.Irreversible, compiled.IrreversibleAction{
+					Section: compiled.SectionSpans,
+					Reason:  "rename_attributes " + err.Error(),
+				},
+			)
+			continue
+		}
+		result.ForAllSpans = append(
+			result.ForAllSpans, compiled.SpanAttributeRenameAction{AttributesRenameAction: inverse},
+		)
+	}
+
+	for i := len(allRenames) - 1; i >= 0; i-- {
+		result.ForAllSpans = append(
+			result.ForAllSpans, compiled.SpanAttributeRenameAction{AttributesRenameAction: allRenames[i]},
+		)
+	}
+
+	for i := len(spanEventActions) - 1; i >= 0; i-- {
+		srcAction := spanEventActions[i]
+
+		// Undo in the reverse order of compileSpanActions.
+		if srcAction.RenameAttributes != nil {
+			inverse, err := invertMapping(srcAction.RenameAttributes.AttributeMap)
+			if err != nil {
+				reverse.Irreversible = append(
+					reverse.Irreversible, compiled.IrreversibleAction{
+						Section: compiled.SectionSpanEvents,
+						Reason:  "rename_attributes " + err.Error(),
+					},
+				)
+			} else {
+				result.SpanEvents = append(
+					result.SpanEvents, compiled.SpanEventAttributeRenameAction{
+						AttributesRenameAction: inverse,
+						ApplyOnlyToSpans:       spanNamesToMap(srcAction.RenameAttributes.ApplyToSpans),
+						ApplyOnlyToEvents:      eventNamesToMap(srcAction.RenameAttributes.ApplyToEvents),
+					},
+				)
+			}
+		}
+
+		if srcAction.RenameEvents != nil {
+			inverse, err := invertMapping(srcAction.RenameEvents.EventNameMap)
+			if err != nil {
+				reverse.Irreversible = append(
+					reverse.Irreversible, compiled.IrreversibleAction{
+						Section: compiled.SectionSpanEvents,
+						Reason:  "rename_events " + err.Error(),
+					},
+				)
+			} else {
+				result.SpanEvents = append(result.SpanEvents, compileSpanEventRenameAction(inverse))
+			}
+		}
+	}
+
+	for i := len(allRenames) - 1; i >= 0; i-- {
+		result.SpanEvents = append(
+			result.SpanEvents, compiled.SpanEventAttributeRenameAction{AttributesRenameAction: allRenames[i]},
+		)
+	}
+
+	return result
+}
+
+func compileReverseMetricActions(
+	metricActions []ast.MetricTranslationAction,
+	allRenames []map[string]string,
+	reverse *compiled.ReverseActions,
+) (result compiled.MetricActions) {
+	for i := len(metricActions) - 1; i >= 0; i-- {
+		srcAction := metricActions[i]
+
+		// irreversible records that the action cannot be undone for the
+		// metrics, as they are named once the version's later actions are done.
+		// No metrics means the action applies to all metrics.
+		irreversible := func(metrics []types.MetricName, format string, args ...interface{}) {
+			reverse.Irreversible = append(
+				reverse.Irreversible, compiled.IrreversibleAction{
+					Section: compiled.SectionMetrics,
+					Reason:  fmt.Sprintf(format, args...),
+					Metrics: renameByLaterActions(metricActions[i+1:], metrics),
+				},
+			)
+		}
+
+		if srcAction.RenameMetrics != nil {
+			inverse, err := invertMetricNames(srcAction.RenameMetrics)
+			if err != nil {
+				var newNames []types.MetricName
+				for _, newName := range srcAction.RenameMetrics {
+					newNames = append(newNames, newName)
+				}
+				irreversible(newNames, "rename_metrics %v", err)
+			} else {
+				result.Actions = append(result.Actions, compiled.MetricRenameAction(inverse))
+			}
+		} else if srcAction.RenameLabels != nil {
+			inverse, err := invertMapping(srcAction.RenameLabels.AttributeMap)
+			if err != nil {
+				irreversible(srcAction.RenameLabels.ApplyToMetrics, "rename_attributes %v", err)
+			} else {
+				result.Actions = append(
+					result.Actions, compiled.MetricLabelRenameAction{
+						ApplyOnlyToMetrics: metricNamesToMap(srcAction.RenameLabels.ApplyToMetrics),
+						LabelMap:           inverse,
+					},
+				)
+			}
+		} else if srcAction.AddAttributes != nil {
+			irreversible(srcAction.AddAttributes.ApplyToMetrics, "add_attributes cannot be undone")
+		} else if srcAction.DuplicateAttributes != nil {
+			irreversible(srcAction.DuplicateAttributes.ApplyToMetrics, "duplicate_attributes cannot be undone")
+		} else if split := srcAction.Split; split != nil {
+			if inverse, ok := invertSplit(split); ok {
+				result.Actions = append(result.Actions, inverse)
+			} else {
+				metrics := []types.MetricName{split.ApplyToMetric}
+				for newName := range split.AttributesToMetrics {
+					metrics = append(metrics, newName)
+				}
+				irreversible(
+					metrics, "split of metric %s cannot be undone, several metrics have the same %s",
+					split.ApplyToMetric, split.ByAttribute,
+				)
+			}
+		} else if merge := srcAction.Merge; merge != nil {
+			if inverse, ok := invertMerge(merge); ok {
+				result.Actions = append(result.Actions, inverse)
+			} else {
+				irreversible(
+					[]types.MetricName{merge.CreateMetric},
+					"merge into metric %s cannot be undone, several metrics have the same %s",
+					merge.CreateMetric, merge.ByAttribute,
+				)
+			}
+		} else if len(srcAction.ToDelta) > 0 {
+			irreversible(srcAction.ToDelta, "to_delta of metrics %v cannot be undone", srcAction.ToDelta)
+		}
+	}
+
+	for i := len(allRenames) - 1; i >= 0; i-- {
+		result.Actions = append(result.Actions, compiled.MetricLabelRenameAction{LabelMap: allRenames[i]})
+	}
+
+	return result
+}
+
+// invertSplit returns the merge that undoes the split. It fails if several
+// metrics are split off by the same attribute value.
+func invertSplit(split *ast.SplitMetric) (compiled.MetricMergeAction, bool) {
+	inverse := compiled.MetricMergeAction{
+		CreateMetric:    split.ApplyToMetric,
+		AttributeName:   split.ByAttribute,
+		AttributeValues: map[types.MetricName]*otlpcommon.AnyValue{},
+	}
+	if len(compileSplitMap(split.AttributesToMetrics)) != len(split.AttributesToMetrics) {
+		return inverse, false
+	}
+	for newName, attrValue := range split.AttributesToMetrics {
+		value, err := compiled.NewAnyValue(attrValue)
+		if err != nil {
+			return inverse, false
+		}
+		inverse.AttributeValues[newName] = value
+	}
+	return inverse, true
+}
+
+// invertMerge returns the split that undoes the merge. It fails if several
+// metrics are merged with the same attribute value.
+func invertMerge(merge *ast.MergeMetric) (compiled.MetricSplitAction, bool) {
+	inverse := compiled.MetricSplitAction{
+		MetricName:    merge.CreateMetric,
+		AttributeName: types.AttributeName(merge.ByAttribute),
+		SplitMap:      compileSplitMap(merge.AttributesForMetrics),
+	}
+	return inverse, len(inverse.SplitMap) == len(merge.AttributesForMetrics)
+}
+
+// renameByLaterActions returns the set of metric names as they are named once
+// the rename_metrics actions are done. Returns nil if there are no names.
+func renameByLaterActions(
+	actions []ast.MetricTranslationAction, metrics []types.MetricName,
+) map[types.MetricName]bool {
+	if len(metrics) == 0 {
+		return nil
+	}
+	result := make(map[types.MetricName]bool, len(metrics))
+	for _, name := range metrics {
+		for _, action := range actions {
+			if newName, exists := action.RenameMetrics[name]; exists {
+				name = newName
+			}
+		}
+		result[name] = true
+	}
+	return result
+}
+
+func compileReverseLogActions(
+	logActions []ast.LogTranslationAction,
+	allRenames []map[string]string,
+	reverse *compiled.ReverseActions,
+) (result compiled.LogActions) {
+	irreversible := func(format string, args ...interface{}) {
+		reverse.Irreversible = append(
+			reverse.Irreversible, compiled.IrreversibleAction{
+				Section: compiled.SectionLogs,
+				Reason:  fmt.Sprintf(format, args...),
+			},
+		)
+	}
+
+	for i := len(logActions) - 1; i >= 0; i-- {
+		srcAction := logActions[i]
+
+		// Undo in the reverse order of compileLogActions.
+		if srcAction.RenameAttributes != nil {
+			inverse, err := invertMapping(srcAction.RenameAttributes.AttributeMap)
+			if err != nil {
+				irreversible("rename_attributes %v", err)
+			} else {
+				result = append(
+					result, compiled.LogAttributeRenameAction{
+						AttributesRenameAction: inverse,
+						ApplyOnlyToLogs:        logNamesToMap(srcAction.RenameAttributes.ApplyToLogs),
+					},
+				)
+			}
+		}
+
+		if srcAction.RenameLogs != nil {
+			names := make(map[string]string, len(srcAction.RenameLogs))
+			for k, v := range srcAction.RenameLogs {
+				names[string(k)] = string(v)
+			}
+			inverse, err := invertMapping(names)
+			if err != nil {
+				irreversible("rename_logs %v", err)
+			} else {
+				compiledAction := compiled.LogRenameAction{}
+				for k, v := range inverse {
+					compiledAction[types.LogName(k)] = types.LogName(v)
+				}
+				result = append(result, compiledAction)
+			}
+		}
+	}
+
+	for i := len(allRenames) - 1; i >= 0; i-- {
+		result = append(result, compiled.LogAttributeRenameAction{AttributesRenameAction: allRenames[i]})
+	}
+
+	return result
+}
+
+// invertMapping swaps keys and values of the rename mapping. It fails if the
+// mapping renames several names to the same new name.
+func invertMapping(m map[string]string) (map[string]string, error) {
+	oldNames := make([]string, 0, len(m))
+	for oldName := range m {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+
+	inverse := make(map[string]string, len(m))
+	var conflicts []string
+	for _, oldName := range oldNames {
+		newName := m[oldName]
+		if prev, exists := inverse[newName]; exists {
+			conflicts = append(conflicts, fmt.Sprintf("both %s and %s are renamed to %s", prev, oldName, newName))
+			continue
+		}
+		inverse[newName] = oldName
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("is not reversible: %s", strings.Join(conflicts, ", "))
+	}
+	return inverse, nil
+}
+
+func invertMetricNames(m map[types.MetricName]types.MetricName) (map[types.MetricName]types.MetricName, error) {
+	names := make(map[string]string, len(m))
+	for k, v := range m {
+		names[string(k)] = string(v)
+	}
+	inverse, err := invertMapping(names)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[types.MetricName]types.MetricName, len(inverse))
+	for k, v := range inverse {
+		result[types.MetricName(k)] = types.MetricName(v)
+	}
+	return result, nil
+}
@@ -7,13 +7,19 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
 	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
 	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
 
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
 	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
 	"github.com/tigrannajaryan/telemetry-schema/schema/converter"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
 func compileTestSchema(t testing.TB) *compiled.Schema {
@@ -25,7 +31,8 @@ func compileTestSchema(t testing.TB) *compiled.Schema {
 	//l2 := ts.Metrics["1.1.0"].Current[6].Labels
 	//fmt.Printf("%p %p\n", &l1, &l2)
 
-	compiled := Compile(ts)
+	compiled, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
 	require.NotNil(t, compiled)
 
 	return compiled
@@ -35,6 +42,808 @@ func TestCompileSchema(t *testing.T) {
 	compileTestSchema(t)
 }
 
+func TestCompileVersionOrdering(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.9.0":       {},
+			"1.10.0":      {},
+			"1.2.0":       {},
+			"1.10.0-rc.1": {},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+
+	var versions []string
+	for _, v := range schema.Versions {
+		versions = append(versions, v.VersionNum.String())
+	}
+	assert.Equal(t, []string{"1.2.0", "1.9.0", "1.10.0-rc.1", "1.10.0"}, versions)
+}
+
+func TestCompileRejectsMalformedVersion(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.0.0": {},
+			"1.1":   {},
+		},
+	}
+
+	_, diags := Compile(ts)
+	assert.True(t, diags.HasErrors())
+
+	ts = &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.0.0":       {},
+			"1.0.0+build": {},
+		},
+	}
+
+	_, diags = Compile(ts)
+	assert.True(t, diags.HasErrors())
+}
+
+func TestConvertAppliesVersionsInSemverOrder(t *testing.T) {
+	// The rename in 1.10.0 depends on the rename in 1.9.0 happening first.
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.9.0": {
+				Resources: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"a": "b"}},
+					},
+				},
+			},
+			"1.10.0": {
+				Resources: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"b": "c"}},
+					},
+				},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+
+	resource := &otlpresource.Resource{
+		Attributes: []*otlpcommon.KeyValue{
+			{Key: "a", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 1}}},
+		},
+	}
+	err := schema.ConvertResourceToLatest("1.0.0", resource, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	assert.Equal(t, "c", resource.Attributes[0].Key)
+
+	err = schema.ConvertResourceToLatest("not-a-version", resource, &compiled.ChangeLog{})
+	assert.Error(t, err)
+}
+
+func chainedRenameSchema(t *testing.T) *compiled.Schema {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.0.0": {},
+			"1.1.0": {
+				All: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"a": "b"}},
+					},
+				},
+			},
+			"1.2.0": {
+				All: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"b": "c"}},
+					},
+				},
+			},
+			"1.3.0": {
+				All: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"c": "d"}},
+					},
+				},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+	return schema
+}
+
+func TestConvertToVersion(t *testing.T) {
+	schema := chainedRenameSchema(t)
+
+	tests := []struct {
+		from     types.TelemetryVersion
+		to       types.TelemetryVersion
+		attrName string
+	}{
+		{from: "1.0.0", to: "1.0.0", attrName: "a"},
+		{from: "1.0.0", to: "1.1.0", attrName: "b"},
+		{from: "1.0.0", to: "1.2.0", attrName: "c"},
+		{from: "1.0.0", to: "1.2.5", attrName: "c"},
+		{from: "1.0.0", to: "1.3.0", attrName: "d"},
+		{from: "1.1.0", to: "1.2.0", attrName: "c"},
+		{from: "1.1.0", to: "1.1.0", attrName: "b"},
+		{from: "1.1.0", to: "2.0.0", attrName: "d"},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			string(test.from)+"->"+string(test.to), func(t *testing.T) {
+				srcAttrName := map[types.TelemetryVersion]string{"1.0.0": "a", "1.1.0": "b"}[test.from]
+
+				resource := &otlpresource.Resource{
+					Attributes: []*otlpcommon.KeyValue{
+						{
+							Key:   srcAttrName,
+							Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 1}},
+						},
+					},
+				}
+				err := schema.ConvertResourceToVersion(test.from, test.to, resource, &compiled.ChangeLog{})
+				require.NoError(t, err)
+				assert.Equal(t, test.attrName, resource.Attributes[0].Key)
+
+				spans := []*otlptrace.Span{
+					{
+						Attributes: []*otlpcommon.KeyValue{
+							{
+								Key:   srcAttrName,
+								Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 1}},
+							},
+						},
+					},
+				}
+				err = schema.ConvertSpansToVersion(test.from, test.to, spans, &compiled.ChangeLog{})
+				require.NoError(t, err)
+				assert.Equal(t, test.attrName, spans[0].Attributes[0].Key)
+			},
+		)
+	}
+
+	err := schema.ConvertResourceToVersion("1.0.0", "1.x", &otlpresource.Resource{}, &compiled.ChangeLog{})
+	assert.Error(t, err)
+}
+
+func TestConvertRequestToTargetVersion(t *testing.T) {
+	schema := chainedRenameSchema(t)
+
+	request := &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				Resource: &otlpresource.Resource{
+					Attributes: []*otlpcommon.KeyValue{
+						{Key: "a", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 1}}},
+					},
+				},
+			},
+		},
+	}
+
+	err := converter.ConvertRequestWithOptions(
+		request, schema, converter.Options{TargetVersion: "1.2.0"}, &compiled.ChangeLog{},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "c", request.ResourceSpans[0].Resource.Attributes[0].Key)
+
+	// Without a target version the request is converted to the latest version.
+	err = converter.ConvertRequest(request, schema, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	assert.Equal(t, "d", request.ResourceSpans[0].Resource.Attributes[0].Key)
+}
+
+func TestConvertRequestSchemaURL(t *testing.T) {
+	schema := chainedRenameSchema(t)
+	schema.SchemaURL = "https://example.com/schemas/1.3.0"
+
+	span := func(attrName string) []*otlptrace.Span {
+		return []*otlptrace.Span{{Attributes: []*otlpcommon.KeyValue{strAttr(attrName, "1")}}}
+	}
+
+	request := &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				SchemaUrl: "https://example.com/schemas/1.1.0",
+				Resource:  &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{strAttr("b", "1")}},
+				ScopeSpans: []*otlptrace.ScopeSpans{
+					// Inherits the schema URL of the resource.
+					{Spans: span("b")},
+					{SchemaUrl: "https://example.com/schemas/1.2.0", Spans: span("c")},
+					// Different schema family is not converted.
+					{SchemaUrl: "https://other.com/schemas/1.0.0", Spans: span("a")},
+					// Malformed schema URL is not converted.
+					{SchemaUrl: "https://example.com/schemas/latest", Spans: span("a")},
+				},
+			},
+			{
+				Resource:   &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{strAttr("a", "1")}},
+				ScopeSpans: []*otlptrace.ScopeSpans{{Spans: span("a")}},
+			},
+		},
+	}
+	requestCopy := proto.Clone(request)
+
+	changes := &compiled.ChangeLog{Enabled: true}
+	require.NoError(t, converter.ConvertRequest(request, schema, changes))
+
+	rss := request.ResourceSpans[0]
+	assert.Equal(t, "https://example.com/schemas/1.3.0", rss.SchemaUrl)
+	assert.Equal(t, "d", rss.Resource.Attributes[0].Key)
+	assert.Equal(t, "", rss.ScopeSpans[0].SchemaUrl)
+	assert.Equal(t, "d", rss.ScopeSpans[0].Spans[0].Attributes[0].Key)
+	assert.Equal(t, "https://example.com/schemas/1.3.0", rss.ScopeSpans[1].SchemaUrl)
+	assert.Equal(t, "d", rss.ScopeSpans[1].Spans[0].Attributes[0].Key)
+	assert.Equal(t, "https://other.com/schemas/1.0.0", rss.ScopeSpans[2].SchemaUrl)
+	assert.Equal(t, "a", rss.ScopeSpans[2].Spans[0].Attributes[0].Key)
+	assert.Equal(t, "https://example.com/schemas/latest", rss.ScopeSpans[3].SchemaUrl)
+	assert.Equal(t, "a", rss.ScopeSpans[3].Spans[0].Attributes[0].Key)
+
+	// Data without schema URL is converted from 0.0.0 and gets the schema URL
+	// of the target version.
+	rss = request.ResourceSpans[1]
+	assert.Equal(t, "https://example.com/schemas/1.3.0", rss.SchemaUrl)
+	assert.Equal(t, "d", rss.Resource.Attributes[0].Key)
+	assert.Equal(t, "d", rss.ScopeSpans[0].Spans[0].Attributes[0].Key)
+
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+
+	// Data that is already of the target version is not changed.
+	converted := proto.Clone(request).(*otlptracecol.ExportTraceServiceRequest)
+	require.NoError(t, converter.ConvertRequest(converted, schema, &compiled.ChangeLog{}))
+	convertedCopy := proto.Clone(converted)
+	require.NoError(t, converter.ConvertRequest(converted, schema, &compiled.ChangeLog{}))
+	assert.True(t, proto.Equal(converted, convertedCopy))
+
+	// SourceVersion takes precedence over the schema URLs.
+	request = &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				SchemaUrl:  "https://example.com/schemas/1.3.0",
+				ScopeSpans: []*otlptrace.ScopeSpans{{Spans: span("b")}},
+			},
+		},
+	}
+	require.NoError(
+		t, converter.ConvertRequestWithOptions(
+			request, schema, converter.Options{SourceVersion: "1.1.0", TargetVersion: "1.2.0"},
+			&compiled.ChangeLog{},
+		),
+	)
+	assert.Equal(t, "https://example.com/schemas/1.2.0", request.ResourceSpans[0].SchemaUrl)
+	assert.Equal(t, "c", request.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes[0].Key)
+}
+
+func TestConvertMetricRequestSchemaURL(t *testing.T) {
+	schema := chainedRenameSchema(t)
+
+	metric := func(attrName string) []*otlpmetric.Metric {
+		return []*otlpmetric.Metric{
+			{
+				Name: "m",
+				Data: &otlpmetric.Metric_Gauge{
+					Gauge: &otlpmetric.Gauge{
+						DataPoints: []*otlpmetric.NumberDataPoint{
+							{Attributes: []*otlpcommon.KeyValue{strAttr(attrName, "1")}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	request := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{
+				SchemaUrl: "https://example.com/schemas/1.2.0",
+				ScopeMetrics: []*otlpmetric.ScopeMetrics{
+					{Metrics: metric("c")},
+					{SchemaUrl: "https://example.com/schemas/1.0.0", Metrics: metric("a")},
+					{SchemaUrl: "https://example.com/schemas/1.2.0", Metrics: metric("c")},
+				},
+			},
+		},
+	}
+
+	err := converter.ConvertRequestWithOptions(
+		request, schema, converter.Options{TargetVersion: "1.3.0"}, &compiled.ChangeLog{},
+	)
+	require.NoError(t, err)
+
+	rms := request.ResourceMetrics[0]
+	assert.Equal(t, "https://example.com/schemas/1.3.0", rms.SchemaUrl)
+	for i, expectedURL := range []string{
+		"", "https://example.com/schemas/1.3.0", "https://example.com/schemas/1.3.0",
+	} {
+		assert.Equal(t, expectedURL, rms.ScopeMetrics[i].SchemaUrl)
+		attrs := rms.ScopeMetrics[i].Metrics[0].GetGauge().DataPoints[0].Attributes
+		assert.Equal(t, "d", attrs[0].Key)
+	}
+}
+
+func TestConvertRequestUnknownVersion(t *testing.T) {
+	schema := chainedRenameSchema(t)
+
+	span := func(attrName string) []*otlptrace.Span {
+		return []*otlptrace.Span{{Attributes: []*otlpcommon.KeyValue{strAttr(attrName, "1")}}}
+	}
+	request := &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				// Newer than the latest version of the schema.
+				SchemaUrl:  "https://example.com/schemas/1.4.0",
+				Resource:   &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{strAttr("a", "1")}},
+				ScopeSpans: []*otlptrace.ScopeSpans{{Spans: span("a")}},
+			},
+			{
+				// In between the versions of the schema.
+				SchemaUrl:  "https://example.com/schemas/1.1.5",
+				ScopeSpans: []*otlptrace.ScopeSpans{{Spans: span("b")}},
+			},
+		},
+	}
+	requestCopy := proto.Clone(request)
+
+	// Data of unknown versions is left unchanged, including the schema URLs.
+	require.NoError(t, converter.ConvertRequest(request, schema, &compiled.ChangeLog{}))
+	assert.True(t, proto.Equal(request, requestCopy))
+	err := converter.ConvertRequestWithOptions(
+		request, schema, converter.Options{TargetVersion: "1.2.0"}, &compiled.ChangeLog{},
+	)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(request, requestCopy))
+
+	for _, opts := range []converter.Options{
+		{TargetVersion: "1.4.0"},
+		{TargetVersion: "latest"},
+		{SourceVersion: "1.1.5"},
+	} {
+		err := converter.ConvertRequestWithOptions(request, schema, opts, &compiled.ChangeLog{})
+		assert.Error(t, err, "%+v", opts)
+		assert.True(t, proto.Equal(request, requestCopy))
+	}
+	err = converter.ConvertRequestWithOptions(
+		request, schema, converter.Options{TargetVersion: "1.4.0"}, &compiled.ChangeLog{},
+	)
+	assert.EqualError(t, err, "unknown target version 1.4.0")
+}
+
+func TestConvertToLowerVersion(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	resource := &otlpresource.Resource{
+		Attributes: []*otlpcommon.KeyValue{
+			{
+				Key:   "kubernetes.pod.name",
+				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "superpod-123"}},
+			},
+			{
+				Key:   "telemetry.auto_instr.version",
+				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "1.2.3"}},
+			},
+		},
+	}
+	err := schema.ConvertResourceToVersion("1.1.0", "1.0.0", resource, &compiled.ChangeLog{})
+	require.NoError(t, err)
+
+	_, exists := getAttr(resource.Attributes, "k8s.pod.name")
+	assert.True(t, exists)
+	_, exists = getAttr(resource.Attributes, "telemetry.auto.version")
+	assert.True(t, exists)
+
+	spans := []*otlptrace.Span{
+		{
+			Attributes: []*otlpcommon.KeyValue{
+				{
+					Key:   "kubernetes.pod.name",
+					Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "superpod-123"}},
+				},
+				{
+					Key:   "peer.service.name",
+					Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "db"}},
+				},
+			},
+		},
+	}
+	err = schema.ConvertSpansToVersion("1.1.0", "1.0.0", spans, &compiled.ChangeLog{})
+	require.NoError(t, err)
+
+	_, exists = getAttr(spans[0].Attributes, "k8s.pod.name")
+	assert.True(t, exists)
+	_, exists = getAttr(spans[0].Attributes, "peer.service")
+	assert.True(t, exists)
+
+	// Converting back and forth is lossless.
+	err = schema.ConvertSpansToVersion("1.0.0", "1.1.0", spans, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	_, exists = getAttr(spans[0].Attributes, "kubernetes.pod.name")
+	assert.True(t, exists)
+}
+
+func TestConvertToLowerVersionIrreversible(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	// Nothing to convert, nothing that cannot be undone.
+	var metrics []*otlpmetric.Metric
+	err := schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		metric string
+		reason string
+	}{
+		{metric: "system.cpu.time", reason: "to_delta of metrics [system.cpu.time] cannot be undone"},
+		{metric: "cpu.usage.total", reason: "add_attributes cannot be undone"},
+		{metric: "memory.usage.max", reason: "duplicate_attributes cannot be undone"},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.metric, func(t *testing.T) {
+				metrics := []*otlpmetric.Metric{{Name: "unrelated"}, {Name: test.metric}}
+				err := schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+				require.Error(t, err)
+
+				irreversibleErr, ok := err.(*compiled.IrreversibleError)
+				require.True(t, ok)
+				assert.EqualValues(t, "1.1.0", irreversibleErr.VersionNum())
+				var reasons []string
+				for _, a := range irreversibleErr.Actions {
+					assert.Equal(t, compiled.SectionMetrics, a.Section)
+					reasons = append(reasons, a.Reason)
+				}
+				assert.Contains(t, reasons, test.reason)
+			},
+		)
+	}
+
+	// Metrics that no irreversible action applies to are converted.
+	metrics = []*otlpmetric.Metric{
+		{
+			Name: "unrelated",
+			Data: &otlpmetric.Metric_Gauge{
+				Gauge: &otlpmetric.Gauge{
+					DataPoints: []*otlpmetric.NumberDataPoint{
+						{
+							Attributes: []*otlpcommon.KeyValue{
+								strAttr("kubernetes.pod.name", "superpod-123"),
+								strAttr("http.response_status_code", "200"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	err = schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	attrs := metrics[0].GetGauge().DataPoints[0].Attributes
+	_, exists := getAttr(attrs, "k8s.pod.name")
+	assert.True(t, exists)
+	_, exists = getAttr(attrs, "http.status_code")
+	assert.True(t, exists)
+
+	// Conversion to higher version is unaffected.
+	metrics = []*otlpmetric.Metric{{Name: "system.cpu.time"}}
+	err = schema.ConvertMetricsToVersion("1.0.0", "1.1.0", &metrics, &compiled.ChangeLog{})
+	assert.NoError(t, err)
+}
+
+func TestConvertToLowerVersionSplitAndMerge(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	sumDp := func(value int64, attrs ...*otlpcommon.KeyValue) *otlpmetric.NumberDataPoint {
+		return &otlpmetric.NumberDataPoint{Attributes: attrs, Value: &otlpmetric.NumberDataPoint_AsInt{AsInt: value}}
+	}
+	metrics := []*otlpmetric.Metric{
+		{
+			Name:        "system.paging.operations",
+			Description: "paging operations",
+			Data: &otlpmetric.Metric_Sum{
+				Sum: &otlpmetric.Sum{
+					AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints: []*otlpmetric.NumberDataPoint{
+						sumDp(1, strAttr("direction", "in")), sumDp(2, strAttr("direction", "out")),
+					},
+				},
+			},
+		},
+		diskIOMetric("system.disk.io.read", "By", 3),
+		diskIOMetric("system.disk.io.write", "By", 4),
+	}
+	original := make([]*otlpmetric.Metric, len(metrics))
+	for i, metric := range metrics {
+		original[i] = proto.Clone(metric).(*otlpmetric.Metric)
+	}
+
+	err := schema.ConvertMetricsToVersion("1.0.0", "1.1.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "system.paging.operations.in", metrics[0].Name)
+	assert.Equal(t, "system.paging.operations.out", metrics[1].Name)
+	assert.Equal(t, "system.disk.io", metrics[2].Name)
+
+	// The split is undone by merging and the merge by splitting.
+	err = schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, len(original))
+	for i := range original {
+		assert.True(t, proto.Equal(original[i], metrics[i]), "%v != %v", original[i], metrics[i])
+	}
+}
+
+func TestReverseNotInjectiveMerge(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{
+							Merge: &ast.MergeMetric{
+								CreateMetric: "system.disk.io",
+								ByAttribute:  "direction",
+								AttributesForMetrics: map[types.MetricName]types.AttributeValue{
+									"system.disk.io.read":  "rw",
+									"system.disk.io.write": "rw",
+								},
+							},
+						},
+						{RenameMetrics: map[types.MetricName]types.MetricName{"system.disk.io": "disk.io"}},
+					},
+				},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+
+	// The irreversible merge applies to the metric as renamed by the version.
+	metrics := []*otlpmetric.Metric{diskIOMetric("disk.io", "By", 1)}
+	err := schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "merge into metric system.disk.io cannot be undone")
+
+	metrics = []*otlpmetric.Metric{diskIOMetric("system.disk.io.read", "By", 1)}
+	err = schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+	assert.NoError(t, err)
+}
+
+func TestReverseMultiActionEntry(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{
+							RenameMetrics: map[types.MetricName]types.MetricName{"system.disk.io.read": "disk.read"},
+							Merge: &ast.MergeMetric{
+								CreateMetric: "system.disk.io",
+								ByAttribute:  "direction",
+								AttributesForMetrics: map[types.MetricName]types.AttributeValue{
+									"system.disk.io.read":  "read",
+									"system.disk.io.write": "write",
+								},
+							},
+							ToDelta: []types.MetricName{"disk.read"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityError))
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Message, "only rename_metrics is applied")
+
+	metrics := []*otlpmetric.Metric{
+		diskIOMetric("system.disk.io.read", "By", 1),
+		diskIOMetric("system.disk.io.write", "By", 2),
+	}
+	original := make([]*otlpmetric.Metric, len(metrics))
+	for i, metric := range metrics {
+		original[i] = proto.Clone(metric).(*otlpmetric.Metric)
+	}
+
+	// Only the rename is applied and undone, as in the forward direction.
+	err := schema.ConvertMetricsToVersion("1.0.0", "1.1.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "disk.read", metrics[0].Name)
+	assert.Equal(t, "system.disk.io.write", metrics[1].Name)
+
+	err = schema.ConvertMetricsToVersion("1.1.0", "1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, len(original))
+	for i := range original {
+		assert.True(t, proto.Equal(original[i], metrics[i]), "%v != %v", original[i], metrics[i])
+	}
+}
+
+func TestReverseNotInjectiveRename(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Resources: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"a": "c", "b": "c"}},
+					},
+				},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+
+	err := schema.ConvertResourceToVersion("1.1.0", "1.0.0", &otlpresource.Resource{}, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "both a and b are renamed to c")
+
+	// Spans are not affected by the resources section.
+	err = schema.ConvertSpansToVersion("1.1.0", "1.0.0", nil, &compiled.ChangeLog{})
+	assert.NoError(t, err)
+}
+
+func strAttr(key, value string) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{
+		Key:   key,
+		Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func TestLogsSchemaConversion(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	started := &otlplogs.LogRecord{
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr(compiled.LogNameAttribute, "ProcessStarted"),
+			strAttr("process.executable_name", "app"),
+			strAttr("k8s.pod.name", "superpod-123"),
+		},
+	}
+	other := &otlplogs.LogRecord{
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr(compiled.LogNameAttribute, "ProcessStopped"),
+			strAttr("process.executable_name", "app"),
+		},
+	}
+	unnamed := &otlplogs.LogRecord{
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("process.executable_name", "app"),
+		},
+	}
+
+	request := &otlplogscol.ExportLogsServiceRequest{
+		ResourceLogs: []*otlplogs.ResourceLogs{
+			{
+				Resource: &otlpresource.Resource{},
+				ScopeLogs: []*otlplogs.ScopeLogs{
+					{LogRecords: []*otlplogs.LogRecord{started, other, unnamed}},
+				},
+			},
+		},
+	}
+	requestCopy := proto.Clone(request)
+
+	changes := &compiled.ChangeLog{Enabled: true}
+	err := converter.ConvertRequest(request, schema, changes)
+	require.NoError(t, err)
+
+	// The log is renamed and the attribute rename applies to the new log name.
+	v, _ := getAttr(started.Attributes, compiled.LogNameAttribute)
+	assert.Equal(t, "otel.process.started", v.GetStringValue())
+	_, exists := getAttr(started.Attributes, "process.executable.name")
+	assert.True(t, exists)
+	_, exists = getAttr(started.Attributes, "kubernetes.pod.name")
+	assert.True(t, exists)
+
+	// Other logs are not affected by apply_to_logs rule.
+	v, _ = getAttr(other.Attributes, compiled.LogNameAttribute)
+	assert.Equal(t, "ProcessStopped", v.GetStringValue())
+	_, exists = getAttr(other.Attributes, "process.executable_name")
+	assert.True(t, exists)
+	_, exists = getAttr(unnamed.Attributes, "process.executable_name")
+	assert.True(t, exists)
+
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+
+	// Convert back to the old version.
+	err = converter.ConvertRequest(request, schema, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	logs := request.ResourceLogs[0].ScopeLogs[0].LogRecords
+	err = schema.ConvertLogsToVersion("1.1.0", "1.0.0", logs, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(request, requestCopy))
+}
+
+func TestSpanEventsSchemaConversion(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	exceptionEvent := &otlptrace.Span_Event{
+		Name: "exception.stacktrace",
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("peer.service", "db"),
+			strAttr("k8s.pod.name", "superpod-123"),
+		},
+	}
+	otherEvent := &otlptrace.Span_Event{
+		Name: "retry",
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("peer.service", "db"),
+		},
+	}
+	conflictingEvent := &otlptrace.Span_Event{
+		Name: "exception.stacktrace",
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("peer.service", "db"),
+			strAttr("peer.service.name", "db"),
+		},
+	}
+
+	request := &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				Resource: &otlpresource.Resource{},
+				ScopeSpans: []*otlptrace.ScopeSpans{
+					{
+						Spans: []*otlptrace.Span{
+							{Name: "span1", Events: []*otlptrace.Span_Event{exceptionEvent, otherEvent}},
+						},
+					},
+				},
+			},
+		},
+	}
+	requestCopy := proto.Clone(request)
+
+	changes := &compiled.ChangeLog{Enabled: true}
+	err := converter.ConvertRequest(request, schema, changes)
+	require.NoError(t, err)
+
+	assert.Equal(t, "exception.stack_trace", exceptionEvent.Name)
+	_, exists := getAttr(exceptionEvent.Attributes, "peer.service.name")
+	assert.True(t, exists)
+	_, exists = getAttr(exceptionEvent.Attributes, "kubernetes.pod.name")
+	assert.True(t, exists)
+
+	// apply_to_events limits the attribute rename to exception.stack_trace event.
+	assert.Equal(t, "retry", otherEvent.Name)
+	_, exists = getAttr(otherEvent.Attributes, "peer.service")
+	assert.True(t, exists)
+
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+
+	// Conflicting event attribute fails the conversion and is rolled back.
+	span := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	span.Events = append(span.Events, conflictingEvent)
+	requestCopy = proto.Clone(request)
+
+	changes = &compiled.ChangeLog{Enabled: true}
+	err = converter.ConvertRequest(request, schema, changes)
+	require.Error(t, err)
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+
+	// Convert forward and back.
+	span.Events = span.Events[:2]
+	requestCopy = proto.Clone(request)
+	err = converter.ConvertRequest(request, schema, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	err = schema.ConvertSpansToVersion("1.1.0", "1.0.0", []*otlptrace.Span{span}, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(request, requestCopy))
+}
+
 func getAttr(attrs []*otlpcommon.KeyValue, key string) (*otlpcommon.AnyValue, bool) {
 	for _, attr := range attrs {
 		if attr.Key == key {
@@ -51,15 +860,15 @@ func TestResourceSchemaConversion(t *testing.T) {
 	resource.Attributes = []*otlpcommon.KeyValue{
 		{
 			Key:   "unknown-attribute",
-			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{123}},
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 123}},
 		},
 		{
 			Key:   "k8s.cluster.name",
-			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"OnlineShop"}},
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "OnlineShop"}},
 		},
 		{
 			Key:   "telemetry.auto.version",
-			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"1.2.3"}},
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "1.2.3"}},
 		},
 	}
 
@@ -72,7 +881,7 @@ func TestResourceSchemaConversion(t *testing.T) {
 
 	attrVal, exists := getAttr(resource2.Attributes, "unknown-attribute")
 	assert.True(t, exists)
-	assert.EqualValues(t, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{123}}, attrVal)
+	assert.EqualValues(t, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 123}}, attrVal)
 
 	_, exists = getAttr(resource2.Attributes, "k8s.cluster.name")
 	assert.False(t, exists)
@@ -80,7 +889,7 @@ func TestResourceSchemaConversion(t *testing.T) {
 	attrVal, exists = getAttr(resource2.Attributes, "kubernetes.cluster.name")
 	assert.True(t, exists)
 	assert.EqualValues(
-		t, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"OnlineShop"}}, attrVal,
+		t, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "OnlineShop"}}, attrVal,
 	)
 
 	_, exists = getAttr(resource2.Attributes, "telemetry.auto.version")
@@ -89,7 +898,7 @@ func TestResourceSchemaConversion(t *testing.T) {
 	attrVal, exists = getAttr(resource2.Attributes, "telemetry.auto_instr.version")
 	assert.True(t, exists)
 	assert.EqualValues(
-		t, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"1.2.3"}}, attrVal,
+		t, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "1.2.3"}}, attrVal,
 	)
 }
 
@@ -100,18 +909,18 @@ func TestResourceSchemaConversionConflict(t *testing.T) {
 	resource1.Attributes = []*otlpcommon.KeyValue{
 		{
 			Key:   "k8s.cluster.name",
-			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"OnlineShop"}},
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "OnlineShop"}},
 		},
 		{
 			Key:   "telemetry.auto.version",
-			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"1.2.3"}},
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "1.2.3"}},
 		},
 	}
 	resource2 := proto.Clone(resource1).(*otlpresource.Resource)
 	resource2.Attributes = append(
 		resource2.Attributes, &otlpcommon.KeyValue{
 			Key:   "kubernetes.cluster.name", // This should conflict with conversion
-			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{123}},
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 123}},
 		},
 	)
 
@@ -128,7 +937,7 @@ func TestResourceSchemaConversionConflict(t *testing.T) {
 
 	requestCopy := proto.Clone(request)
 
-	changes := &compiled.ChangeLog{}
+	changes := &compiled.ChangeLog{Enabled: true}
 	err := converter.ConvertRequest(request, schema, changes)
 	assert.Error(t, err)
 	assert.False(t, proto.Equal(request, requestCopy))
@@ -137,109 +946,504 @@ func TestResourceSchemaConversionConflict(t *testing.T) {
 	assert.True(t, proto.Equal(request, requestCopy))
 }
 
-/*
-func getLabel(attrs []*otlpcommon.StringKeyValue, key string) (string, bool) {
-	for _, attr := range attrs {
-		if attr.Key == key {
-			return attr.Value, true
+func TestMetricsSchemaConversion(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	dp1 := &otlpmetric.NumberDataPoint{
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("a", "b"),
+			strAttr("http.status_code", "abc"),
+			strAttr("container.name", "redis"),
+		},
+		Exemplars: []*otlpmetric.Exemplar{
+			{FilteredAttributes: []*otlpcommon.KeyValue{strAttr("http.status_code", "abc")}},
+		},
+	}
+	metric1 := &otlpmetric.Metric{
+		Name: "container.cpu.usage.total",
+		Data: &otlpmetric.Metric_Sum{Sum: &otlpmetric.Sum{DataPoints: []*otlpmetric.NumberDataPoint{dp1}}},
+	}
+
+	dp2 := &otlpmetric.NumberDataPoint{
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("c", "d"),
+			strAttr("http.status_code", "abc"),
+			strAttr("status", "234"),
+		},
+	}
+	metric2 := &otlpmetric.Metric{
+		Name: "unknown-metric",
+		Data: &otlpmetric.Metric_Gauge{Gauge: &otlpmetric.Gauge{DataPoints: []*otlpmetric.NumberDataPoint{dp2}}},
+	}
+
+	dp3 := &otlpmetric.NumberDataPoint{
+		Attributes: []*otlpcommon.KeyValue{
+			strAttr("status", "idle"),
+			strAttr("k8s.pod.name", "superpod-123"),
+		},
+	}
+	metric3 := &otlpmetric.Metric{
+		Name: "system.cpu.utilization",
+		Data: &otlpmetric.Metric_Gauge{Gauge: &otlpmetric.Gauge{DataPoints: []*otlpmetric.NumberDataPoint{dp3}}},
+	}
+
+	dp4 := &otlpmetric.HistogramDataPoint{
+		Attributes: []*otlpcommon.KeyValue{strAttr("http.status_code", "200")},
+	}
+	dp5 := &otlpmetric.ExponentialHistogramDataPoint{
+		Attributes: []*otlpcommon.KeyValue{strAttr("http.status_code", "200")},
+	}
+	dp6 := &otlpmetric.SummaryDataPoint{
+		Attributes: []*otlpcommon.KeyValue{strAttr("http.status_code", "200")},
+	}
+	metric4 := &otlpmetric.Metric{
+		Name: "http.duration",
+		Data: &otlpmetric.Metric_Histogram{
+			Histogram: &otlpmetric.Histogram{DataPoints: []*otlpmetric.HistogramDataPoint{dp4}},
+		},
+	}
+	metric5 := &otlpmetric.Metric{
+		Name: "http.duration.exp",
+		Data: &otlpmetric.Metric_ExponentialHistogram{
+			ExponentialHistogram: &otlpmetric.ExponentialHistogram{
+				DataPoints: []*otlpmetric.ExponentialHistogramDataPoint{dp5},
+			},
+		},
+	}
+	metric6 := &otlpmetric.Metric{
+		Name: "http.duration.summary",
+		Data: &otlpmetric.Metric_Summary{
+			Summary: &otlpmetric.Summary{DataPoints: []*otlpmetric.SummaryDataPoint{dp6}},
+		},
+	}
+
+	metrics := []*otlpmetric.Metric{metric1, metric2, metric3, metric4, metric5, metric6}
+	err := schema.ConvertMetricsToLatest("0.0.0", &metrics, &compiled.ChangeLog{})
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, "cpu.usage.total", metric1.Name)
+	v, _ := getAttr(dp1.Attributes, "a")
+	assert.EqualValues(t, "b", v.GetStringValue())
+	v, _ = getAttr(dp1.Attributes, "http.response_status_code")
+	assert.EqualValues(t, "abc", v.GetStringValue())
+	// Added and duplicated attributes.
+	v, _ = getAttr(dp1.Attributes, "status")
+	assert.EqualValues(t, "state", v.GetStringValue())
+	v, _ = getAttr(dp1.Attributes, "plugin_instance")
+	assert.EqualValues(t, "redis", v.GetStringValue())
+	v, _ = getAttr(dp1.Attributes, "container.name")
+	assert.EqualValues(t, "redis", v.GetStringValue())
+	_, exists := getAttr(dp1.Exemplars[0].FilteredAttributes, "http.response_status_code")
+	assert.True(t, exists)
+
+	assert.EqualValues(t, "unknown-metric", metric2.Name)
+	v, _ = getAttr(dp2.Attributes, "c")
+	assert.EqualValues(t, "d", v.GetStringValue())
+	v, _ = getAttr(dp2.Attributes, "http.response_status_code")
+	assert.EqualValues(t, "abc", v.GetStringValue())
+	v, _ = getAttr(dp2.Attributes, "status")
+	assert.EqualValues(t, "234", v.GetStringValue())
+
+	// Rename limited by apply_to_metrics and rename from "all" section.
+	v, _ = getAttr(dp3.Attributes, "state")
+	assert.EqualValues(t, "idle", v.GetStringValue())
+	_, exists = getAttr(dp3.Attributes, "kubernetes.pod.name")
+	assert.True(t, exists)
+
+	for _, attrs := range [][]*otlpcommon.KeyValue{dp4.Attributes, dp5.Attributes, dp6.Attributes} {
+		v, _ = getAttr(attrs, "http.response_status_code")
+		assert.EqualValues(t, "200", v.GetStringValue())
+	}
+}
+
+func findMetric(metrics []*otlpmetric.Metric, name string) *otlpmetric.Metric {
+	for _, metric := range metrics {
+		if metric.Name == name {
+			return metric
 		}
 	}
-	return "", false
+	return nil
 }
 
-func TestMetricsSchemaConversion(t *testing.T) {
-	compiled := compileTestSchema(t)
+func TestMetricSplit(t *testing.T) {
+	schema := compileTestSchema(t)
 
-	var metrics []*otlpmetric.Metric
+	sumDp := func(direction string, value int64) *otlpmetric.NumberDataPoint {
+		return &otlpmetric.NumberDataPoint{
+			Attributes: []*otlpcommon.KeyValue{
+				strAttr("direction", direction),
+				strAttr("http.status_code", "abc"),
+			},
+			Value: &otlpmetric.NumberDataPoint_AsInt{AsInt: value},
+		}
+	}
 
-	metric1 := &otlpmetric.Metric{
-		MetricDescriptor: &otlpmetric.MetricDescriptor{
-			Name: "container.cpu.usage.total",
-			Type: otlpmetric.MetricDescriptor_INT64,
+	metrics := []*otlpmetric.Metric{
+		{Name: "unrelated"},
+		{
+			Name:        "system.paging.operations",
+			Description: "paging operations",
+			Unit:        "{operations}",
+			Data: &otlpmetric.Metric_Sum{
+				Sum: &otlpmetric.Sum{
+					AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints: []*otlpmetric.NumberDataPoint{
+						sumDp("in", 1), sumDp("out", 2), sumDp("in", 3), sumDp("sideways", 4),
+					},
+				},
+			},
 		},
 	}
-	dp1 := &otlpmetric.Int64DataPoint{
-		Labels: []*otlpcommon.StringKeyValue{
-			{Key: "a", Value: "b"},
-			{Key: "http.status_code", Value: "abc"},
-			{Key: "status", Value: "123"},
+	request := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{ScopeMetrics: []*otlpmetric.ScopeMetrics{{Metrics: metrics}}},
 		},
 	}
+	requestCopy := proto.Clone(request)
 
-	metric1.Int64DataPoints = []*otlpmetric.Int64DataPoint{dp1}
-	metrics = []*otlpmetric.Metric{metric1}
+	changes := &compiled.ChangeLog{Enabled: true}
+	err := converter.ConvertRequest(request, schema, changes)
+	require.NoError(t, err)
 
-	metric2 := &otlpmetric.Metric{
-		MetricDescriptor: &otlpmetric.MetricDescriptor{
-			Name: "unknown-metric",
-			Type: otlpmetric.MetricDescriptor_INT64,
-		},
+	metrics = request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 4)
+	assert.Equal(t, "unrelated", metrics[0].Name)
+
+	in := findMetric(metrics, "system.paging.operations.in")
+	require.NotNil(t, in)
+	assert.Equal(t, "paging operations", in.Description)
+	assert.Equal(t, "{operations}", in.Unit)
+	assert.Equal(
+		t, otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, in.GetSum().AggregationTemporality,
+	)
+	assert.True(t, in.GetSum().IsMonotonic)
+	require.Len(t, in.GetSum().DataPoints, 2)
+	assert.EqualValues(t, 1, in.GetSum().DataPoints[0].GetAsInt())
+	assert.EqualValues(t, 3, in.GetSum().DataPoints[1].GetAsInt())
+	for _, dp := range in.GetSum().DataPoints {
+		require.Len(t, dp.Attributes, 1)
+		v, _ := getAttr(dp.Attributes, "http.response_status_code")
+		assert.EqualValues(t, "abc", v.GetStringValue())
 	}
 
-	dp2 := &otlpmetric.Int64DataPoint{
-		Labels: []*otlpcommon.StringKeyValue{
-			{Key: "c", Value: "d"},
-			{Key: "http.status_code", Value: "abc"},
-			{Key: "status", Value: "234"},
+	out := findMetric(metrics, "system.paging.operations.out")
+	require.NotNil(t, out)
+	require.Len(t, out.GetSum().DataPoints, 1)
+	assert.EqualValues(t, 2, out.GetSum().DataPoints[0].GetAsInt())
+
+	// Unmatched data points stay in the original metric.
+	unmatched := findMetric(metrics, "system.paging.operations")
+	require.NotNil(t, unmatched)
+	require.Len(t, unmatched.GetSum().DataPoints, 1)
+	v, _ := getAttr(unmatched.GetSum().DataPoints[0].Attributes, "direction")
+	assert.EqualValues(t, "sideways", v.GetStringValue())
+
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+}
+
+func TestMetricSplitHistogram(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	metrics := []*otlpmetric.Metric{
+		{
+			Name: "system.paging.operations",
+			Data: &otlpmetric.Metric_Histogram{
+				Histogram: &otlpmetric.Histogram{
+					AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints: []*otlpmetric.HistogramDataPoint{
+						{Attributes: []*otlpcommon.KeyValue{strAttr("direction", "out")}, Count: 5},
+					},
+				},
+			},
 		},
 	}
 
-	metric2.Int64DataPoints = []*otlpmetric.Int64DataPoint{dp2}
-	metrics = append(metrics, metric2)
+	err := schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "system.paging.operations.out", metrics[0].Name)
+	assert.Equal(
+		t, otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		metrics[0].GetHistogram().AggregationTemporality,
+	)
+	require.Len(t, metrics[0].GetHistogram().DataPoints, 1)
+	assert.Empty(t, metrics[0].GetHistogram().DataPoints[0].Attributes)
+	assert.EqualValues(t, 5, metrics[0].GetHistogram().DataPoints[0].Count)
+}
 
-	metric3 := &otlpmetric.Metric{
-		MetricDescriptor: &otlpmetric.MetricDescriptor{
-			Name: "system.paging.operations",
-			Type: otlpmetric.MetricDescriptor_INT64,
+func TestMetricSplitNoDataPoints(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	// Metrics without data points are kept.
+	metrics := []*otlpmetric.Metric{
+		{Name: "system.paging.operations"},
+		{Name: "system.paging.operations", Data: &otlpmetric.Metric_Sum{Sum: &otlpmetric.Sum{}}},
+	}
+	err := schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "system.paging.operations", metrics[0].Name)
+	assert.Nil(t, metrics[0].Data)
+	assert.Equal(t, "system.paging.operations", metrics[1].Name)
+	assert.NotNil(t, metrics[1].GetSum())
+}
+
+func mergeTestSchema(t *testing.T) *compiled.Schema {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{
+							Merge: &ast.MergeMetric{
+								CreateMetric: "system.disk.io",
+								ByAttribute:  "direction",
+								AttributesForMetrics: map[types.MetricName]types.AttributeValue{
+									"system.disk.io.read":  "read",
+									"system.disk.io.write": "write",
+								},
+							},
+						},
+					},
+				},
+			},
 		},
 	}
 
-	dp3 := &otlpmetric.Int64DataPoint{
-		Labels: []*otlpcommon.StringKeyValue{
-			{Key: "direction", Value: "in"},
-			{Key: "http.status_code", Value: "abc"},
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+	return schema
+}
+
+func diskIOMetric(name string, unit string, values ...int64) *otlpmetric.Metric {
+	sum := &otlpmetric.Sum{
+		AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		IsMonotonic:            true,
+	}
+	for _, v := range values {
+		sum.DataPoints = append(
+			sum.DataPoints, &otlpmetric.NumberDataPoint{
+				Attributes: []*otlpcommon.KeyValue{strAttr("device", "sda")},
+				Value:      &otlpmetric.NumberDataPoint_AsInt{AsInt: v},
+			},
+		)
+	}
+	return &otlpmetric.Metric{Name: name, Unit: unit, Data: &otlpmetric.Metric_Sum{Sum: sum}}
+}
+
+func TestMetricMerge(t *testing.T) {
+	schema := mergeTestSchema(t)
+
+	scope := &otlpcommon.InstrumentationScope{Name: "hostmetrics"}
+
+	request := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{
+				ScopeMetrics: []*otlpmetric.ScopeMetrics{
+					{
+						Scope: scope,
+						Metrics: []*otlpmetric.Metric{
+							{Name: "unrelated"},
+							diskIOMetric("system.disk.io.read", "By", 1, 2),
+						},
+					},
+					{
+						// Same scope as the first one, the source metrics must be merged together.
+						Scope:   scope,
+						Metrics: []*otlpmetric.Metric{diskIOMetric("system.disk.io.write", "By", 3)},
+					},
+				},
+			},
 		},
 	}
-	dp4 := &otlpmetric.Int64DataPoint{
-		Labels: []*otlpcommon.StringKeyValue{
-			{Key: "direction", Value: "out"},
-			{Key: "http.status_code", Value: "abc"},
+	requestCopy := proto.Clone(request)
+
+	changes := &compiled.ChangeLog{Enabled: true}
+	err := converter.ConvertRequest(request, schema, changes)
+	require.NoError(t, err)
+
+	scopes := request.ResourceMetrics[0].ScopeMetrics
+	require.Len(t, scopes[0].Metrics, 2)
+	assert.Equal(t, "unrelated", scopes[0].Metrics[0].Name)
+	merged := scopes[0].Metrics[1]
+	assert.Equal(t, "system.disk.io", merged.Name)
+	assert.Equal(t, "By", merged.Unit)
+	assert.True(t, merged.GetSum().IsMonotonic)
+
+	dps := merged.GetSum().DataPoints
+	require.Len(t, dps, 3)
+	for i, expected := range []struct {
+		value     int64
+		direction string
+	}{{1, "read"}, {2, "read"}, {3, "write"}} {
+		assert.EqualValues(t, expected.value, dps[i].GetAsInt())
+		v, _ := getAttr(dps[i].Attributes, "direction")
+		assert.EqualValues(t, expected.direction, v.GetStringValue())
+		_, exists := getAttr(dps[i].Attributes, "device")
+		assert.True(t, exists)
+	}
+
+	assert.Empty(t, scopes[1].Metrics)
+
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+}
+
+func TestMetricMergeDifferentScopes(t *testing.T) {
+	schema := mergeTestSchema(t)
+
+	request := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{
+				ScopeMetrics: []*otlpmetric.ScopeMetrics{
+					{
+						Scope:   &otlpcommon.InstrumentationScope{Name: "hostmetrics"},
+						Metrics: []*otlpmetric.Metric{diskIOMetric("system.disk.io.read", "By", 1)},
+					},
+					{
+						Scope:   &otlpcommon.InstrumentationScope{Name: "hostmetrics", Version: "2.0"},
+						Metrics: []*otlpmetric.Metric{diskIOMetric("system.disk.io.write", "By", 2)},
+					},
+				},
+			},
 		},
 	}
 
-	metric3.Int64DataPoints = []*otlpmetric.Int64DataPoint{dp3, dp4}
-	metrics = append(metrics, metric3)
+	err := converter.ConvertRequest(request, schema, &compiled.ChangeLog{})
+	require.NoError(t, err)
 
-	err := compiled.ConvertMetricsToLatest("0.0.0", &metrics)
-	assert.NoError(t, err)
+	// Each scope gets its own merged metric.
+	for i, expected := range []struct {
+		value     int64
+		direction string
+	}{{1, "read"}, {2, "write"}} {
+		metrics := request.ResourceMetrics[0].ScopeMetrics[i].Metrics
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "system.disk.io", metrics[0].Name)
+		dps := metrics[0].GetSum().DataPoints
+		require.Len(t, dps, 1)
+		assert.EqualValues(t, expected.value, dps[0].GetAsInt())
+		v, _ := getAttr(dps[0].Attributes, "direction")
+		assert.EqualValues(t, expected.direction, v.GetStringValue())
+	}
+}
+
+func TestMetricMergeIncompatible(t *testing.T) {
+	schema := mergeTestSchema(t)
+
+	metrics := []*otlpmetric.Metric{
+		diskIOMetric("system.disk.io.read", "By", 1),
+		diskIOMetric("system.disk.io.write", "KiBy", 1),
+	}
+	err := schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unit")
+
+	gauge := &otlpmetric.Metric{
+		Name: "system.disk.io.write",
+		Unit: "By",
+		Data: &otlpmetric.Metric_Gauge{Gauge: &otlpmetric.Gauge{}},
+	}
+	metrics = []*otlpmetric.Metric{diskIOMetric("system.disk.io.read", "By", 1), gauge}
+	err = schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gauge")
+
+	delta := diskIOMetric("system.disk.io.write", "By", 1)
+	delta.GetSum().AggregationTemporality = otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	metrics = []*otlpmetric.Metric{diskIOMetric("system.disk.io.read", "By", 1), delta}
+	err = schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "temporality")
+}
+
+func TestMetricMergeAttributeNotShared(t *testing.T) {
+	schema := mergeTestSchema(t)
+
+	metrics := []*otlpmetric.Metric{diskIOMetric("system.disk.io.read", "By", 1, 2)}
+	err := schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+
+	// Modifying the converted data must not affect other data points or the
+	// data converted later.
+	dps := metrics[0].GetSum().DataPoints
+	v, _ := getAttr(dps[0].Attributes, "direction")
+	v.Value = &otlpcommon.AnyValue_StringValue{StringValue: "modified"}
+	v, _ = getAttr(dps[1].Attributes, "direction")
+	assert.Equal(t, "read", v.GetStringValue())
+
+	metrics = []*otlpmetric.Metric{diskIOMetric("system.disk.io.read", "By", 1)}
+	err = schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	v, _ = getAttr(metrics[0].GetSum().DataPoints[0].Attributes, "direction")
+	assert.Equal(t, "read", v.GetStringValue())
+}
+
+func TestMetricMergeExisting(t *testing.T) {
+	schema := mergeTestSchema(t)
+
+	// Nothing to merge, the metric that exists is left alone.
+	metrics := []*otlpmetric.Metric{diskIOMetric("system.disk.io", "By", 1)}
+	err := schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "system.disk.io", metrics[0].Name)
+
+	metrics = []*otlpmetric.Metric{
+		diskIOMetric("system.disk.io", "By", 1), diskIOMetric("system.disk.io.read", "By", 1),
+	}
+	err = schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "metric system.disk.io already exists")
+}
+
+func TestMetricsSchemaConversionConflict(t *testing.T) {
+	schema := compileTestSchema(t)
+
+	metrics := []*otlpmetric.Metric{
+		{
+			Name: "container.cpu.usage.total",
+			Data: &otlpmetric.Metric_Sum{
+				Sum: &otlpmetric.Sum{
+					DataPoints: []*otlpmetric.NumberDataPoint{
+						{Attributes: []*otlpcommon.KeyValue{strAttr("http.status_code", "200")}},
+					},
+				},
+			},
+		},
+		{
+			Name: "system.cpu.utilization",
+			Data: &otlpmetric.Metric_Gauge{
+				Gauge: &otlpmetric.Gauge{
+					DataPoints: []*otlpmetric.NumberDataPoint{
+						{
+							Attributes: []*otlpcommon.KeyValue{
+								strAttr("status", "idle"),
+								strAttr("state", "idle"), // This should conflict with conversion
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	request := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{ScopeMetrics: []*otlpmetric.ScopeMetrics{{Metrics: metrics}}},
+		},
+	}
+	requestCopy := proto.Clone(request)
+
+	changes := &compiled.ChangeLog{Enabled: true}
+	err := converter.ConvertRequest(request, schema, changes)
+	assert.Error(t, err)
+	assert.False(t, proto.Equal(request, requestCopy))
 
-	assert.EqualValues(t, "cpu.usage.total", metric1.MetricDescriptor.Name)
-	v, _ := getLabel(dp1.Labels, "a")
-	assert.EqualValues(t, "b", v)
-	v, _ = getLabel(dp1.Labels, "http.response_status_code")
-	assert.EqualValues(t, "abc", v)
-	v, _ = getLabel(dp1.Labels, "status")
-	assert.EqualValues(t, "123", v)
-
-	assert.EqualValues(t, "unknown-metric", metric2.MetricDescriptor.Name)
-	v, _ = getLabel(dp2.Labels, "c")
-	assert.EqualValues(t, "d", v)
-	v, _ = getLabel(dp2.Labels, "http.response_status_code")
-	assert.EqualValues(t, "abc", v)
-	v, _ = getLabel(dp2.Labels, "status")
-	assert.EqualValues(t, "234", v)
-
-	assert.EqualValues(t, "system.paging.operations.in", metrics[2].MetricDescriptor.Name)
-	assert.Len(t, metrics[2].Int64DataPoints[0].Labels, 1)
-	v, _ = getLabel(metrics[2].Int64DataPoints[0].Labels, "http.response_status_code")
-	assert.EqualValues(t, "abc", v)
-
-	assert.EqualValues(t, "system.paging.operations.out", metrics[3].MetricDescriptor.Name)
-	assert.Len(t, metrics[3].Int64DataPoints[0].Labels, 1)
-	v, _ = getLabel(metrics[3].Int64DataPoints[0].Labels, "http.response_status_code")
-	assert.EqualValues(t, "abc", v)
-}
-*/
+	changes.Rollback()
+	assert.True(t, proto.Equal(request, requestCopy))
+}
 
 func BenchmarkResourceSchemaConversion(b *testing.B) {
 	b.SkipNow()
@@ -251,15 +1455,15 @@ func BenchmarkResourceSchemaConversion(b *testing.B) {
 		resource.Attributes = []*otlpcommon.KeyValue{
 			{
 				Key:   "k8s.container.name",
-				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{123}},
+				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 123}},
 			},
 			{
 				Key:   "k8s.cluster.name",
-				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"OnlineShop"}},
+				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "OnlineShop"}},
 			},
 			{
 				Key:   "telemetry.auto.version",
-				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"1.2.3"}},
+				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "1.2.3"}},
 			},
 		}
 
@@ -268,7 +1472,7 @@ func BenchmarkResourceSchemaConversion(b *testing.B) {
 				resource.Attributes,
 				&otlpcommon.KeyValue{
 					Key:   "attribute" + strconv.Itoa(j),
-					Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{int64(j)}},
+					Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: int64(j)}},
 				},
 			)
 		}
@@ -283,3 +1487,306 @@ func BenchmarkResourceSchemaConversion(b *testing.B) {
 		assert.NoError(b, err)
 	}
 }
+
+func toDeltaTestSchema(t *testing.T) *compiled.Schema {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{ToDelta: []types.MetricName{"system.cpu.time", "http.server.duration"}},
+					},
+				},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+	return schema
+}
+
+func cumulativeSumRequest(host string, startTime, time uint64, value int64) *otlpmetriccol.ExportMetricsServiceRequest {
+	return &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{
+				Resource: &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{strAttr("host.name", host)}},
+				ScopeMetrics: []*otlpmetric.ScopeMetrics{
+					{
+						Metrics: []*otlpmetric.Metric{
+							{
+								Name: "system.cpu.time",
+								Data: &otlpmetric.Metric_Sum{
+									Sum: &otlpmetric.Sum{
+										AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+										IsMonotonic:            true,
+										DataPoints: []*otlpmetric.NumberDataPoint{
+											{
+												Attributes:        []*otlpcommon.KeyValue{strAttr("state", "idle")},
+												StartTimeUnixNano: startTime,
+												TimeUnixNano:      time,
+												Value:             &otlpmetric.NumberDataPoint_AsInt{AsInt: value},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestMetricToDelta(t *testing.T) {
+	schema := toDeltaTestSchema(t)
+
+	convert := func(request *otlpmetriccol.ExportMetricsServiceRequest) []*otlpmetric.NumberDataPoint {
+		err := converter.ConvertRequest(request, schema, &compiled.ChangeLog{})
+		require.NoError(t, err)
+		sum := request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum()
+		assert.Equal(t, otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.AggregationTemporality)
+		assert.True(t, sum.IsMonotonic)
+		return sum.DataPoints
+	}
+
+	// The first point is a delta over its own start time.
+	dps := convert(cumulativeSumRequest("a", 100, 200, 10))
+	require.Len(t, dps, 1)
+	assert.EqualValues(t, 100, dps[0].StartTimeUnixNano)
+	assert.EqualValues(t, 200, dps[0].TimeUnixNano)
+	assert.EqualValues(t, 10, dps[0].GetAsInt())
+
+	dps = convert(cumulativeSumRequest("a", 100, 300, 25))
+	require.Len(t, dps, 1)
+	assert.EqualValues(t, 200, dps[0].StartTimeUnixNano)
+	assert.EqualValues(t, 300, dps[0].TimeUnixNano)
+	assert.EqualValues(t, 15, dps[0].GetAsInt())
+	v, _ := getAttr(dps[0].Attributes, "state")
+	assert.Equal(t, "idle", v.GetStringValue())
+
+	// Out of order point is dropped.
+	dps = convert(cumulativeSumRequest("a", 100, 250, 20))
+	assert.Empty(t, dps)
+
+	// Another resource is a different time series.
+	dps = convert(cumulativeSumRequest("b", 150, 300, 7))
+	require.Len(t, dps, 1)
+	assert.EqualValues(t, 7, dps[0].GetAsInt())
+
+	// Start time change is a reset.
+	dps = convert(cumulativeSumRequest("a", 350, 400, 4))
+	require.Len(t, dps, 1)
+	assert.EqualValues(t, 350, dps[0].StartTimeUnixNano)
+	assert.EqualValues(t, 4, dps[0].GetAsInt())
+
+	// Decrease of a monotonic sum is a reset. Without start time the interval
+	// is unknown, so the point is dropped.
+	dps = convert(cumulativeSumRequest("a", 0, 500, 1))
+	assert.Empty(t, dps)
+	dps = convert(cumulativeSumRequest("a", 0, 600, 3))
+	require.Len(t, dps, 1)
+	assert.EqualValues(t, 500, dps[0].StartTimeUnixNano)
+	assert.EqualValues(t, 2, dps[0].GetAsInt())
+
+	assert.Equal(t, 2, schema.DeltaStore.Len())
+}
+
+func TestMetricToDeltaHistogram(t *testing.T) {
+	schema := toDeltaTestSchema(t)
+
+	histogram := func(time uint64, count uint64, sum float64, buckets ...uint64) []*otlpmetric.Metric {
+		return []*otlpmetric.Metric{
+			{
+				Name: "http.server.duration",
+				Data: &otlpmetric.Metric_Histogram{
+					Histogram: &otlpmetric.Histogram{
+						AggregationTemporality: otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						DataPoints: []*otlpmetric.HistogramDataPoint{
+							{
+								StartTimeUnixNano: 100,
+								TimeUnixNano:      time,
+								Count:             count,
+								Sum:               &sum,
+								BucketCounts:      buckets,
+								ExplicitBounds:    []float64{10},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	metrics := histogram(200, 3, 30, 2, 1)
+	require.NoError(t, schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{}))
+	require.Len(t, metrics[0].GetHistogram().DataPoints, 1)
+	assert.EqualValues(t, 3, metrics[0].GetHistogram().DataPoints[0].Count)
+
+	metrics = histogram(300, 7, 100, 3, 4)
+	changes := &compiled.ChangeLog{Enabled: true}
+	require.NoError(t, schema.ConvertMetricsToLatest("1.0.0", &metrics, changes))
+	h := metrics[0].GetHistogram()
+	assert.Equal(t, otlpmetric.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, h.AggregationTemporality)
+	require.Len(t, h.DataPoints, 1)
+	assert.EqualValues(t, 200, h.DataPoints[0].StartTimeUnixNano)
+	assert.EqualValues(t, 4, h.DataPoints[0].Count)
+	assert.EqualValues(t, 70, h.DataPoints[0].GetSum())
+	assert.Equal(t, []uint64{1, 3}, h.DataPoints[0].BucketCounts)
+
+	// Rollback restores both the data and the state of the time series, so
+	// converting the same data again gives the same result.
+	changes.Rollback()
+	assert.True(t, proto.Equal(metrics[0], histogram(300, 7, 100, 3, 4)[0]))
+	require.NoError(t, schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{}))
+	assert.EqualValues(t, 4, metrics[0].GetHistogram().DataPoints[0].Count)
+}
+
+func TestMetricAddAndDuplicateAttributes(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{
+							AddAttributes: &ast.AttributeMapForMetrics{
+								ApplyToMetrics: []types.MetricName{"system.disk.io"},
+								AttributeMap:   map[string]string{"unit.kind": "bytes"},
+							},
+						},
+						{
+							DuplicateAttributes: &ast.AttributeMapForMetrics{
+								AttributeMap: map[string]string{"device": "disk.device"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	schema, diags := Compile(ts)
+	require.NoError(t, diags.Err(SeverityWarning))
+
+	metrics := []*otlpmetric.Metric{
+		diskIOMetric("system.disk.io", "By", 1, 2),
+		diskIOMetric("system.disk.operations", "{operations}", 3),
+	}
+	metricsCopy := []*otlpmetric.Metric{
+		proto.Clone(metrics[0]).(*otlpmetric.Metric), proto.Clone(metrics[1]).(*otlpmetric.Metric),
+	}
+
+	changes := &compiled.ChangeLog{Enabled: true}
+	require.NoError(t, schema.ConvertMetricsToLatest("1.0.0", &metrics, changes))
+
+	for _, dp := range metrics[0].GetSum().DataPoints {
+		v, _ := getAttr(dp.Attributes, "unit.kind")
+		assert.Equal(t, "bytes", v.GetStringValue())
+		v, _ = getAttr(dp.Attributes, "disk.device")
+		assert.Equal(t, "sda", v.GetStringValue())
+	}
+	dp := metrics[1].GetSum().DataPoints[0]
+	_, exists := getAttr(dp.Attributes, "unit.kind")
+	assert.False(t, exists)
+	v, _ := getAttr(dp.Attributes, "disk.device")
+	assert.Equal(t, "sda", v.GetStringValue())
+
+	changes.Rollback()
+	assert.True(t, proto.Equal(metrics[0], metricsCopy[0]))
+	assert.True(t, proto.Equal(metrics[1], metricsCopy[1]))
+
+	// Existing attribute with the same value is not a conflict.
+	metrics = []*otlpmetric.Metric{diskIOMetric("system.disk.io", "By", 1)}
+	metrics[0].GetSum().DataPoints[0].Attributes = append(
+		metrics[0].GetSum().DataPoints[0].Attributes, strAttr("unit.kind", "bytes"),
+	)
+	require.NoError(t, schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{}))
+	assert.Len(t, metrics[0].GetSum().DataPoints[0].Attributes, 3)
+
+	// Existing attribute with a different value is a conflict.
+	metrics = []*otlpmetric.Metric{diskIOMetric("system.disk.io", "By", 1)}
+	metrics[0].GetSum().DataPoints[0].Attributes = append(
+		metrics[0].GetSum().DataPoints[0].Attributes, strAttr("disk.device", "sdb"),
+	)
+	err := schema.ConvertMetricsToLatest("1.0.0", &metrics, &compiled.ChangeLog{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "attribute disk.device conflicts")
+}
+
+func TestCompileDiagnostics(t *testing.T) {
+	ts := &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{
+							RenameMetrics: map[types.MetricName]types.MetricName{"a": "b"},
+							ToDelta:       []types.MetricName{"b"},
+						},
+						{},
+					},
+				},
+				Logs: ast.VersionOfLogs{Changes: []ast.LogTranslationAction{{}}},
+			},
+		},
+	}
+
+	schema, diags := Compile(ts)
+	require.NotNil(t, schema)
+	assert.False(t, diags.HasErrors())
+	assert.NoError(t, diags.Err(SeverityError))
+	assert.Error(t, diags.Err(SeverityWarning))
+	assert.Equal(
+		t, Diagnostics{
+			{
+				Severity: SeverityWarning,
+				Version:  "1.1.0",
+				Section:  compiled.SectionMetrics,
+				Message:  "entry 0 sets several actions (rename_metrics, to_delta), only rename_metrics is applied",
+			},
+			{
+				Severity: SeverityWarning,
+				Version:  "1.1.0",
+				Section:  compiled.SectionMetrics,
+				Message:  "entry 1 has no action",
+			},
+			{
+				Severity: SeverityWarning,
+				Version:  "1.1.0",
+				Section:  compiled.SectionLogs,
+				Message:  "entry 0 has no action",
+			},
+		}, diags,
+	)
+	assert.Equal(
+		t, "warning: version 1.1.0, section metrics: entry 1 has no action", diags[1].String(),
+	)
+
+	ts = &ast.Schema{
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.1.0": {
+				Metrics: ast.VersionOfMetrics{
+					Changes: []ast.MetricTranslationAction{
+						{Split: &ast.SplitMetric{ApplyToMetric: "system.memory.usage"}},
+						{
+							Merge: &ast.MergeMetric{
+								CreateMetric: "m",
+								ByAttribute:  "a",
+								AttributesForMetrics: map[types.MetricName]types.AttributeValue{
+									"m1": []interface{}{"not", "scalar"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	schema, diags = Compile(ts)
+	assert.Nil(t, schema)
+	require.True(t, diags.HasErrors())
+	require.Len(t, diags, 2)
+	assert.Equal(t, SeverityError, diags[0].Severity)
+	assert.Contains(t, diags[0].Message, "entry 0: split must set")
+	assert.Contains(t, diags[1].Message, "entry 1: merge into metric m: unsupported attribute value")
+}
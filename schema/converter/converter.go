@@ -1,55 +1,265 @@
 package converter
 
 import (
+	"fmt"
+
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
 	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
 
 	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
 	"github.com/tigrannajaryan/telemetry-schema/schema/otlp"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
-func convertResource(resource *otlpresource.Resource, schema *compiled.Schema, changes *compiled.ChangeLog) error {
-	return schema.ConvertResourceToLatest("0.0.0", resource, changes)
+// Options controls how a request is converted.
+type Options struct {
+	// TargetVersion is the version to convert the request to. If empty the
+	// request is converted to the latest version known to the schema.
+	TargetVersion types.TelemetryVersion
+
+	// SourceVersion is the version of the data of the request. If empty the
+	// version is taken from the schema URLs of the request.
+	SourceVersion types.TelemetryVersion
+}
+
+func (o Options) targetVersion(schema *compiled.Schema) types.TelemetryVersion {
+	if o.TargetVersion != "" {
+		return o.TargetVersion
+	}
+	if latest := schema.LatestVersion(); latest != "" {
+		return latest
+	}
+	return "0.0.0"
+}
+
+// sourceVersion returns the version of the data that has the schema URL. Data
+// without a schema URL is assumed to be of version 0.0.0. Returns false if the
+// data must not be converted because the schema URL is malformed, belongs to
+// a schema family other than the family of the schema or has a version the
+// schema does not know.
+func (o Options) sourceVersion(schemaURL string, schema *compiled.Schema) (types.TelemetryVersion, bool) {
+	if o.SourceVersion != "" {
+		return o.SourceVersion, true
+	}
+	if schemaURL == "" {
+		return "0.0.0", true
+	}
+	family, version, err := types.SplitSchemaURL(schemaURL)
+	if err != nil {
+		return "", false
+	}
+	if schema.SchemaURL != "" {
+		schemaFamily, _, _ := types.SplitSchemaURL(schema.SchemaURL)
+		if family != schemaFamily {
+			return "", false
+		}
+	}
+	if !schema.HasVersion(version) {
+		return "", false
+	}
+	return version, true
+}
+
+// rewriteSchemaURL sets the schema URL of the converted data to the URL of the
+// target version. The schema family is taken from the current URL, or from the
+// schema if the current URL is empty and allowEmpty is false.
+func rewriteSchemaURL(
+	schemaURL *string, allowEmpty bool, schema *compiled.Schema, opts Options, changes *compiled.ChangeLog,
+) {
+	var family string
+	switch {
+	case *schemaURL != "":
+		family, _, _ = types.SplitSchemaURL(*schemaURL)
+	case !allowEmpty && schema.SchemaURL != "":
+		family, _, _ = types.SplitSchemaURL(schema.SchemaURL)
+	default:
+		return
+	}
+
+	newURL := types.JoinSchemaURL(family, opts.targetVersion(schema))
+	if newURL == *schemaURL {
+		return
+	}
+	if changes.Enabled {
+		changes.Append(&schemaURLLog{schemaURL: schemaURL, savedURL: *schemaURL})
+	}
+	*schemaURL = newURL
+}
+
+type schemaURLLog struct {
+	schemaURL *string
+	savedURL  string
+}
+
+func (r *schemaURLLog) Rollback() {
+	*r.schemaURL = r.savedURL
+}
+
+// convertResource converts the resource from the version of its schema URL.
+func convertResource(
+	resource *otlpresource.Resource, schemaURL string, schema *compiled.Schema, opts Options,
+	changes *compiled.ChangeLog,
+) error {
+	if resource == nil {
+		return nil
+	}
+	from, ok := opts.sourceVersion(schemaURL, schema)
+	if !ok {
+		return nil
+	}
+	return schema.ConvertResourceToVersion(from, opts.targetVersion(schema), resource, changes)
+}
+
+// scopeSchemaURL returns the schema URL that applies to the data of the scope.
+// Scopes without a schema URL inherit the schema URL of the resource.
+func scopeSchemaURL(scopeURL, resourceURL string) string {
+	if scopeURL != "" {
+		return scopeURL
+	}
+	return resourceURL
 }
 
 func convertTraceRequest(
-	request *otlptracecol.ExportTraceServiceRequest, schema *compiled.Schema, changes *compiled.ChangeLog,
+	request *otlptracecol.ExportTraceServiceRequest, schema *compiled.Schema, opts Options,
+	changes *compiled.ChangeLog,
 ) error {
 	for _, rss := range request.ResourceSpans {
-		if err := convertResource(rss.Resource, schema, changes); err != nil {
+		if err := convertResource(rss.Resource, rss.SchemaUrl, schema, opts, changes); err != nil {
 			return err
 		}
 
 		for _, ils := range rss.ScopeSpans {
-			if err := schema.ConvertSpansToLatest("0.0.0", ils.Spans, changes); err != nil {
+			from, ok := opts.sourceVersion(scopeSchemaURL(ils.SchemaUrl, rss.SchemaUrl), schema)
+			if !ok {
+				continue
+			}
+			if err := schema.ConvertSpansToVersion(
+				from, opts.targetVersion(schema), ils.Spans, changes,
+			); err != nil {
 				return err
 			}
+			rewriteSchemaURL(&ils.SchemaUrl, true, schema, opts, changes)
+		}
+
+		if _, ok := opts.sourceVersion(rss.SchemaUrl, schema); ok {
+			rewriteSchemaURL(&rss.SchemaUrl, false, schema, opts, changes)
 		}
 	}
 	return nil
 }
 
 func convertMetricRequest(
-	request *otlpmetriccol.ExportMetricsServiceRequest, schema *compiled.Schema, changes *compiled.ChangeLog,
+	request *otlpmetriccol.ExportMetricsServiceRequest, schema *compiled.Schema, opts Options,
+	changes *compiled.ChangeLog,
 ) error {
 	for _, rss := range request.ResourceMetrics {
-		convertResource(rss.Resource, schema, changes)
+		if err := convertResource(rss.Resource, rss.SchemaUrl, schema, opts, changes); err != nil {
+			return err
+		}
+
+		// Scopes of the same version are converted together, so that actions
+		// such as merge can see all of them.
+		var versions []types.TelemetryVersion
+		scopesByVersion := map[types.TelemetryVersion][]*otlpmetric.ScopeMetrics{}
 		for _, ils := range rss.ScopeMetrics {
-			if err := schema.ConvertMetricsToLatest("0.0.0", &ils.Metrics); err != nil {
+			from, ok := opts.sourceVersion(scopeSchemaURL(ils.SchemaUrl, rss.SchemaUrl), schema)
+			if !ok {
+				continue
+			}
+			if _, exists := scopesByVersion[from]; !exists {
+				versions = append(versions, from)
+			}
+			scopesByVersion[from] = append(scopesByVersion[from], ils)
+		}
+
+		for _, from := range versions {
+			scopes := scopesByVersion[from]
+			if err := schema.ConvertScopeMetricsToVersion(
+				from, opts.targetVersion(schema), rss.Resource, scopes, changes,
+			); err != nil {
+				return err
+			}
+			for _, ils := range scopes {
+				rewriteSchemaURL(&ils.SchemaUrl, true, schema, opts, changes)
+			}
+		}
+
+		if _, ok := opts.sourceVersion(rss.SchemaUrl, schema); ok {
+			rewriteSchemaURL(&rss.SchemaUrl, false, schema, opts, changes)
+		}
+	}
+	return nil
+}
+
+func convertLogRequest(
+	request *otlplogscol.ExportLogsServiceRequest, schema *compiled.Schema, opts Options,
+	changes *compiled.ChangeLog,
+) error {
+	for _, rls := range request.ResourceLogs {
+		if err := convertResource(rls.Resource, rls.SchemaUrl, schema, opts, changes); err != nil {
+			return err
+		}
+
+		for _, sls := range rls.ScopeLogs {
+			from, ok := opts.sourceVersion(scopeSchemaURL(sls.SchemaUrl, rls.SchemaUrl), schema)
+			if !ok {
+				continue
+			}
+			if err := schema.ConvertLogsToVersion(
+				from, opts.targetVersion(schema), sls.LogRecords, changes,
+			); err != nil {
 				return err
 			}
+			rewriteSchemaURL(&sls.SchemaUrl, true, schema, opts, changes)
+		}
+
+		if _, ok := opts.sourceVersion(rls.SchemaUrl, schema); ok {
+			rewriteSchemaURL(&rls.SchemaUrl, false, schema, opts, changes)
 		}
 	}
 	return nil
 }
 
+// ConvertRequest converts the request to the latest version known to the schema.
+// The version of the data is taken from the schema URLs of the request, see
+// ConvertRequestWithOptions.
 func ConvertRequest(request otlp.ExportRequest, schema *compiled.Schema, changes *compiled.ChangeLog) error {
+	return ConvertRequestWithOptions(request, schema, Options{}, changes)
+}
+
+// ConvertRequestWithOptions converts the request as specified by opts.
+//
+// The version of the resource data is taken from the schema URL of the resource.
+// The version of the scope data is taken from the schema URL of the scope, or
+// from the schema URL of the resource if the scope has none. Data without a
+// schema URL is assumed to be of version 0.0.0. Data with a malformed schema URL
+// or with a schema URL of a different schema family is left unchanged. So is
+// data with a schema URL of a version the schema does not know, such as a
+// version newer than the latest version of the schema. After conversion the
+// schema URLs are set to the target version.
+//
+// Returns an error if the target or the source version of opts is not one of
+// the versions of the schema.
+func ConvertRequestWithOptions(
+	request otlp.ExportRequest, schema *compiled.Schema, opts Options, changes *compiled.ChangeLog,
+) error {
+	if opts.TargetVersion != "" && !schema.HasVersion(opts.TargetVersion) {
+		return fmt.Errorf("unknown target version %s", opts.TargetVersion)
+	}
+	if opts.SourceVersion != "" && !schema.HasVersion(opts.SourceVersion) {
+		return fmt.Errorf("unknown source version %s", opts.SourceVersion)
+	}
+
 	switch r := request.(type) {
 	case *otlptracecol.ExportTraceServiceRequest:
-		return convertTraceRequest(r, schema, changes)
+		return convertTraceRequest(r, schema, opts, changes)
 	case *otlpmetriccol.ExportMetricsServiceRequest:
-		return convertMetricRequest(r, schema, changes)
+		return convertMetricRequest(r, schema, opts, changes)
+	case *otlplogscol.ExportLogsServiceRequest:
+		return convertLogRequest(r, schema, opts, changes)
 	}
 	return nil
 }
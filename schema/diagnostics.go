@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityWarning is reported for schema entries that are compiled but
+	// may not do what the author intended, for example an entry that sets
+	// several actions of which only one is applied.
+	SeverityWarning Severity = iota + 1
+
+	// SeverityError is reported for schema entries that cannot be compiled.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is a problem found while compiling a schema.
+type Diagnostic struct {
+	Severity Severity
+	// Version is the version the problem is found in. Empty if the problem
+	// is not specific to a version.
+	Version types.TelemetryVersion
+	// Section is the section of the version the problem is found in, one of
+	// compiled.Section* constants. Empty if the problem is not specific to
+	// a section.
+	Section string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.Severity.String())
+	b.WriteString(": ")
+	if d.Version != "" {
+		b.WriteString("version ")
+		b.WriteString(string(d.Version))
+		if d.Section != "" {
+			b.WriteString(", section ")
+			b.WriteString(d.Section)
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// Diagnostics is the list of problems found while compiling a schema.
+type Diagnostics []Diagnostic
+
+// HasErrors returns true if there is a diagnostic with SeverityError.
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity >= SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an error that lists the diagnostics with minSeverity or higher
+// severity. Returns nil if there are no such diagnostics. Use
+// Err(SeverityWarning) to fail on warnings too.
+func (d Diagnostics) Err(minSeverity Severity) error {
+	var msgs []string
+	for _, diag := range d {
+		if diag.Severity >= minSeverity {
+			msgs = append(msgs, diag.String())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// diagnosticReporter adds diagnostics for a version.
+type diagnosticReporter struct {
+	version types.TelemetryVersion
+	diags   *Diagnostics
+}
+
+func (r diagnosticReporter) errorf(section string, format string, args ...interface{}) {
+	r.report(SeverityError, section, format, args...)
+}
+
+func (r diagnosticReporter) warnf(section string, format string, args ...interface{}) {
+	r.report(SeverityWarning, section, format, args...)
+}
+
+func (r diagnosticReporter) report(severity Severity, section string, format string, args ...interface{}) {
+	*r.diags = append(
+		*r.diags, Diagnostic{
+			Severity: severity,
+			Version:  r.version,
+			Section:  section,
+			Message:  fmt.Sprintf(format, args...),
+		},
+	)
+}
@@ -0,0 +1,386 @@
+// Package diff compares two versions of a schema file.
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind string
+
+// Kinds of changes.
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// Change is a difference between two schemas.
+type Change struct {
+	Kind    ChangeKind             `json:"kind"`
+	Version types.TelemetryVersion `json:"version"`
+	// Section is empty if a whole version is added or removed.
+	Section string `json:"section,omitempty"`
+	// Rule is the action of the changed rule, e.g. "rename_metrics" or
+	// "split". Empty if the section is changed in a way that is not specific
+	// to a rule, for example its changes are reordered.
+	Rule string `json:"rule,omitempty"`
+	// Key identifies the rule within the action, e.g. the old name of
+	// a rename or the metric that a split applies to.
+	Key string `json:"key,omitempty"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// Published is true if the change modifies a version that was already
+	// published. Published versions must not change.
+	Published bool `json:"published"`
+}
+
+func (c Change) String() string {
+	var b strings.Builder
+	if c.Section == "" {
+		fmt.Fprintf(&b, "%s version %s", c.Kind, c.Version)
+	} else {
+		fmt.Fprintf(&b, "version %s, section %s: %s ", c.Version, c.Section, c.Kind)
+		if c.Rule == "" {
+			b.WriteString("order or content of changes")
+		} else {
+			b.WriteString(c.Rule)
+			if c.Key != "" {
+				b.WriteString(" " + c.Key)
+			}
+		}
+		switch c.Kind {
+		case Added:
+			writeValue(&b, c.New)
+		case Removed:
+			writeValue(&b, c.Old)
+		case Changed:
+			if c.Old != "" || c.New != "" {
+				fmt.Fprintf(&b, ": %s -> %s", c.Old, c.New)
+			}
+		}
+	}
+	if c.Published {
+		b.WriteString(" (published version)")
+	}
+	return b.String()
+}
+
+func writeValue(b *strings.Builder, value string) {
+	if value != "" {
+		b.WriteString(": " + value)
+	}
+}
+
+// Diff returns the changes from the old schema to the new schema, ordered by
+// version from the latest to the oldest.
+//
+// The versions of the old schema that are not later than the version of the
+// old schema_url are considered published. If the old schema_url does not
+// end with a version then all versions of the old schema are published.
+func Diff(oldSchema, newSchema *ast.Schema) []Change {
+	published := publishedVersion(oldSchema)
+	isPublished := func(version types.TelemetryVersion) bool {
+		if published == nil {
+			return true
+		}
+		v, err := version.Parse()
+		return err != nil || v.Compare(*published) <= 0
+	}
+
+	var changes []Change
+	for _, version := range sortedVersions(oldSchema.Versions, newSchema.Versions) {
+		oldDef, inOld := oldSchema.Versions[version]
+		newDef, inNew := newSchema.Versions[version]
+		switch {
+		case !inNew:
+			changes = append(changes, Change{Kind: Removed, Version: version, Published: isPublished(version)})
+		case !inOld:
+			// Adding a version before a published version changes the
+			// published history.
+			changes = append(changes, Change{Kind: Added, Version: version, Published: isPublished(version)})
+		default:
+			versionChanges := diffVersion(version, oldDef, newDef)
+			for i := range versionChanges {
+				versionChanges[i].Published = isPublished(version)
+			}
+			changes = append(changes, versionChanges...)
+		}
+	}
+	return changes
+}
+
+// publishedVersion returns the version of the schema_url or nil if there is
+// no such version.
+func publishedVersion(schema *ast.Schema) *types.Version {
+	_, version, err := types.SplitSchemaURL(schema.SchemaURL)
+	if err != nil {
+		return nil
+	}
+	parsed, err := version.Parse()
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+// sortedVersions returns the versions found in either map from the latest to
+// the oldest. Versions that are not valid semantic versions are placed last.
+func sortedVersions(m1, m2 map[types.TelemetryVersion]ast.VersionDef) []types.TelemetryVersion {
+	set := map[types.TelemetryVersion]bool{}
+	for v := range m1 {
+		set[v] = true
+	}
+	for v := range m2 {
+		set[v] = true
+	}
+	versions := make([]types.TelemetryVersion, 0, len(set))
+	for v := range set {
+		versions = append(versions, v)
+	}
+	sort.Slice(
+		versions, func(i, j int) bool {
+			vi, erri := versions[i].Parse()
+			vj, errj := versions[j].Parse()
+			if (erri == nil) != (errj == nil) {
+				return erri == nil
+			}
+			if erri == nil {
+				if c := vi.Compare(vj); c != 0 {
+					return c > 0
+				}
+			}
+			return versions[i] < versions[j]
+		},
+	)
+	return versions
+}
+
+// ruleKey identifies a rule of a version.
+type ruleKey struct {
+	rule string
+	key  string
+}
+
+type section struct {
+	name  string
+	value interface{}
+}
+
+// sections returns the sections of the version definition in the order they
+// appear in a schema file.
+func sections(def ast.VersionDef) []section {
+	return []section{
+		{compiled.SectionAll, def.All},
+		{compiled.SectionResources, def.Resources},
+		{compiled.SectionSpans, def.Spans},
+		{compiled.SectionSpanEvents, def.SpanEvents},
+		{compiled.SectionMetrics, def.Metrics},
+		{compiled.SectionLogs, def.Logs},
+	}
+}
+
+func diffVersion(version types.TelemetryVersion, oldDef, newDef ast.VersionDef) []Change {
+	var changes []Change
+	oldSections, newSections := sections(oldDef), sections(newDef)
+	for i := range oldSections {
+		name := oldSections[i].name
+		oldValue, newValue := oldSections[i].value, newSections[i].value
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		oldRules, newRules := sectionRules(oldValue), sectionRules(newValue)
+		sectionChanges := diffRules(oldRules, newRules)
+		if len(sectionChanges) == 0 {
+			sectionChanges = []Change{{Kind: Changed}}
+		}
+		for _, c := range sectionChanges {
+			c.Version = version
+			c.Section = name
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+func diffRules(oldRules, newRules map[ruleKey]string) []Change {
+	keys := make([]ruleKey, 0, len(oldRules)+len(newRules))
+	for k := range oldRules {
+		keys = append(keys, k)
+	}
+	for k := range newRules {
+		if _, exists := oldRules[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(
+		keys, func(i, j int) bool {
+			if keys[i].rule != keys[j].rule {
+				return keys[i].rule < keys[j].rule
+			}
+			return keys[i].key < keys[j].key
+		},
+	)
+
+	var changes []Change
+	for _, k := range keys {
+		oldValue, inOld := oldRules[k]
+		newValue, inNew := newRules[k]
+		c := Change{Rule: k.rule, Key: k.key, Old: oldValue, New: newValue}
+		switch {
+		case !inNew:
+			c.Kind = Removed
+		case !inOld:
+			c.Kind = Added
+		case oldValue != newValue:
+			c.Kind = Changed
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// sectionRules returns the description of each rule of the section.
+func sectionRules(section interface{}) map[ruleKey]string {
+	rules := map[ruleKey]string{}
+	addMap := func(rule string, scope string, m map[string]string) {
+		for from, to := range m {
+			key := from
+			if scope != "" {
+				key += " (" + scope + ")"
+			}
+			rules[ruleKey{rule, key}] = to
+		}
+	}
+
+	switch s := section.(type) {
+	case ast.VersionOfAttributes:
+		for _, action := range s.Changes {
+			if action.RenameAttributes != nil {
+				addMap("rename_attributes", "", *action.RenameAttributes)
+			}
+		}
+
+	case ast.VersionOfSpans:
+		for _, action := range s.Changes {
+			if action.RenameAttributes != nil {
+				addMap("rename_attributes", "", action.RenameAttributes.AttributeMap)
+			}
+		}
+
+	case ast.VersionOfSpanEvents:
+		for _, action := range s.Changes {
+			if action.RenameEvents != nil {
+				addMap("rename_events", "", action.RenameEvents.EventNameMap)
+			}
+			if a := action.RenameAttributes; a != nil {
+				addMap(
+					"rename_attributes",
+					joinScopes(scope("apply_to_spans", a.ApplyToSpans), scope("apply_to_events", a.ApplyToEvents)),
+					a.AttributeMap,
+				)
+			}
+		}
+
+	case ast.VersionOfMetrics:
+		for _, action := range s.Changes {
+			if action.RenameMetrics != nil {
+				addMap("rename_metrics", "", stringMap(action.RenameMetrics))
+			}
+			for rule, a := range map[string]*ast.AttributeMapForMetrics{
+				"rename_attributes":    action.RenameLabels,
+				"add_attributes":       action.AddAttributes,
+				"duplicate_attributes": action.DuplicateAttributes,
+			} {
+				if a != nil {
+					addMap(rule, scope("apply_to_metrics", a.ApplyToMetrics), a.AttributeMap)
+				}
+			}
+			if split := action.Split; split != nil {
+				rules[ruleKey{"split", string(split.ApplyToMetric)}] = fmt.Sprintf(
+					"by_attribute %s, metrics_from_attributes %s",
+					split.ByAttribute, describeMap(stringMap(split.AttributesToMetrics)),
+				)
+			}
+			if merge := action.Merge; merge != nil {
+				rules[ruleKey{"merge", string(merge.CreateMetric)}] = fmt.Sprintf(
+					"by_attribute %s, attributes_for_metrics %s",
+					merge.ByAttribute, describeMap(stringMap(merge.AttributesForMetrics)),
+				)
+			}
+			for _, metric := range action.ToDelta {
+				rules[ruleKey{"to_delta", string(metric)}] = ""
+			}
+		}
+
+	case ast.VersionOfLogs:
+		for _, action := range s.Changes {
+			if action.RenameLogs != nil {
+				addMap("rename_logs", "", stringMap(action.RenameLogs))
+			}
+			if a := action.RenameAttributes; a != nil {
+				addMap("rename_attributes", scope("apply_to_logs", a.ApplyToLogs), a.AttributeMap)
+			}
+		}
+	}
+	return rules
+}
+
+// stringMap converts a map with keys and values of string kinds or
+// types.AttributeValue values to map[string]string.
+func stringMap(m interface{}) map[string]string {
+	result := map[string]string{}
+	v := reflect.ValueOf(m)
+	for _, key := range v.MapKeys() {
+		result[fmt.Sprint(key.Interface())] = fmt.Sprint(v.MapIndex(key).Interface())
+	}
+	return result
+}
+
+func describeMap(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + ": " + m[k]
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// scope describes the list of names that a rule is limited to. Returns an
+// empty string if the list is empty.
+func scope(name string, list interface{}) string {
+	v := reflect.ValueOf(list)
+	if v.Len() == 0 {
+		return ""
+	}
+	names := make([]string, v.Len())
+	for i := range names {
+		names[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	sort.Strings(names)
+	return name + ": " + strings.Join(names, ", ")
+}
+
+func joinScopes(scopes ...string) string {
+	var nonEmpty []string
+	for _, s := range scopes {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return strings.Join(nonEmpty, "; ")
+}
@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+)
+
+func parse(t *testing.T, content string) *ast.Schema {
+	ts, err := schema.ParseBytes("test.yaml", []byte(content))
+	require.NoError(t, err)
+	return ts
+}
+
+func TestDiff(t *testing.T) {
+	oldSchema := parse(
+		t, `
+file_format: 1.1.0
+schema_url: https://example.com/schemas/1.1.0
+versions:
+  1.1.0:
+    metrics:
+      changes:
+        - rename_metrics:
+            a: b
+            c: d
+        - split:
+            apply_to_metric: m
+            by_attribute: state
+            metrics_from_attributes:
+              m.used: used
+    logs:
+      changes:
+        - rename_logs:
+            x: y
+        - rename_logs:
+            y: z
+  1.0.0:
+`,
+	)
+	newSchema := parse(
+		t, `
+file_format: 1.1.0
+schema_url: https://example.com/schemas/1.2.0
+versions:
+  1.2.0:
+    metrics:
+      changes:
+        - to_delta:
+            - m.used
+        - rename_attributes:
+            apply_to_metrics: [m.used]
+            attribute_map:
+              s: state
+  1.1.0:
+    metrics:
+      changes:
+        - rename_metrics:
+            a: e
+            c: d
+            f: g
+    logs:
+      changes:
+        - rename_logs:
+            y: z
+        - rename_logs:
+            x: y
+`,
+	)
+
+	var msgs []string
+	for _, c := range Diff(oldSchema, newSchema) {
+		msgs = append(msgs, c.String())
+	}
+	assert.Equal(
+		t, []string{
+			"added version 1.2.0",
+			"version 1.1.0, section metrics: changed rename_metrics a: b -> e (published version)",
+			"version 1.1.0, section metrics: added rename_metrics f: g (published version)",
+			"version 1.1.0, section metrics: removed split m: " +
+				"by_attribute state, metrics_from_attributes {m.used: used} (published version)",
+			"version 1.1.0, section logs: changed order or content of changes (published version)",
+			"removed version 1.0.0 (published version)",
+		}, msgs,
+	)
+
+	// Changes within a version are reported with the rules.
+	changes := Diff(newSchema, parse(t, "file_format: 1.1.0\nversions:\n  1.2.0:\n  1.1.0:\n"))
+	require.NotEmpty(t, changes)
+	assert.Equal(
+		t, Change{
+			Kind:      Removed,
+			Version:   "1.2.0",
+			Section:   "metrics",
+			Rule:      "rename_attributes",
+			Key:       "s (apply_to_metrics: m.used)",
+			Old:       "state",
+			Published: true,
+		}, changes[0],
+	)
+	assert.Equal(t, "version 1.2.0, section metrics: removed to_delta m.used (published version)", changes[1].String())
+}
+
+func TestDiffUnpublished(t *testing.T) {
+	oldSchema := parse(
+		t, `
+file_format: 1.1.0
+schema_url: https://example.com/schemas/1.0.0
+versions:
+  1.1.0:
+  1.0.0:
+`,
+	)
+	newSchema := parse(
+		t, `
+file_format: 1.1.0
+versions:
+  1.1.0:
+    spans:
+      changes:
+        - rename_attributes:
+            attribute_map:
+              a: b
+  1.0.1:
+  1.0.0:
+  0.9.0:
+`,
+	)
+
+	var msgs []string
+	for _, c := range Diff(oldSchema, newSchema) {
+		msgs = append(msgs, c.String())
+	}
+	assert.Equal(
+		t, []string{
+			"version 1.1.0, section spans: added rename_attributes a: b",
+			"added version 1.0.1",
+			"added version 0.9.0 (published version)",
+		}, msgs,
+	)
+}
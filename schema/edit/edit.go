@@ -0,0 +1,458 @@
+// Package edit implements editing of schema files that keeps the comments,
+// the formatting and the order of the entries of the file.
+//
+// The edits locate the entries to change in the YAML node tree of the file and
+// change only the lines of those entries. The rest of the file is kept byte
+// for byte. Only block style collections can be edited, except for empty flow
+// style collections such as "changes: []".
+package edit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// sectionOrder is the order in which the sections are inserted into a version.
+var sectionOrder = []string{
+	compiled.SectionAll,
+	compiled.SectionResources,
+	compiled.SectionSpans,
+	compiled.SectionSpanEvents,
+	compiled.SectionMetrics,
+	compiled.SectionLogs,
+}
+
+// changeTypes are the types of the changes that can be appended to each section.
+var changeTypes = map[string]reflect.Type{
+	compiled.SectionAll:        reflect.TypeOf(ast.AttributeTranslationAction{}),
+	compiled.SectionResources:  reflect.TypeOf(ast.AttributeTranslationAction{}),
+	compiled.SectionSpans:      reflect.TypeOf(ast.SpanTranslationAction{}),
+	compiled.SectionSpanEvents: reflect.TypeOf(ast.SpanEventTranslationAction{}),
+	compiled.SectionMetrics:    reflect.TypeOf(ast.MetricTranslationAction{}),
+	compiled.SectionLogs:       reflect.TypeOf(ast.LogTranslationAction{}),
+}
+
+// Document is a schema file being edited.
+type Document struct {
+	name    string
+	content []byte
+	doc     *yaml.Node
+}
+
+// Parse parses the schema file content for editing. The name is used in error
+// messages in place of the file name.
+func Parse(name string, content []byte) (*Document, error) {
+	d := &Document{name: name}
+	if err := d.setContent(content); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Bytes returns the edited content.
+func (d *Document) Bytes() []byte {
+	return d.content
+}
+
+// Schema parses the edited content.
+func (d *Document) Schema() (*ast.Schema, error) {
+	return schema.ParseBytes(d.name, d.content)
+}
+
+// SchemaURL returns the value of schema_url or an empty string if there is none.
+func (d *Document) SchemaURL() string {
+	if node := mappingValue(d.doc, "schema_url"); node != nil && node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	return ""
+}
+
+// SetSchemaURL sets schema_url. A missing schema_url is inserted after
+// file_format.
+func (d *Document) SetSchemaURL(schemaURL string) error {
+	keyNode, valueNode := mappingEntry(d.doc, "schema_url")
+	if keyNode == nil {
+		formatKey, formatValue := mappingEntry(d.doc, "file_format")
+		if formatKey == nil {
+			return d.insertMappingEntry(nil, d.doc, 0, "schema_url", schemaURL)
+		}
+		entry, err := encodeLines(map[string]string{"schema_url": schemaURL})
+		if err != nil {
+			return err
+		}
+		entry = indentLines(entry, formatKey.Column-1)
+		lines := d.lines()
+		return d.setLines(insertLines(lines, d.endLine(lines, formatValue)+1, entry))
+	}
+
+	if valueNode.Kind != yaml.ScalarNode || valueNode.Line != keyNode.Line ||
+		valueNode.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return d.errorf(valueNode, "schema_url must be a single line scalar")
+	}
+	encoded, err := encodeLines(schemaURL)
+	if err != nil {
+		return err
+	}
+	lines := d.lines()
+	line := lines[keyNode.Line-1]
+	lines[keyNode.Line-1] = withComment(line[:valueNode.Column-1]+encoded[0], valueNode.LineComment)
+	return d.setLines(lines)
+}
+
+// InsertVersion inserts the version. The versions in a schema file are listed
+// in reverse semver order, so the version is inserted before the first
+// version that precedes it.
+func (d *Document) InsertVersion(version types.TelemetryVersion, def ast.VersionDef) error {
+	parsed, err := version.Parse()
+	if err != nil {
+		return err
+	}
+
+	keyNode, versions := mappingEntry(d.doc, "versions")
+	if keyNode == nil {
+		return d.insertMappingEntry(
+			nil, d.doc, len(d.doc.Content)/2, "versions",
+			map[types.TelemetryVersion]ast.VersionDef{version: def},
+		)
+	}
+	if mappingIndex(versions, string(version)) >= 0 {
+		return fmt.Errorf("version %s already exists", version)
+	}
+
+	index := len(versions.Content) / 2
+	if versions.Kind == yaml.MappingNode {
+		for i := 0; i < len(versions.Content); i += 2 {
+			existing, err := types.ParseVersion(versions.Content[i].Value)
+			if err == nil && existing.Less(parsed) {
+				index = i / 2
+				break
+			}
+		}
+	}
+	return d.insertMappingEntry(keyNode, versions, index, string(version), def)
+}
+
+// AppendChange appends the change to the "changes" of the section of the
+// version. The change must be of the type of the entries of the section, for
+// example ast.MetricTranslationAction for metrics section. The section and its
+// "changes" are inserted if they are missing.
+func (d *Document) AppendChange(version types.TelemetryVersion, section string, change interface{}) error {
+	changeType, exists := changeTypes[section]
+	if !exists {
+		return fmt.Errorf("unknown section %q", section)
+	}
+	if reflect.TypeOf(change) != changeType {
+		return fmt.Errorf("change of %s section must be %v, got %T", section, changeType, change)
+	}
+
+	versionKey, versionDef := mappingEntry(mappingValue(d.doc, "versions"), string(version))
+	if versionKey == nil {
+		return fmt.Errorf("version %s does not exist", version)
+	}
+
+	sectionKey, sectionNode := mappingEntry(versionDef, section)
+	if sectionKey == nil {
+		index := 0
+		for _, s := range sectionOrder {
+			if s == section {
+				break
+			}
+			if i := mappingIndex(versionDef, s); i >= 0 {
+				index = i + 1
+			}
+		}
+		return d.insertMappingEntry(
+			versionKey, versionDef, index, section,
+			map[string][]interface{}{"changes": {change}},
+		)
+	}
+
+	changesKey, changes := mappingEntry(sectionNode, "changes")
+	if changesKey == nil {
+		return d.insertMappingEntry(sectionKey, sectionNode, len(sectionNode.Content)/2, "changes", []interface{}{change})
+	}
+	return d.appendSequenceItem(changesKey, changes, change)
+}
+
+func (d *Document) setContent(content []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return fmt.Errorf("%s: %w", d.name, err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: schema must be a mapping", d.name)
+	}
+	d.content = content
+	d.doc = root.Content[0]
+	return nil
+}
+
+func (d *Document) lines() []string {
+	return strings.Split(string(d.content), "\n")
+}
+
+// setLines replaces the content with the lines. The content is left unchanged
+// if the lines are not valid YAML.
+func (d *Document) setLines(lines []string) error {
+	return d.setContent([]byte(strings.Join(lines, "\n")))
+}
+
+func (d *Document) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d:%d: %s", d.name, node.Line, node.Column, fmt.Sprintf(format, args...))
+}
+
+// insertMappingEntry inserts the key and the value before the entry at the
+// index of the mapping or after the last entry if index is the number of
+// entries. keyNode is the key of the mapping, nil for the document mapping.
+func (d *Document) insertMappingEntry(
+	keyNode *yaml.Node, mapping *yaml.Node, index int, key string, value interface{},
+) error {
+	entry, err := encodeLines(map[string]interface{}{key: value})
+	if err != nil {
+		return err
+	}
+	lines := d.lines()
+
+	if mapping.Kind != yaml.MappingNode || len(mapping.Content) == 0 {
+		return d.insertIntoEmpty(lines, keyNode, mapping, entry)
+	}
+	if mapping.Style&yaml.FlowStyle != 0 {
+		return d.errorf(mapping, "flow style mapping cannot be edited")
+	}
+
+	indent := mapping.Content[0].Column - 1
+	entries := len(mapping.Content) / 2
+	var at int
+	var separate bool
+	if index < entries {
+		at = startLine(lines, mapping.Content[2*index])
+		separate = at > 0 && isBlank(lines[at-1])
+		entry = indentLines(entry, indent)
+		if separate {
+			entry = append(entry, "")
+		}
+	} else {
+		at = d.endLine(lines, mapping) + 1
+		last := startLine(lines, mapping.Content[len(mapping.Content)-2])
+		separate = entries > 1 && last > 0 && isBlank(lines[last-1])
+		entry = indentLines(entry, indent)
+		if separate {
+			entry = append([]string{""}, entry...)
+		}
+	}
+	return d.setLines(insertLines(lines, at, entry))
+}
+
+// appendSequenceItem appends the item to the sequence. keyNode is the key of
+// the sequence.
+func (d *Document) appendSequenceItem(keyNode *yaml.Node, sequence *yaml.Node, item interface{}) error {
+	entry, err := encodeLines([]interface{}{item})
+	if err != nil {
+		return err
+	}
+	lines := d.lines()
+
+	if sequence.Kind != yaml.SequenceNode || len(sequence.Content) == 0 {
+		return d.insertIntoEmpty(lines, keyNode, sequence, entry)
+	}
+	if sequence.Style&yaml.FlowStyle != 0 {
+		return d.errorf(sequence, "flow style sequence cannot be edited")
+	}
+
+	entry = indentLines(entry, sequence.Column-1)
+	last := startLine(lines, sequence.Content[len(sequence.Content)-1])
+	if len(sequence.Content) > 1 && last > 0 && isBlank(lines[last-1]) {
+		entry = append([]string{""}, entry...)
+	}
+	return d.setLines(insertLines(lines, d.endLine(lines, sequence)+1, entry))
+}
+
+// insertIntoEmpty replaces an empty or null value of the key with the entry.
+func (d *Document) insertIntoEmpty(lines []string, keyNode, value *yaml.Node, entry []string) error {
+	if keyNode == nil {
+		return errors.New("empty document cannot be edited")
+	}
+	empty := len(value.Content) == 0 &&
+		(value.Kind == yaml.MappingNode || value.Kind == yaml.SequenceNode ||
+			(value.Kind == yaml.ScalarNode && value.Tag == "!!null"))
+	if !empty || value.Line != keyNode.Line {
+		return d.errorf(value, "value of %q cannot be edited", keyNode.Value)
+	}
+
+	line := lines[keyNode.Line-1]
+	valueStart := value.Column - 1
+	if valueStart > len(line) {
+		valueStart = len(line)
+	}
+	lines[keyNode.Line-1] = withComment(strings.TrimRight(line[:valueStart], " "), value.LineComment)
+	entry = indentLines(entry, keyNode.Column-1+2)
+	return d.setLines(insertLines(lines, keyNode.Line, entry))
+}
+
+// encodeLines returns the lines of the YAML encoding of the value.
+func encodeLines(value interface{}) ([]string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+func indentLines(lines []string, indent int) []string {
+	prefix := strings.Repeat(" ", indent)
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		if line != "" {
+			result[i] = prefix + line
+		}
+	}
+	return result
+}
+
+func insertLines(lines []string, at int, inserted []string) []string {
+	result := make([]string, 0, len(lines)+len(inserted))
+	result = append(result, lines[:at]...)
+	result = append(result, inserted...)
+	return append(result, lines[at:]...)
+}
+
+func withComment(line, comment string) string {
+	if comment == "" {
+		return line
+	}
+	return line + " " + comment
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// startLine returns the 0-based index of the first line of the entry that
+// starts with the node, including the comment lines right above the node that
+// are indented the same as the node.
+func startLine(lines []string, node *yaml.Node) int {
+	start := node.Line - 1
+	indent := strings.Repeat(" ", node.Column-1)
+	for start > 0 {
+		prev := lines[start-1]
+		if !strings.HasPrefix(prev, indent+"#") {
+			break
+		}
+		start--
+	}
+	return start
+}
+
+// endLine returns the 0-based index of the last line of the node. The node
+// ends right before the node that follows it in the document or at the end of
+// the document, not counting the blank and comment lines in between.
+func (d *Document) endLine(lines []string, node *yaml.Node) int {
+	end := len(lines) - 1
+	if next := nodeAfter(d.doc, node); next != nil {
+		end = next.Line - 2
+	}
+	minEnd := lastKnownLine(node)
+	for end > minEnd && (isBlank(lines[end]) || isComment(lines[end])) {
+		end--
+	}
+	if end < minEnd {
+		end = minEnd
+	}
+	return end
+}
+
+// lastKnownLine returns the 0-based index of the last line that the positions
+// of the node and its children show to be part of the node. Multi-line plain
+// and quoted scalars may end after it.
+func lastKnownLine(node *yaml.Node) int {
+	end := node.Line - 1
+	if node.Kind == yaml.ScalarNode && node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		end += strings.Count(strings.TrimSuffix(node.Value, "\n"), "\n") + 1
+	}
+	for _, child := range node.Content {
+		if childEnd := lastKnownLine(child); childEnd > end {
+			end = childEnd
+		}
+	}
+	return end
+}
+
+// nodeAfter returns the node that follows the node and its children in the
+// tree of root or nil if there is none.
+func nodeAfter(root, node *yaml.Node) *yaml.Node {
+	var nodes []*yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		nodes = append(nodes, n)
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	for i, n := range nodes {
+		if n == node {
+			if next := i + countNodes(node); next < len(nodes) {
+				return nodes[next]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// countNodes returns the number of nodes in the tree of the node.
+func countNodes(node *yaml.Node) int {
+	count := 1
+	for _, child := range node.Content {
+		count += countNodes(child)
+	}
+	return count
+}
+
+// mappingEntry returns the key and the value nodes of the key in the mapping
+// node or nils if the node is not a mapping or does not have the key.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if i := mappingIndex(node, key); i >= 0 {
+		return node.Content[2*i], node.Content[2*i+1]
+	}
+	return nil, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(node, key)
+	return value
+}
+
+// mappingIndex returns the index of the entry with the key in the mapping node
+// or -1 if there is no such entry.
+func mappingIndex(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i / 2
+		}
+	}
+	return -1
+}
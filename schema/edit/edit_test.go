@@ -0,0 +1,313 @@
+package edit
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// assertKeepsLines checks that the lines of the original content are found in
+// the edited content in the same order.
+func assertKeepsLines(t *testing.T, original, edited []byte) {
+	editedLines := strings.Split(string(edited), "\n")
+	i := 0
+	for _, line := range strings.Split(string(original), "\n") {
+		for i < len(editedLines) && editedLines[i] != line {
+			i++
+		}
+		if !assert.Less(t, i, len(editedLines), "line %q is not kept", line) {
+			return
+		}
+		i++
+	}
+}
+
+func TestEditExample(t *testing.T) {
+	content, err := ioutil.ReadFile("../testdata/schema-example.yaml")
+	require.NoError(t, err)
+	d, err := Parse("schema-example.yaml", content)
+	require.NoError(t, err)
+
+	require.NoError(t, d.SetSchemaURL("https://example.com/schemas/1.2.0"))
+	require.NoError(t, d.InsertVersion("1.2.0", ast.VersionDef{}))
+	require.NoError(t, d.InsertVersion("1.0.1", ast.VersionDef{}))
+	require.NoError(
+		t, d.AppendChange(
+			"1.2.0", "metrics",
+			ast.MetricTranslationAction{RenameMetrics: map[types.MetricName]types.MetricName{"a": "b"}},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "logs",
+			ast.LogTranslationAction{RenameLogs: map[types.LogName]types.LogName{"c": "d"}},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.0.0", "resources",
+			ast.AttributeTranslationAction{RenameAttributes: &ast.MappingOfAttributes{"e": "f"}},
+		),
+	)
+
+	assertKeepsLines(t, content, d.Bytes())
+
+	ts, err := d.Schema()
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/schemas/1.2.0", ts.SchemaURL)
+	assert.Len(t, ts.Versions, 4)
+	assert.Equal(
+		t, map[types.MetricName]types.MetricName{"a": "b"},
+		ts.Versions["1.2.0"].Metrics.Changes[0].RenameMetrics,
+	)
+	logChanges := ts.Versions["1.1.0"].Logs.Changes
+	assert.Equal(t, map[types.LogName]types.LogName{"c": "d"}, logChanges[len(logChanges)-1].RenameLogs)
+	assert.Equal(
+		t, &ast.MappingOfAttributes{"e": "f"},
+		ts.Versions["1.0.0"].Resources.Changes[0].RenameAttributes,
+	)
+}
+
+func TestEditLayout(t *testing.T) {
+	content := strings.Join(
+		[]string{
+			"file_format: 1.1.0 # format",
+			"versions:",
+			"  # Latest version.",
+			"  1.1.0:",
+			"    logs:",
+			"      changes:",
+			"        - rename_logs:",
+			"            a: b",
+			"",
+			"        - rename_logs:",
+			"            b: c",
+			"    spans:",
+			"      changes: [] # none yet",
+			"  1.0.0:",
+			"",
+		}, "\n",
+	)
+	d, err := Parse("schema.yaml", []byte(content))
+	require.NoError(t, err)
+	assert.Equal(t, "", d.SchemaURL())
+
+	require.NoError(t, d.SetSchemaURL("https://example.com/schemas/1.1.0"))
+	require.NoError(t, d.SetSchemaURL("https://example.com/schemas/1.2.0"))
+	assert.Equal(t, "https://example.com/schemas/1.2.0", d.SchemaURL())
+	require.NoError(t, d.InsertVersion("1.2.0", ast.VersionDef{}))
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "logs",
+			ast.LogTranslationAction{RenameLogs: map[types.LogName]types.LogName{"c": "d"}},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "spans",
+			ast.SpanTranslationAction{
+				RenameAttributes: &ast.RenameSpanAttributes{AttributeMap: map[string]string{"x": "z"}},
+			},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "all",
+			ast.AttributeTranslationAction{RenameAttributes: &ast.MappingOfAttributes{"k": "v"}},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.2.0", "metrics",
+			ast.MetricTranslationAction{ToDelta: []types.MetricName{"m"}},
+		),
+	)
+
+	assert.Equal(
+		t, strings.Join(
+			[]string{
+				"file_format: 1.1.0 # format",
+				"schema_url: https://example.com/schemas/1.2.0",
+				"versions:",
+				"  1.2.0:",
+				"    metrics:",
+				"      changes:",
+				"        - to_delta:",
+				"            - m",
+				"  # Latest version.",
+				"  1.1.0:",
+				"    all:",
+				"      changes:",
+				"        - rename_attributes:",
+				"            k: v",
+				"    logs:",
+				"      changes:",
+				"        - rename_logs:",
+				"            a: b",
+				"",
+				"        - rename_logs:",
+				"            b: c",
+				"",
+				"        - rename_logs:",
+				"            c: d",
+				"    spans:",
+				"      changes: # none yet",
+				"        - rename_attributes:",
+				"            attribute_map:",
+				"              x: z",
+				"  1.0.0:",
+				"",
+			}, "\n",
+		), string(d.Bytes()),
+	)
+}
+
+func TestEditMultiLineScalars(t *testing.T) {
+	content := strings.Join(
+		[]string{
+			"file_format: 1.1.0",
+			"versions:",
+			"  1.1.0:",
+			"    metrics:",
+			"      changes:",
+			"        - rename_metrics:",
+			"            a: \"quoted",
+			"              name\"",
+			"    logs:",
+			"      changes:",
+			"        - rename_logs:",
+			"            b: plain",
+			"              name",
+			"  1.0.0:",
+			"",
+		}, "\n",
+	)
+	d, err := Parse("schema.yaml", []byte(content))
+	require.NoError(t, err)
+
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "metrics",
+			ast.MetricTranslationAction{RenameMetrics: map[types.MetricName]types.MetricName{"c": "d"}},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "logs",
+			ast.LogTranslationAction{RenameLogs: map[types.LogName]types.LogName{"e": "f"}},
+		),
+	)
+
+	assertKeepsLines(t, []byte(content), d.Bytes())
+	ts, err := d.Schema()
+	require.NoError(t, err)
+	assert.Equal(
+		t, []ast.MetricTranslationAction{
+			{RenameMetrics: map[types.MetricName]types.MetricName{"a": "quoted name"}},
+			{RenameMetrics: map[types.MetricName]types.MetricName{"c": "d"}},
+		}, ts.Versions["1.1.0"].Metrics.Changes,
+	)
+	assert.Equal(
+		t, []ast.LogTranslationAction{
+			{RenameLogs: map[types.LogName]types.LogName{"b": "plain name"}},
+			{RenameLogs: map[types.LogName]types.LogName{"e": "f"}},
+		}, ts.Versions["1.1.0"].Logs.Changes,
+	)
+}
+
+func TestEditTrailingComments(t *testing.T) {
+	content := strings.Join(
+		[]string{
+			"file_format: 1.1.0",
+			"# The versions.",
+			"versions:",
+			"  1.1.0:",
+			"    logs:",
+			"      changes:",
+			"        - rename_logs:",
+			"            a: b",
+			"",
+			"        # Comment of the version below.",
+			"",
+			"  1.0.0:",
+			"    logs:",
+			"      changes:",
+			"        - rename_logs:",
+			"            c: d",
+			"# End of file.",
+			"",
+		}, "\n",
+	)
+	d, err := Parse("schema.yaml", []byte(content))
+	require.NoError(t, err)
+
+	require.NoError(t, d.SetSchemaURL("https://example.com/schemas/1.1.0"))
+	require.NoError(
+		t, d.AppendChange(
+			"1.1.0", "logs",
+			ast.LogTranslationAction{RenameLogs: map[types.LogName]types.LogName{"e": "f"}},
+		),
+	)
+	require.NoError(
+		t, d.AppendChange(
+			"1.0.0", "logs",
+			ast.LogTranslationAction{RenameLogs: map[types.LogName]types.LogName{"g": "h"}},
+		),
+	)
+
+	// The comments stay after the inserted lines.
+	assert.Equal(
+		t, strings.Join(
+			[]string{
+				"file_format: 1.1.0",
+				"schema_url: https://example.com/schemas/1.1.0",
+				"# The versions.",
+				"versions:",
+				"  1.1.0:",
+				"    logs:",
+				"      changes:",
+				"        - rename_logs:",
+				"            a: b",
+				"        - rename_logs:",
+				"            e: f",
+				"",
+				"        # Comment of the version below.",
+				"",
+				"  1.0.0:",
+				"    logs:",
+				"      changes:",
+				"        - rename_logs:",
+				"            c: d",
+				"        - rename_logs:",
+				"            g: h",
+				"# End of file.",
+				"",
+			}, "\n",
+		), string(d.Bytes()),
+	)
+}
+
+func TestEditErrors(t *testing.T) {
+	d, err := Parse("schema.yaml", []byte("file_format: 1.1.0\nversions: {1.0.0: {}}\n"))
+	require.NoError(t, err)
+
+	assert.EqualError(t, d.InsertVersion("1.0.0", ast.VersionDef{}), "version 1.0.0 already exists")
+	assert.Error(t, d.InsertVersion("1.0", ast.VersionDef{}))
+	assert.EqualError(t, d.InsertVersion("1.1.0", ast.VersionDef{}), "schema.yaml:2:11: flow style mapping cannot be edited")
+	assert.EqualError(
+		t, d.AppendChange("1.0.0", "traces", ast.SpanTranslationAction{}), `unknown section "traces"`,
+	)
+	assert.EqualError(
+		t, d.AppendChange("1.0.0", "spans", ast.LogTranslationAction{}),
+		"change of spans section must be ast.SpanTranslationAction, got ast.LogTranslationAction",
+	)
+	assert.EqualError(
+		t, d.AppendChange("2.0.0", "spans", ast.SpanTranslationAction{}), "version 2.0.0 does not exist",
+	)
+}
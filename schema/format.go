@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+)
+
+// File formats that the parser accepts.
+const (
+	FileFormat100 = "1.0.0"
+	FileFormat110 = "1.1.0"
+
+	// LatestFileFormat is the format that schemas in older formats are
+	// upgraded to when parsed.
+	LatestFileFormat = FileFormat110
+)
+
+// SupportedFileFormats lists the file formats that the parser accepts, from
+// the oldest to the latest.
+var SupportedFileFormats = []string{FileFormat100, FileFormat110}
+
+// formatKey is a key of the "changes" entries that is valid only in a range of
+// file formats.
+type formatKey struct {
+	section string
+	// path is the path to the key from the change entry.
+	path []string
+	// since is the first format the key is valid in. Empty if the key is
+	// valid in all formats before until.
+	since string
+	// until is the first format the key is not valid in. Empty if the key is
+	// valid in all formats since since.
+	until string
+	// replacement is the key that replaces the key in until format. When
+	// a schema is upgraded to until format the key is renamed to replacement.
+	replacement string
+}
+
+var formatKeys = []formatKey{
+	{section: compiled.SectionMetrics, path: []string{"split"}, since: FileFormat110},
+	{
+		section: compiled.SectionMetrics, path: []string{"rename_attributes", "label_map"},
+		until: FileFormat110, replacement: "attribute_map",
+	},
+	{
+		section: compiled.SectionMetrics, path: []string{"add_attributes", "label_map"},
+		until: FileFormat110, replacement: "attribute_map",
+	},
+	{
+		section: compiled.SectionMetrics, path: []string{"duplicate_attributes", "label_map"},
+		until: FileFormat110, replacement: "attribute_map",
+	},
+}
+
+// formatIndex returns the index of the format in SupportedFileFormats or -1 if
+// the format is not supported.
+func formatIndex(format string) int {
+	for i, f := range SupportedFileFormats {
+		if f == format {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkFileFormat reports a missing or unsupported file_format. Returns the
+// file format and true if it is supported.
+func (p *parser) checkFileFormat(doc *yaml.Node) (string, bool) {
+	supported := strings.Join(SupportedFileFormats, ", ")
+	node := mappingValue(doc, "file_format")
+	if node == nil {
+		p.errorf(doc, "file_format is missing, supported formats are %s", supported)
+		return "", false
+	}
+	if formatIndex(node.Value) < 0 {
+		p.errorf(node, "unsupported file_format %q, supported formats are %s", node.Value, supported)
+		return "", false
+	}
+	return node.Value, true
+}
+
+// checkFormatKeys reports the keys that are not valid in the file format.
+func (p *parser) checkFormatKeys(doc *yaml.Node, format string) {
+	index := formatIndex(format)
+	for _, fk := range formatKeys {
+		for _, entry := range changeEntries(doc, fk.section) {
+			keyNode := entryKey(entry, fk.path)
+			if keyNode == nil {
+				continue
+			}
+			name := strings.Join(fk.path, ".")
+			switch {
+			case fk.since != "" && index < formatIndex(fk.since):
+				p.errorf(keyNode, "%s requires file_format %s or later", name, fk.since)
+			case fk.until != "" && index >= formatIndex(fk.until) && fk.replacement != "":
+				p.errorf(keyNode, "%s is replaced by %s in file_format %s", name, fk.replacement, fk.until)
+			case fk.until != "" && index >= formatIndex(fk.until):
+				p.errorf(keyNode, "%s is not supported since file_format %s", name, fk.until)
+			default:
+				continue
+			}
+			p.reported[keyNode] = true
+		}
+	}
+}
+
+// upgradeFormat upgrades the document in the file format to LatestFileFormat.
+func upgradeFormat(doc *yaml.Node, format string) {
+	for i := formatIndex(format) + 1; i < len(SupportedFileFormats); i++ {
+		for _, fk := range formatKeys {
+			if fk.until != SupportedFileFormats[i] || fk.replacement == "" {
+				continue
+			}
+			for _, entry := range changeEntries(doc, fk.section) {
+				if keyNode := entryKey(entry, fk.path); keyNode != nil {
+					keyNode.Value = fk.replacement
+				}
+			}
+		}
+	}
+	mappingValue(doc, "file_format").Value = LatestFileFormat
+}
+
+// changeEntries returns the entries of "changes" of the section in all
+// versions.
+func changeEntries(doc *yaml.Node, section string) []*yaml.Node {
+	versions := mappingValue(doc, "versions")
+	if versions == nil || versions.Kind != yaml.MappingNode {
+		return nil
+	}
+	var entries []*yaml.Node
+	for i := 1; i < len(versions.Content); i += 2 {
+		changes := mappingValue(mappingValue(versions.Content[i], section), "changes")
+		if changes != nil && changes.Kind == yaml.SequenceNode {
+			entries = append(entries, changes.Content...)
+		}
+	}
+	return entries
+}
+
+// entryKey returns the key node at the path from the node or nil if there is
+// no such key.
+func entryKey(node *yaml.Node, path []string) *yaml.Node {
+	for _, key := range path[:len(path)-1] {
+		node = mappingValue(node, key)
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	last := path[len(path)-1]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == last {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSchemaNotFound is returned (possibly wrapped) by a Loader that does not
+// have the requested schema.
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// MaxSchemaSize is the maximum size of a schema file that loaders read.
+const MaxSchemaSize = 10 << 20
+
+// Loader loads the content of the schema file that is published at the schema URL.
+type Loader interface {
+	// Load returns the content of the schema file. Returns an error that wraps
+	// ErrSchemaNotFound if the loader does not handle the schema URL or the
+	// schema file does not exist.
+	Load(ctx context.Context, schemaURL string) ([]byte, error)
+}
+
+// DirLoader loads schema files from a local directory. The schema URL must
+// start with BaseURL, the rest of the URL path is the path of the file relative
+// to Dir. For example, with BaseURL "https://opentelemetry.io/schemas" and Dir
+// "/etc/schemas" the schema URL "https://opentelemetry.io/schemas/1.1.0" is
+// loaded from "/etc/schemas/1.1.0".
+type DirLoader struct {
+	BaseURL string
+	Dir     string
+}
+
+func (l DirLoader) Load(_ context.Context, schemaURL string) ([]byte, error) {
+	baseURL := strings.TrimSuffix(l.BaseURL, "/") + "/"
+	if !strings.HasPrefix(schemaURL, baseURL) {
+		return nil, fmt.Errorf("%w: %s is not under %s", ErrSchemaNotFound, schemaURL, l.BaseURL)
+	}
+
+	relPath := strings.TrimPrefix(schemaURL, baseURL)
+	for _, segment := range strings.Split(relPath, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("%w: invalid path in schema URL %s", ErrSchemaNotFound, schemaURL)
+		}
+	}
+	return readFile(filepath.Join(l.Dir, filepath.FromSlash(relPath)))
+}
+
+// FileLoader loads schema files from file:// schema URLs.
+type FileLoader struct{}
+
+func (FileLoader) Load(_ context.Context, schemaURL string) ([]byte, error) {
+	u, err := url.Parse(schemaURL)
+	if err != nil || u.Scheme != "file" {
+		return nil, fmt.Errorf("%w: %s is not a file URL", ErrSchemaNotFound, schemaURL)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file URL %s must not specify a remote host", schemaURL)
+	}
+	return readFile(filepath.FromSlash(u.Path))
+}
+
+func readFile(fileName string) ([]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %v", ErrSchemaNotFound, err)
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return readLimited(f, fileName)
+}
+
+func readLimited(r io.Reader, name string) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, MaxSchemaSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxSchemaSize {
+		return nil, fmt.Errorf("schema %s is larger than %d bytes", name, MaxSchemaSize)
+	}
+	return content, nil
+}
+
+// HTTPLoader loads schema files from http:// and https:// schema URLs.
+type HTTPLoader struct {
+	// Client is the client used to fetch schema files. If nil then
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (l HTTPLoader) Load(ctx context.Context, schemaURL string) ([]byte, error) {
+	u, err := url.Parse(schemaURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%w: %s is not an HTTP URL", ErrSchemaNotFound, schemaURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, schemaURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, fmt.Errorf("%w: GET %s: %s", ErrSchemaNotFound, schemaURL, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("GET %s: %s", schemaURL, resp.Status)
+	}
+	return readLimited(resp.Body, schemaURL)
+}
@@ -1,13 +1,16 @@
 package otlp
 
 import (
+	"fmt"
 	"math/rand"
 	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
 	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
 	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
 )
@@ -63,7 +66,7 @@ func (g *Generator) GenResource() *otlpresource.Resource {
 			},
 			{
 				Key:   "telemetry.auto.version",
-				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{"1.2.3"}},
+				Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "1.2.3"}},
 			},
 		},
 	}
@@ -194,51 +197,87 @@ func (g *Generator) GenerateSpanBatch(
 	return batch
 }
 
-func (g *Generator) GenerateLogBatch(logsPerBatch int, attrsPerLog int) ExportRequest {
-	/*
-		traceID := atomic.AddUint64(&g.tracesSent, 1)
-
-		batch := &ExportLogsServiceRequest{ResourceLogs: []*ResourceLogs{{Resource: GenResource()}}}
-		for i := 0; i < logsPerBatch; i++ {
-			startTime := time.Date(2019, 10, 31, 10, 11, 12, 13, time.UTC)
-
-			spanID := atomic.AddUint64(&g.spansSent, 1)
-
-			// Create a log.
-			log := &Log{
-				TraceId:      GenerateTraceID(traceID),
-				SpanId:       GenerateSpanID(spanID),
-				TimeUnixnano: TimeToTimestamp(startTime.Add(time.Duration(i) * time.Millisecond)),
-				EventType:    "auto_generated_event",
-				Body: &AttributeValue{
-					Type:        AttributeValueType_STRING,
-					StringValue: fmt.Sprintf("Log message %d of %d, traceid=%q, spanid=%q", i, logsPerBatch, traceID, spanID),
+func (g *Generator) GenerateLogBatch(logsPerBatch int, attrsPerLog int) *otlplogscol.ExportLogsServiceRequest {
+	traceID := atomic.AddUint64(&g.tracesSent, 1)
+
+	sl := &otlplogs.ScopeLogs{
+		Scope: &otlpcommon.InstrumentationScope{Name: "io.opentelemetry"},
+	}
+	batch := &otlplogscol.ExportLogsServiceRequest{
+		ResourceLogs: []*otlplogs.ResourceLogs{
+			{
+				Resource:  g.GenResource(),
+				ScopeLogs: []*otlplogs.ScopeLogs{sl},
+			},
+		},
+	}
+
+	for i := 0; i < logsPerBatch; i++ {
+		startTime := time.Date(2019, 10, 31, 10, 11, 12, 13, time.UTC)
+
+		spanID := atomic.AddUint64(&g.spansSent, 1)
+
+		// Create a log.
+		log := &otlplogs.LogRecord{
+			TraceId:      GenerateTraceID(traceID),
+			SpanId:       GenerateSpanID(spanID),
+			TimeUnixNano: TimeToTimestamp(startTime.Add(time.Duration(i) * time.Millisecond)),
+			Body: &otlpcommon.AnyValue{
+				Value: &otlpcommon.AnyValue_StringValue{
+					StringValue: fmt.Sprintf(
+						"Log message %d of %d, traceid=%q, spanid=%q", i, logsPerBatch, traceID, spanID,
+					),
 				},
+			},
+		}
+
+		if attrsPerLog >= 0 {
+			// Append attributes.
+			log.Attributes = []*otlpcommon.KeyValue{}
+
+			if attrsPerLog >= 2 {
+				log.Attributes = append(
+					log.Attributes,
+					&otlpcommon.KeyValue{
+						Key:   "load_generator.span_seq_num",
+						Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: int64(spanID)}},
+					},
+				)
+				log.Attributes = append(
+					log.Attributes,
+					&otlpcommon.KeyValue{
+						Key:   "load_generator.trace_seq_num",
+						Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: int64(traceID)}},
+					},
+				)
 			}
 
-			if attrsPerLog >= 0 {
-				// Append attributes.
-				log.Attributes = []*KeyValue{}
+			m := map[string]bool{}
+			for _, attr := range log.Attributes {
+				m[attr.Key] = true
+			}
 
-				if attrsPerLog >= 2 {
-					log.Attributes = append(log.Attributes,
-						&KeyValue{Key: "load_generator.span_seq_num", Type: AttributeKeyValue_INT, IntValue: int64(spanID)})
-					log.Attributes = append(log.Attributes,
-						&KeyValue{Key: "load_generator.trace_seq_num", Type: AttributeKeyValue_INT, IntValue: int64(traceID)})
+			for j := len(log.Attributes); j < attrsPerLog; {
+				attrName := GenRandAttrName(g.random)
+				if m[attrName] {
+					continue
 				}
+				m[attrName] = true
+				j++
 
-				for j := len(log.Attributes); j < attrsPerLog; j++ {
-					attrName := GenRandAttrName(g.random)
-					log.Attributes = append(log.Attributes,
-						&KeyValue{Key: attrName, Type: AttributeKeyValue_STRING, StringValue: g.genRandByteString(g.random.Intn(20) + 1)})
-				}
+				log.Attributes = append(
+					log.Attributes,
+					&otlpcommon.KeyValue{
+						Key:   attrName,
+						Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: g.genRandByteString(g.random.Intn(20) + 1)}},
+					},
+				)
 			}
-
-			batch.ResourceLogs[0].Logs = append(batch.ResourceLogs[0].Logs, log)
 		}
-		return batch
-	*/
-	return nil
+
+		sl.LogRecords = append(sl.LogRecords, log)
+	}
+	return batch
 }
 
 /*
@@ -0,0 +1,193 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/jsonpb"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+)
+
+// idSizes are the sizes in bytes of the OTLP/JSON fields that hold trace and
+// span IDs. Unlike other bytes fields, which are base64 encoded, IDs are hex
+// encoded.
+var idSizes = map[string]int{
+	"traceId":      16,
+	"spanId":       8,
+	"parentSpanId": 8,
+}
+
+// MarshalJSON encodes the request, or another OTLP message such as a response,
+// in OTLP/JSON: fields are lowerCamelCase, trace and span IDs are hex strings,
+// 64 bit integers are decimal strings and enums are integers.
+func MarshalJSON(request ExportRequest) ([]byte, error) {
+	var buf bytes.Buffer
+	marshaler := jsonpb.Marshaler{EnumsAsInts: true}
+	if err := marshaler.Marshal(&buf, request); err != nil {
+		return nil, err
+	}
+	return rewriteIDs(buf.Bytes(), base64ToHex)
+}
+
+// WriteJSON writes the request to w in OTLP/JSON followed by a newline.
+func WriteJSON(w io.Writer, request ExportRequest) error {
+	data, err := MarshalJSON(request)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// UnmarshalJSON decodes the OTLP/JSON encoded data into request. Unknown
+// fields are ignored.
+func UnmarshalJSON(data []byte, request ExportRequest) error {
+	data, err := rewriteIDs(data, hexToBase64)
+	if err != nil {
+		return err
+	}
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	return unmarshaler.Unmarshal(bytes.NewReader(data), request)
+}
+
+// ReadJSON reads the OTLP/JSON encoded request from r.
+func ReadJSON(r io.Reader, request ExportRequest) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return UnmarshalJSON(data, request)
+}
+
+// UnmarshalJSONRequest decodes the OTLP/JSON encoded trace, metric or log
+// export request. The type of the request is detected from its top-level
+// field.
+func UnmarshalJSONRequest(data []byte) (ExportRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var request ExportRequest
+	switch {
+	case fields["resourceSpans"] != nil:
+		request = &otlptracecol.ExportTraceServiceRequest{}
+	case fields["resourceMetrics"] != nil:
+		request = &otlpmetriccol.ExportMetricsServiceRequest{}
+	case fields["resourceLogs"] != nil:
+		request = &otlplogscol.ExportLogsServiceRequest{}
+	default:
+		return nil, errors.New("not an export request, resourceSpans, resourceMetrics or resourceLogs is missing")
+	}
+	if err := UnmarshalJSON(data, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func base64ToHex(field, value string) (string, error) {
+	id, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func hexToBase64(field, value string) (string, error) {
+	id, err := hex.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	if len(id) != 0 && len(id) != idSizes[field] {
+		return "", fmt.Errorf("invalid %s %q: must be %d bytes long", field, value, idSizes[field])
+	}
+	return base64.StdEncoding.EncodeToString(id), nil
+}
+
+// rewriteIDs returns the JSON data with the string values of the ID fields
+// replaced by convert. The order of the fields is kept, whitespace is removed.
+func rewriteIDs(data []byte, convert func(field, value string) (string, error)) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	// containers holds the number of keys and values written to each open
+	// object or array.
+	type container struct {
+		object bool
+		count  int
+	}
+	var containers []container
+	var out bytes.Buffer
+	key := ""
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			containers = containers[:len(containers)-1]
+			out.WriteRune(rune(delim))
+			continue
+		}
+
+		isKey, isValue := false, false
+		if len(containers) > 0 {
+			top := &containers[len(containers)-1]
+			switch {
+			case top.object && top.count%2 == 1:
+				out.WriteByte(':')
+				isValue = true
+			case top.count > 0:
+				out.WriteByte(',')
+				isKey = top.object
+			default:
+				isKey = top.object
+			}
+			top.count++
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			containers = append(containers, container{object: t == '{'})
+			out.WriteRune(rune(t))
+		case string:
+			if isKey {
+				key = t
+			} else if _, isID := idSizes[key]; isID && isValue {
+				if t, err = convert(key, t); err != nil {
+					return nil, err
+				}
+			}
+			writeJSONString(&out, t)
+		case json.Number:
+			out.WriteString(t.String())
+		case bool:
+			fmt.Fprint(&out, t)
+		case nil:
+			out.WriteString("null")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func writeJSONString(out *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string cannot fail.
+	_ = encoder.Encode(s)
+	// Remove the newline added by Encode.
+	out.Truncate(out.Len() - 1)
+}
@@ -0,0 +1,165 @@
+package otlp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const spanJSON = `{"resourceSpans":[{"scopeSpans":[{"spans":[{` +
+	`"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0102030405060708",` +
+	`"parentSpanId":"1112131415161718","name":"<span>","kind":3,"startTimeUnixNano":"1234567890123456789",` +
+	`"attributes":[{"key":"spanId","value":{"stringValue":"not an ID"}},{"key":"n","value":{"intValue":"-5"}}]` +
+	`}]}]}]}`
+
+func testSpanRequest() *otlptracecol.ExportTraceServiceRequest {
+	return &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				ScopeSpans: []*otlptrace.ScopeSpans{
+					{
+						Spans: []*otlptrace.Span{
+							{
+								TraceId:           []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+								SpanId:            []byte{1, 2, 3, 4, 5, 6, 7, 8},
+								ParentSpanId:      []byte{0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18},
+								Name:              "<span>",
+								Kind:              otlptrace.Span_SPAN_KIND_CLIENT,
+								StartTimeUnixNano: 1234567890123456789,
+								Attributes: []*otlpcommon.KeyValue{
+									{
+										Key: "spanId",
+										Value: &otlpcommon.AnyValue{
+											Value: &otlpcommon.AnyValue_StringValue{StringValue: "not an ID"},
+										},
+									},
+									{
+										Key:   "n",
+										Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: -5}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := MarshalJSON(testSpanRequest())
+	require.NoError(t, err)
+	assert.Equal(t, spanJSON, string(data))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, testSpanRequest()))
+	assert.Equal(t, spanJSON+"\n", buf.String())
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	request := &otlptracecol.ExportTraceServiceRequest{}
+	require.NoError(t, UnmarshalJSON([]byte(spanJSON), request))
+	assert.True(t, proto.Equal(testSpanRequest(), request))
+
+	// Whitespace and unknown fields are allowed.
+	request = &otlptracecol.ExportTraceServiceRequest{}
+	content := `{"resourceSpans": [{"scopeSpans": [{"spans": [{"spanId": "0102030405060708", "unknown": [1, {}]}]}]}]}`
+	require.NoError(t, ReadJSON(bytes.NewReader([]byte(content)), request))
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, request.ResourceSpans[0].ScopeSpans[0].Spans[0].SpanId)
+
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{
+			content: `{"resourceSpans":[{"scopeSpans":[{"spans":[{"traceId":"xyz"}]}]}]}`,
+			err:     `invalid traceId "xyz": encoding/hex: invalid byte: U+0078 'x'`,
+		},
+		{
+			content: `{"resourceSpans":[{"scopeSpans":[{"spans":[{"spanId":"0102"}]}]}]}`,
+			err:     `invalid spanId "0102": must be 8 bytes long`,
+		},
+		{
+			content: `{"resourceSpans":[`,
+			err:     "unexpected EOF",
+		},
+	}
+	for _, test := range tests {
+		err := UnmarshalJSON([]byte(test.content), &otlptracecol.ExportTraceServiceRequest{})
+		require.Error(t, err)
+		assert.Equal(t, test.err, err.Error())
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	gen := NewGenerator()
+	metrics := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetrics.ResourceMetrics{
+			{
+				Resource: gen.GenResource(),
+				ScopeMetrics: []*otlpmetrics.ScopeMetrics{
+					{
+						Metrics: []*otlpmetrics.Metric{
+							{
+								Name: "requests",
+								Data: &otlpmetrics.Metric_Sum{
+									Sum: &otlpmetrics.Sum{
+										AggregationTemporality: otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+										IsMonotonic:            true,
+										DataPoints: []*otlpmetrics.NumberDataPoint{
+											{
+												TimeUnixNano: 1234567890123456789,
+												Value:        &otlpmetrics.NumberDataPoint_AsInt{AsInt: 1 << 62},
+												Exemplars: []*otlpmetrics.Exemplar{
+													{
+														TraceId: GenerateTraceID(1),
+														SpanId:  GenerateSpanID(2),
+														Value:   &otlpmetrics.Exemplar_AsDouble{AsDouble: 0.5},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	requests := []ExportRequest{
+		gen.GenerateSpanBatch(10, 5, 2),
+		metrics,
+		gen.GenerateLogBatch(10, 5),
+	}
+	for _, request := range requests {
+		data, err := MarshalJSON(request)
+		require.NoError(t, err)
+
+		decoded, err := UnmarshalJSONRequest(data)
+		require.NoError(t, err)
+		assert.IsType(t, request, decoded)
+		assert.True(t, proto.Equal(request, decoded), string(data))
+	}
+
+	data, err := MarshalJSON(requests[2])
+	require.NoError(t, err)
+	log := requests[2].(*otlplogscol.ExportLogsServiceRequest).ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, GenerateTraceID(2), log.TraceId)
+	assert.Contains(t, string(data), `"traceId":"0200000000000000f0debc0a78563412","spanId":"0b00000000000000"`)
+
+	_, err = UnmarshalJSONRequest([]byte(`{"resource":{}}`))
+	assert.EqualError(t, err, "not an export request, resourceSpans, resourceMetrics or resourceLogs is missing")
+}
@@ -1,24 +1,299 @@
 package schema
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 
 	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
+// ParseError is an error at a position in a schema file. Line and Column are
+// 1-based, zero if unknown.
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	var pos []string
+	if e.File != "" {
+		pos = append(pos, e.File)
+	}
+	if e.Line > 0 {
+		pos = append(pos, strconv.Itoa(e.Line))
+		if e.Column > 0 {
+			pos = append(pos, strconv.Itoa(e.Column))
+		}
+	}
+	if len(pos) == 0 {
+		return e.Msg
+	}
+	return strings.Join(pos, ":") + ": " + e.Msg
+}
+
+// ParseErrors is the list of errors found in a schema file, ordered by position.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ParseOptions controls how a schema is parsed.
+type ParseOptions struct {
+	// Strict enables reporting of keys that do not correspond to any field of
+	// the schema. Such keys are ignored if Strict is false.
+	Strict bool
+}
+
+// Parse parses the schema file.
 func Parse(schemaFile string) (*ast.Schema, error) {
-	var ts ast.Schema
+	return ParseWithOptions(schemaFile, ParseOptions{})
+}
+
+// ParseWithOptions parses the schema file as specified by opts.
+func ParseWithOptions(schemaFile string, opts ParseOptions) (*ast.Schema, error) {
 	schemaContent, err := ioutil.ReadFile(schemaFile)
 	if err != nil {
 		return nil, err
 	}
+	return ParseBytesWithOptions(schemaFile, schemaContent, opts)
+}
+
+// ParseReader parses the schema read from r. The name is used in error messages
+// in place of the file name.
+func ParseReader(name string, r io.Reader) (*ast.Schema, error) {
+	return ParseReaderWithOptions(name, r, ParseOptions{})
+}
 
-	err = yaml.Unmarshal(schemaContent, &ts)
+// ParseReaderWithOptions parses the schema read from r as specified by opts.
+func ParseReaderWithOptions(name string, r io.Reader, opts ParseOptions) (*ast.Schema, error) {
+	schemaContent, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
+	return ParseBytesWithOptions(name, schemaContent, opts)
+}
+
+// ParseBytes parses the schema content. The name is used in error messages in
+// place of the file name. Errors found in the content are returned as
+// ParseErrors.
+func ParseBytes(name string, schemaContent []byte) (*ast.Schema, error) {
+	return ParseBytesWithOptions(name, schemaContent, ParseOptions{})
+}
+
+// ParseBytesWithOptions parses the schema content as specified by opts. If the
+// content is valid YAML but does not match the schema file format, the schema
+// is returned along with the ParseErrors. Entries that cannot be decoded are
+// missing from it.
+func ParseBytesWithOptions(name string, schemaContent []byte, opts ParseOptions) (*ast.Schema, error) {
+	p := parser{file: name, reported: map[*yaml.Node]bool{}}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(schemaContent, &root); err != nil {
+		p.yamlError(err)
+		return nil, p.errs
+	}
+
+	var ts ast.Schema
+	if len(root.Content) == 0 {
+		// Empty file.
+		return &ts, nil
+	}
+	doc := root.Content[0]
+
+	if doc.Kind == yaml.MappingNode {
+		if format, ok := p.checkFileFormat(doc); ok {
+			p.checkFormatKeys(doc, format)
+			upgradeFormat(doc, format)
+		}
+	}
 
+	if err := doc.Decode(&ts); err != nil {
+		p.yamlError(err)
+	}
+	p.checkSchema(doc)
+	if opts.Strict {
+		p.checkKnownKeys(doc, reflect.TypeOf(ts))
+	}
+
+	if len(p.errs) > 0 {
+		sort.SliceStable(
+			p.errs, func(i, j int) bool {
+				if p.errs[i].Line != p.errs[j].Line {
+					return p.errs[i].Line < p.errs[j].Line
+				}
+				return p.errs[i].Column < p.errs[j].Column
+			},
+		)
+		return &ts, p.errs
+	}
 	return &ts, nil
 }
+
+type parser struct {
+	file string
+	errs ParseErrors
+	// reported are the key nodes that errors are already reported for.
+	reported map[*yaml.Node]bool
+}
+
+func (p *parser) errorf(node *yaml.Node, format string, args ...interface{}) {
+	p.errs = append(
+		p.errs, &ParseError{
+			File:   p.file,
+			Line:   node.Line,
+			Column: node.Column,
+			Msg:    fmt.Sprintf(format, args...),
+		},
+	)
+}
+
+var yamlErrorRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError converts an error returned by the yaml package to ParseErrors.
+func (p *parser) yamlError(err error) {
+	msgs := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		msgs = typeErr.Errors
+	}
+	for _, msg := range msgs {
+		parseErr := &ParseError{File: p.file, Msg: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlErrorRegexp.FindStringSubmatch(msg); m != nil {
+			parseErr.Line, _ = strconv.Atoi(m[1])
+			parseErr.Msg = m[2]
+		}
+		p.errs = append(p.errs, parseErr)
+	}
+}
+
+// mappingValue returns the value of the key in the mapping node or nil if the
+// node is not a mapping or does not have the key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// actionTypes are the types of the entries of "changes" in each section.
+var actionTypes = map[string]reflect.Type{
+	"all":         reflect.TypeOf(ast.AttributeTranslationAction{}),
+	"resources":   reflect.TypeOf(ast.AttributeTranslationAction{}),
+	"spans":       reflect.TypeOf(ast.SpanTranslationAction{}),
+	"span_events": reflect.TypeOf(ast.SpanEventTranslationAction{}),
+	"metrics":     reflect.TypeOf(ast.MetricTranslationAction{}),
+	"logs":        reflect.TypeOf(ast.LogTranslationAction{}),
+}
+
+// checkSchema reports the errors that the yaml decoder does not detect.
+func (p *parser) checkSchema(doc *yaml.Node) {
+	if doc.Kind != yaml.MappingNode {
+		p.errorf(doc, "schema must be a mapping")
+		return
+	}
+
+	versions := mappingValue(doc, "versions")
+	if versions == nil || versions.Kind != yaml.MappingNode {
+		return
+	}
+
+	type parsedVersion struct {
+		version types.Version
+		node    *yaml.Node
+	}
+	var parsed []parsedVersion
+	for i := 0; i+1 < len(versions.Content); i += 2 {
+		keyNode, versionNode := versions.Content[i], versions.Content[i+1]
+
+		version, err := types.ParseVersion(keyNode.Value)
+		if err != nil {
+			p.errorf(keyNode, "%v", err)
+		} else {
+			for _, prev := range parsed {
+				if prev.version.Compare(version) == 0 {
+					p.errorf(
+						keyNode, "version %s has the same precedence as version %s at line %d",
+						keyNode.Value, prev.node.Value, prev.node.Line,
+					)
+				}
+			}
+			parsed = append(parsed, parsedVersion{version: version, node: keyNode})
+		}
+
+		p.checkVersion(versionNode)
+	}
+}
+
+func (p *parser) checkVersion(versionNode *yaml.Node) {
+	for section, actionType := range actionTypes {
+		changes := mappingValue(mappingValue(versionNode, section), "changes")
+		if changes == nil || changes.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		knownActions := yamlFieldNames(actionType)
+		for _, item := range changes.Content {
+			if item.Kind != yaml.MappingNode || len(item.Content) == 0 {
+				continue
+			}
+			known := false
+			for i := 0; i < len(item.Content); i += 2 {
+				if knownActions[item.Content[i].Value] {
+					known = true
+					break
+				}
+			}
+			if !known {
+				p.errorf(item.Content[0], "unknown action %q in %s section", item.Content[0].Value, section)
+			}
+		}
+	}
+}
+
+// yamlFieldNames returns the keys that the yaml decoder maps to the fields of
+// the struct type.
+func yamlFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := yamlFieldName(t.Field(i)); ok {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// yamlFieldName returns the key that the yaml decoder maps to the struct field.
+// Returns false if the decoder ignores the field.
+func yamlFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, true
+}
@@ -1,9 +1,16 @@
 package schema
 
 import (
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
 )
 
 func TestParseSchema(t *testing.T) {
@@ -11,3 +18,195 @@ func TestParseSchema(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, ts)
 }
+
+func TestParseReader(t *testing.T) {
+	f, err := os.Open("testdata/schema-example.yaml")
+	require.NoError(t, err)
+	defer f.Close()
+
+	ts, err := ParseReader("schema-example.yaml", f)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", ts.FileFormat)
+	assert.Contains(t, ts.Versions, types.TelemetryVersion("1.1.0"))
+	// Versions without changes are kept.
+	assert.Contains(t, ts.Versions, types.TelemetryVersion("1.0.0"))
+
+	ts, err = ParseBytes("empty.yaml", nil)
+	require.NoError(t, err)
+	assert.Empty(t, ts.Versions)
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	content := strings.Join(
+		[]string{
+			"file_format: 1.0.0",
+			"versions:",
+			"  1.0.0:",
+			"  1.1:",
+			"    metrics:",
+			"      changes:",
+			"        - rename_metrics:",
+			"            a: b",
+			"        - renam_metrics:",
+			"            a: b",
+			"  1.0.0+build:",
+			"    spans:",
+			"      changes: 5",
+		}, "\n",
+	)
+
+	ts, err := ParseBytes("schema.yaml", []byte(content))
+	require.Error(t, err)
+
+	// The rest of the schema is still parsed.
+	require.NotNil(t, ts)
+	assert.Len(t, ts.Versions["1.1"].Metrics.Changes, 2)
+
+	var parseErrs ParseErrors
+	require.ErrorAs(t, err, &parseErrs)
+	require.Len(t, parseErrs, 4)
+
+	assert.Equal(t, "schema.yaml", parseErrs[0].File)
+	assert.Equal(t, 4, parseErrs[0].Line)
+	assert.Equal(t, 3, parseErrs[0].Column)
+	assert.Contains(t, parseErrs[0].Error(), `schema.yaml:4:3: invalid version "1.1"`)
+
+	assert.Equal(t, `schema.yaml:9:11: unknown action "renam_metrics" in metrics section`, parseErrs[1].Error())
+
+	assert.Equal(
+		t, "schema.yaml:11:3: version 1.0.0+build has the same precedence as version 1.0.0 at line 3",
+		parseErrs[2].Error(),
+	)
+
+	assert.Equal(t, 13, parseErrs[3].Line)
+	assert.Contains(t, parseErrs[3].Error(), "cannot unmarshal")
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	ts, err := ParseBytes("schema.yaml", []byte("versions:\n  1.0.0: [\n"))
+	require.Error(t, err)
+	assert.Nil(t, ts)
+	var parseErrs ParseErrors
+	require.ErrorAs(t, err, &parseErrs)
+	require.Len(t, parseErrs, 1)
+	assert.Equal(t, "schema.yaml", parseErrs[0].File)
+	assert.NotZero(t, parseErrs[0].Line)
+	assert.True(t, strings.HasPrefix(err.Error(), "schema.yaml:"))
+}
+
+func TestParseStrict(t *testing.T) {
+	// Non-strict mode ignores unknown keys.
+	ts, err := Parse("testdata/schema-misspelled.yaml")
+	require.NoError(t, err)
+	assert.Empty(t, ts.Versions["1.1.0"].Metrics.Changes[0].Split.ByAttribute)
+
+	_, err = ParseWithOptions("testdata/schema-misspelled.yaml", ParseOptions{Strict: true})
+	require.Error(t, err)
+	var parseErrs ParseErrors
+	require.ErrorAs(t, err, &parseErrs)
+
+	var msgs []string
+	for _, parseErr := range parseErrs {
+		msgs = append(msgs, parseErr.Error())
+	}
+	assert.Equal(
+		t, []string{
+			`testdata/schema-misspelled.yaml:9:13: unknown key "by_label", did you mean "by_attribute"?`,
+			`testdata/schema-misspelled.yaml:10:13: unknown key "labels_to_metrics", ` +
+				`did you mean "metrics_from_attributes"?`,
+			`testdata/schema-misspelled.yaml:14:13: unknown key "apply_to_metric", did you mean "apply_to_metrics"?`,
+			`testdata/schema-misspelled.yaml:21:13: unknown key "atribute_map", did you mean "attribute_map"?`,
+			`testdata/schema-misspelled.yaml:23:5: unknown key "logz", did you mean "logs"?`,
+		}, msgs,
+	)
+
+	// The bundled example uses only known keys.
+	_, err = ParseWithOptions("testdata/schema-example.yaml", ParseOptions{Strict: true})
+	assert.NoError(t, err)
+}
+
+func TestParseFileFormats(t *testing.T) {
+	// Format 1.0.0 is upgraded to the latest format.
+	content := strings.Join(
+		[]string{
+			"file_format: 1.0.0",
+			"versions:",
+			"  1.1.0:",
+			"    metrics:",
+			"      changes:",
+			"        - rename_attributes:",
+			"            label_map:",
+			"              status: state",
+			"  1.0.0:",
+		}, "\n",
+	)
+	ts, err := ParseBytesWithOptions("schema.yaml", []byte(content), ParseOptions{Strict: true})
+	require.NoError(t, err)
+	assert.Equal(t, LatestFileFormat, ts.FileFormat)
+	assert.Equal(
+		t, map[string]string{"status": "state"},
+		ts.Versions["1.1.0"].Metrics.Changes[0].RenameLabels.AttributeMap,
+	)
+
+	tests := []struct {
+		name    string
+		content []string
+		err     string
+	}{
+		{
+			name:    "missing",
+			content: []string{"versions:", "  1.0.0:"},
+			err:     "schema.yaml:1:1: file_format is missing, supported formats are 1.0.0, 1.1.0",
+		},
+		{
+			name:    "unsupported",
+			content: []string{"file_format: 2.0.0", "versions:", "  1.0.0:"},
+			err:     `schema.yaml:1:14: unsupported file_format "2.0.0", supported formats are 1.0.0, 1.1.0`,
+		},
+		{
+			name: "split in 1.0.0",
+			content: []string{
+				"file_format: 1.0.0",
+				"versions:",
+				"  1.1.0:",
+				"    metrics:",
+				"      changes:",
+				"        - split:",
+				"            apply_to_metric: system.memory.usage",
+			},
+			err: "schema.yaml:6:11: split requires file_format 1.1.0 or later",
+		},
+		{
+			name: "label_map in 1.1.0",
+			content: []string{
+				"file_format: 1.1.0",
+				"versions:",
+				"  1.1.0:",
+				"    metrics:",
+				"      changes:",
+				"        - rename_attributes:",
+				"            label_map:",
+				"              status: state",
+			},
+			err: "schema.yaml:7:13: rename_attributes.label_map is replaced by attribute_map in file_format 1.1.0",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				content := []byte(strings.Join(test.content, "\n"))
+				_, err := ParseBytesWithOptions("schema.yaml", content, ParseOptions{Strict: true})
+				require.Error(t, err)
+				assert.Equal(t, test.err, err.Error())
+			},
+		)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	known := yamlFields(reflect.TypeOf(ast.MetricTranslationAction{}))
+	assert.Equal(t, `, did you mean "rename_metrics"?`, suggestKey("rename_metric", known))
+	assert.Equal(t, `, did you mean "rename_attributes"?`, suggestKey("rename_labels", known))
+	assert.Equal(t, `, did you mean "to_delta"?`, suggestKey("TO_DELTA", known))
+	assert.Equal(t, "", suggestKey("completely_different", known))
+}
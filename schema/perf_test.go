@@ -25,7 +25,7 @@ var batchTypes = []struct {
 	name     string
 	batchGen func(gen *otlp.Generator) otlp.ExportRequest
 }{
-	//{name: "Logs", batchGen: generateLogBatches},
+	{name: "Logs", batchGen: generateLogBatches},
 	{name: "Spans", batchGen: generateAttrBatches},
 	//{name: "Trace/Events", batchGen: generateTimedEventBatches},
 	//{name: "Metric/Int64", batchGen: generateMetricInt64Batches},
@@ -99,7 +99,8 @@ func BenchmarkConvertSchema(b *testing.B) {
 	ast, err := Parse("testdata/schema-example.yaml")
 	require.NoError(b, err)
 
-	schema := Compile(ast)
+	schema, diags := Compile(ast)
+	require.NoError(b, diags.Err(SeverityWarning))
 
 	for _, batchType := range batchTypes {
 		withChangeLogs := []bool{false, true}
@@ -173,12 +174,9 @@ func BenchmarkMap(b *testing.B) {
 			m := map[string]string{}
 			m[strconv.Itoa(j)] = "def"
 			l := 0
-			for k, v := range m {
+			for range m {
 				l++
-				k = v
-				k = k
 			}
-			l = l
 		}
 	}
 }
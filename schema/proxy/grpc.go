@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// Register registers the OTLP trace, metric and log services of the proxy with
+// the gRPC server.
+func (p *Proxy) Register(server grpc.ServiceRegistrar) {
+	otlptracecol.RegisterTraceServiceServer(server, &traceServer{proxy: p})
+	otlpmetriccol.RegisterMetricsServiceServer(server, &metricsServer{proxy: p})
+	otlplogscol.RegisterLogsServiceServer(server, &logsServer{proxy: p})
+}
+
+type traceServer struct {
+	otlptracecol.UnimplementedTraceServiceServer
+	proxy *Proxy
+}
+
+func (s *traceServer) Export(
+	ctx context.Context, request *otlptracecol.ExportTraceServiceRequest,
+) (*otlptracecol.ExportTraceServiceResponse, error) {
+	response, err := s.proxy.export(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(*otlptracecol.ExportTraceServiceResponse), nil
+}
+
+type metricsServer struct {
+	otlpmetriccol.UnimplementedMetricsServiceServer
+	proxy *Proxy
+}
+
+func (s *metricsServer) Export(
+	ctx context.Context, request *otlpmetriccol.ExportMetricsServiceRequest,
+) (*otlpmetriccol.ExportMetricsServiceResponse, error) {
+	response, err := s.proxy.export(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(*otlpmetriccol.ExportMetricsServiceResponse), nil
+}
+
+type logsServer struct {
+	otlplogscol.UnimplementedLogsServiceServer
+	proxy *Proxy
+}
+
+func (s *logsServer) Export(
+	ctx context.Context, request *otlplogscol.ExportLogsServiceRequest,
+) (*otlplogscol.ExportLogsServiceResponse, error) {
+	response, err := s.proxy.export(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(*otlplogscol.ExportLogsServiceResponse), nil
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/otlp"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+
+	// maxBodySize is the maximum size of an uncompressed request body.
+	maxBodySize = 32 << 20
+)
+
+// httpStatuses maps the gRPC codes of errors to the HTTP status codes of the
+// OTLP/HTTP responses. 429, 503 and 504 tell clients to retry later. Codes not
+// listed map to 500.
+var httpStatuses = map[codes.Code]int{
+	codes.InvalidArgument:   http.StatusBadRequest,
+	codes.Unauthenticated:   http.StatusUnauthorized,
+	codes.PermissionDenied:  http.StatusForbidden,
+	codes.Unimplemented:     http.StatusNotFound,
+	codes.ResourceExhausted: http.StatusTooManyRequests,
+	codes.Unavailable:       http.StatusServiceUnavailable,
+	codes.DeadlineExceeded:  http.StatusGatewayTimeout,
+}
+
+// Handler returns the OTLP/HTTP handler of the proxy. It serves /v1/traces,
+// /v1/metrics and /v1/logs. Request bodies are binary protobuf or JSON encoded,
+// optionally gzip compressed. Responses use the encoding of the request.
+func (p *Proxy) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(
+		"/v1/traces", p.exportHandler(func() otlp.ExportRequest { return &otlptracecol.ExportTraceServiceRequest{} }),
+	)
+	mux.Handle(
+		"/v1/metrics",
+		p.exportHandler(func() otlp.ExportRequest { return &otlpmetriccol.ExportMetricsServiceRequest{} }),
+	)
+	mux.Handle(
+		"/v1/logs", p.exportHandler(func() otlp.ExportRequest { return &otlplogscol.ExportLogsServiceRequest{} }),
+	)
+	return mux
+}
+
+func (p *Proxy) exportHandler(newRequest func() otlp.ExportRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+			http.Error(
+				w, fmt.Sprintf("Content-Type must be %s or %s", contentTypeProtobuf, contentTypeJSON),
+				http.StatusUnsupportedMediaType,
+			)
+			return
+		}
+
+		body, httpStatus, err := readBody(r)
+		if err != nil {
+			writeError(w, contentType, httpStatus, err)
+			return
+		}
+
+		request := newRequest()
+		if contentType == contentTypeJSON {
+			err = otlp.UnmarshalJSON(body, request)
+		} else {
+			err = proto.Unmarshal(body, request)
+		}
+		if err != nil {
+			writeError(w, contentType, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "invalid body: %v", err))
+			return
+		}
+
+		response, err := p.export(r.Context(), request)
+		if err != nil {
+			httpStatus, exists := httpStatuses[status.Code(err)]
+			if !exists {
+				httpStatus = http.StatusInternalServerError
+			}
+			writeError(w, contentType, httpStatus, err)
+			return
+		}
+		writeMessage(w, contentType, http.StatusOK, response)
+	}
+}
+
+// readBody returns the uncompressed body of the request. On failure returns the
+// HTTP status code of the response.
+func readBody(r *http.Request) ([]byte, int, error) {
+	var body io.Reader = r.Body
+	switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip":
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "invalid gzip body: %v", err)
+		}
+		defer reader.Close()
+		body = reader
+	default:
+		return nil, http.StatusUnsupportedMediaType, status.Errorf(
+			codes.InvalidArgument, "unsupported Content-Encoding %q, must be gzip", encoding,
+		)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "cannot read body: %v", err)
+	}
+	if len(content) > maxBodySize {
+		return nil, http.StatusRequestEntityTooLarge, status.Errorf(
+			codes.InvalidArgument, "body is larger than %d bytes", maxBodySize,
+		)
+	}
+	return content, http.StatusOK, nil
+}
+
+// writeError writes the gRPC status of err as the body of the response.
+func writeError(w http.ResponseWriter, contentType string, httpStatus int, err error) {
+	writeMessage(w, contentType, httpStatus, status.Convert(err).Proto())
+}
+
+func writeMessage(w http.ResponseWriter, contentType string, httpStatus int, message proto.Message) {
+	var content []byte
+	var err error
+	if contentType == contentTypeJSON {
+		content, err = otlp.MarshalJSON(message)
+	} else {
+		content, err = proto.Marshal(message)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(content)
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/otlp"
+)
+
+func post(p *Proxy, path, contentType, contentEncoding string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("Content-Encoding", contentEncoding)
+	w := httptest.NewRecorder()
+	p.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+// jsonBody decodes the JSON body of the response.
+func jsonBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	return body
+}
+
+func TestHTTPProtobuf(t *testing.T) {
+	up := &upstream{}
+	p, _ := startProxy(t, up, Options{})
+
+	body, err := proto.Marshal(traceRequest("k8s.node.name"))
+	require.NoError(t, err)
+	w := post(p, "/v1/traces", "application/x-protobuf", "gzip", gzipped(t, body))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-protobuf", w.Header().Get("Content-Type"))
+
+	response := &otlptracecol.ExportTraceServiceResponse{}
+	require.NoError(t, proto.Unmarshal(w.Body.Bytes(), response))
+	assert.Nil(t, response.PartialSuccess)
+
+	received := up.receivedRequests()
+	require.Len(t, received, 1)
+	traces := received[0].(*otlptracecol.ExportTraceServiceRequest)
+	assert.Equal(t, schemaURL110, traces.ResourceSpans[0].SchemaUrl)
+	assert.Equal(t, "kubernetes.node.name", traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes[0].Key)
+}
+
+func TestHTTPJSON(t *testing.T) {
+	up := &upstream{}
+	p, _ := startProxy(t, up, Options{})
+
+	logs := `{"resourceLogs":[{"schemaUrl":"https://opentelemetry.io/schemas/1.0.0","scopeLogs":[{"logRecords":[{` +
+		`"traceId":"0102030405060708090a0b0c0d0e0f10","attributes":[{"key":"k8s.pod.name","value":{"stringValue":"v"}}]` +
+		`}]}]}]}`
+	w := post(p, "/v1/logs", "application/json; charset=utf-8", "", []byte(logs))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, jsonBody(t, w))
+
+	metrics := `{"resourceMetrics":[{"schemaUrl":"https://opentelemetry.io/schemas/1.0.0","scopeMetrics":[{` +
+		`"metrics":[{"name":"container.cpu.usage.total","gauge":{"dataPoints":[{"asInt":"1"}]}}]}]}]}`
+	w = post(p, "/v1/metrics", "application/json", "gzip", gzipped(t, []byte(metrics)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	received := up.receivedRequests()
+	require.Len(t, received, 2)
+	record := received[0].(*otlplogscol.ExportLogsServiceRequest).ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, "kubernetes.pod.name", record.Attributes[0].Key)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, record.TraceId)
+}
+
+func TestHTTPPartialSuccess(t *testing.T) {
+	up := &upstream{}
+	p, _ := startProxy(t, up, Options{ErrorPolicy: DropOnError})
+
+	body, err := otlp.MarshalJSON(traceRequest("k8s.pod.name", "kubernetes.pod.name"))
+	require.NoError(t, err)
+	w := post(p, "/v1/traces", "application/json", "", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(
+		t, map[string]interface{}{
+			"partialSuccess": map[string]interface{}{
+				"rejectedSpans": "2",
+				"errorMessage":  "cannot convert the request: attribute kubernetes.pod.name conflicts",
+			},
+		}, jsonBody(t, w),
+	)
+	assert.Empty(t, up.receivedRequests())
+}
+
+func TestHTTPErrors(t *testing.T) {
+	up := &upstream{}
+	p, _ := startProxy(t, up, Options{})
+	conflicting, err := otlp.MarshalJSON(traceRequest("k8s.pod.name", "kubernetes.pod.name"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		contentType     string
+		contentEncoding string
+		body            []byte
+		status          int
+		message         string
+	}{
+		{
+			name:        "conversion",
+			contentType: "application/json",
+			body:        conflicting,
+			status:      http.StatusBadRequest,
+			message:     "cannot convert the request: attribute kubernetes.pod.name conflicts",
+		},
+		{
+			name:        "invalid JSON",
+			contentType: "application/json",
+			body:        []byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{"spanId":"01"}]}]}]}`),
+			status:      http.StatusBadRequest,
+			message:     `invalid body: invalid spanId "01": must be 8 bytes long`,
+		},
+		{
+			name:            "invalid gzip",
+			contentType:     "application/json",
+			contentEncoding: "gzip",
+			body:            []byte("{}"),
+			status:          http.StatusBadRequest,
+			message:         "invalid gzip body: unexpected EOF",
+		},
+		{
+			name:            "unsupported encoding",
+			contentType:     "application/json",
+			contentEncoding: "br",
+			body:            []byte("{}"),
+			status:          http.StatusUnsupportedMediaType,
+			message:         `unsupported Content-Encoding "br", must be gzip`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				w := post(p, "/v1/traces", test.contentType, test.contentEncoding, test.body)
+				assert.Equal(t, test.status, w.Code)
+				body := jsonBody(t, w)
+				assert.Equal(t, float64(codes.InvalidArgument), body["code"])
+				assert.Equal(t, test.message, body["message"])
+			},
+		)
+	}
+
+	w := post(p, "/v1/traces", "application/x-protobuf", "", []byte{0xff})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/x-protobuf", w.Header().Get("Content-Type"))
+
+	w = post(p, "/v1/traces", "text/plain", "", []byte("{}"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = httptest.NewRecorder()
+	p.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/traces", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+
+	assert.Empty(t, up.receivedRequests())
+}
+
+func TestHTTPRetryable(t *testing.T) {
+	up := &upstream{err: status.Error(codes.Unavailable, "upstream is down")}
+	p, _ := startProxy(t, up, Options{})
+
+	body, err := otlp.MarshalJSON(traceRequest())
+	require.NoError(t, err)
+	w := post(p, "/v1/traces", "application/json", "", body)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "upstream is down", jsonBody(t, w)["message"])
+}
@@ -0,0 +1,259 @@
+// Package proxy implements an OTLP proxy that converts the received telemetry
+// to a target version of a schema and forwards it to an upstream OTLP receiver.
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+	"github.com/tigrannajaryan/telemetry-schema/schema/converter"
+	"github.com/tigrannajaryan/telemetry-schema/schema/otlp"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+const (
+	// DefaultMaxConcurrent is the default number of requests that are
+	// converted and forwarded at the same time.
+	DefaultMaxConcurrent = 16
+
+	// DefaultMaxPending is the default number of requests that wait for
+	// their turn to be converted and forwarded.
+	DefaultMaxPending = 64
+)
+
+// ErrorPolicy defines how a request that cannot be converted is handled.
+type ErrorPolicy int
+
+const (
+	// RejectOnError fails the request with codes.InvalidArgument. The request
+	// is not forwarded.
+	RejectOnError ErrorPolicy = iota
+
+	// DropOnError reports all data of the request as rejected in the partial
+	// success of the response. The request is not forwarded.
+	DropOnError
+
+	// ForwardOnError forwards the request unconverted.
+	ForwardOnError
+)
+
+var errorPolicyNames = map[ErrorPolicy]string{
+	RejectOnError:  "reject",
+	DropOnError:    "drop",
+	ForwardOnError: "forward",
+}
+
+func (p ErrorPolicy) String() string {
+	if name, exists := errorPolicyNames[p]; exists {
+		return name
+	}
+	return fmt.Sprintf("ErrorPolicy(%d)", int(p))
+}
+
+// ParseErrorPolicy returns the ErrorPolicy named "reject", "drop" or "forward".
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	for policy, policyName := range errorPolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown error policy %q, must be reject, drop or forward", name)
+}
+
+// Options controls how a Proxy converts and forwards requests.
+type Options struct {
+	// TargetVersion is the version to convert the requests to. If empty the
+	// requests are converted to the latest version known to the schema.
+	TargetVersion types.TelemetryVersion
+
+	// MaxConcurrent is the maximum number of requests that are converted and
+	// forwarded at the same time. If zero then DefaultMaxConcurrent is used.
+	MaxConcurrent int
+
+	// MaxPending is the maximum number of requests that wait until fewer than
+	// MaxConcurrent requests are in progress. Further requests fail with
+	// codes.Unavailable, which tells OTLP clients to retry later. If zero then
+	// DefaultMaxPending is used. Negative MaxPending disables waiting.
+	MaxPending int
+
+	// ErrorPolicy defines how requests that cannot be converted are handled.
+	ErrorPolicy ErrorPolicy
+}
+
+// Proxy converts OTLP export requests and forwards them upstream. Proxy is safe
+// for concurrent use.
+type Proxy struct {
+	schema  *compiled.Schema
+	options Options
+
+	// pending holds a token for every request in progress or waiting.
+	pending chan struct{}
+	// active holds a token for every request in progress.
+	active chan struct{}
+
+	traces  otlptracecol.TraceServiceClient
+	metrics otlpmetriccol.MetricsServiceClient
+	logs    otlplogscol.LogsServiceClient
+}
+
+// New creates a Proxy that converts requests using the schema and forwards
+// them to upstream.
+func New(schema *compiled.Schema, upstream grpc.ClientConnInterface, options Options) *Proxy {
+	if options.MaxConcurrent <= 0 {
+		options.MaxConcurrent = DefaultMaxConcurrent
+	}
+	switch {
+	case options.MaxPending == 0:
+		options.MaxPending = DefaultMaxPending
+	case options.MaxPending < 0:
+		options.MaxPending = 0
+	}
+
+	return &Proxy{
+		schema:  schema,
+		options: options,
+		pending: make(chan struct{}, options.MaxConcurrent+options.MaxPending),
+		active:  make(chan struct{}, options.MaxConcurrent),
+		traces:  otlptracecol.NewTraceServiceClient(upstream),
+		metrics: otlpmetriccol.NewMetricsServiceClient(upstream),
+		logs:    otlplogscol.NewLogsServiceClient(upstream),
+	}
+}
+
+// export converts the request and forwards it upstream. Returns the response
+// of the upstream or an error with a gRPC status.
+func (p *Proxy) export(ctx context.Context, request otlp.ExportRequest) (proto.Message, error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+
+	rejected := int64(0)
+	if p.options.ErrorPolicy == DropOnError {
+		// Count before converting, conversion may change the number of data
+		// points.
+		rejected = countItems(request)
+	}
+
+	changes := &compiled.ChangeLog{Enabled: p.options.ErrorPolicy == ForwardOnError}
+	opts := converter.Options{TargetVersion: p.options.TargetVersion}
+	if err := converter.ConvertRequestWithOptions(request, p.schema, opts, changes); err != nil {
+		message := fmt.Sprintf("cannot convert the request: %v", err)
+		switch p.options.ErrorPolicy {
+		case RejectOnError:
+			return nil, status.Error(codes.InvalidArgument, message)
+		case DropOnError:
+			return rejectedResponse(request, rejected, message), nil
+		}
+		changes.Rollback()
+	}
+
+	switch r := request.(type) {
+	case *otlptracecol.ExportTraceServiceRequest:
+		return p.traces.Export(ctx, r)
+	case *otlpmetriccol.ExportMetricsServiceRequest:
+		return p.metrics.Export(ctx, r)
+	case *otlplogscol.ExportLogsServiceRequest:
+		return p.logs.Export(ctx, r)
+	}
+	return nil, status.Errorf(codes.Internal, "unsupported request type %T", request)
+}
+
+// acquire waits until the request may be converted and forwarded.
+func (p *Proxy) acquire(ctx context.Context) error {
+	select {
+	case p.pending <- struct{}{}:
+	default:
+		return status.Error(codes.Unavailable, "too many requests in progress, retry later")
+	}
+
+	select {
+	case p.active <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		<-p.pending
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (p *Proxy) release() {
+	<-p.active
+	<-p.pending
+}
+
+// countItems returns the number of spans, metric data points or log records of
+// the request.
+func countItems(request otlp.ExportRequest) int64 {
+	count := 0
+	switch r := request.(type) {
+	case *otlptracecol.ExportTraceServiceRequest:
+		for _, rss := range r.ResourceSpans {
+			for _, ss := range rss.ScopeSpans {
+				count += len(ss.Spans)
+			}
+		}
+	case *otlpmetriccol.ExportMetricsServiceRequest:
+		for _, rms := range r.ResourceMetrics {
+			for _, sm := range rms.ScopeMetrics {
+				for _, metric := range sm.Metrics {
+					count += countDataPoints(metric)
+				}
+			}
+		}
+	case *otlplogscol.ExportLogsServiceRequest:
+		for _, rls := range r.ResourceLogs {
+			for _, sl := range rls.ScopeLogs {
+				count += len(sl.LogRecords)
+			}
+		}
+	}
+	return int64(count)
+}
+
+func countDataPoints(metric *otlpmetric.Metric) int {
+	switch data := metric.Data.(type) {
+	case *otlpmetric.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *otlpmetric.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *otlpmetric.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *otlpmetric.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *otlpmetric.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	}
+	return 0
+}
+
+// rejectedResponse returns the response to the request with the rejected
+// number of items in its partial success.
+func rejectedResponse(request otlp.ExportRequest, rejected int64, message string) proto.Message {
+	switch request.(type) {
+	case *otlptracecol.ExportTraceServiceRequest:
+		return &otlptracecol.ExportTraceServiceResponse{
+			PartialSuccess: &otlptracecol.ExportTracePartialSuccess{RejectedSpans: rejected, ErrorMessage: message},
+		}
+	case *otlpmetriccol.ExportMetricsServiceRequest:
+		return &otlpmetriccol.ExportMetricsServiceResponse{
+			PartialSuccess: &otlpmetriccol.ExportMetricsPartialSuccess{
+				RejectedDataPoints: rejected, ErrorMessage: message,
+			},
+		}
+	case *otlplogscol.ExportLogsServiceRequest:
+		return &otlplogscol.ExportLogsServiceResponse{
+			PartialSuccess: &otlplogscol.ExportLogsPartialSuccess{RejectedLogRecords: rejected, ErrorMessage: message},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otlplogscol "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otlpmetriccol "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	otlptracecol "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetric "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+)
+
+const (
+	schemaURL100 = "https://opentelemetry.io/schemas/1.0.0"
+	schemaURL110 = "https://opentelemetry.io/schemas/1.1.0"
+)
+
+// upstream is an in-process OTLP receiver that records the received requests.
+type upstream struct {
+	otlptracecol.UnimplementedTraceServiceServer
+	otlpmetriccol.UnimplementedMetricsServiceServer
+	otlplogscol.UnimplementedLogsServiceServer
+
+	mutex    sync.Mutex
+	requests []proto.Message
+	// err is returned by Export if not nil.
+	err error
+	// block, if not nil, is received from before a request is recorded.
+	block chan struct{}
+	// arrived, if not nil, is sent to when a request arrives.
+	arrived chan struct{}
+}
+
+func (u *upstream) receive(ctx context.Context, request proto.Message) error {
+	if u.arrived != nil {
+		u.arrived <- struct{}{}
+	}
+	if u.block != nil {
+		select {
+		case <-u.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.err != nil {
+		return u.err
+	}
+	u.requests = append(u.requests, request)
+	return nil
+}
+
+func (u *upstream) receivedRequests() []proto.Message {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.requests
+}
+
+func (u *upstream) Export(
+	ctx context.Context, request *otlptracecol.ExportTraceServiceRequest,
+) (*otlptracecol.ExportTraceServiceResponse, error) {
+	return &otlptracecol.ExportTraceServiceResponse{}, u.receive(ctx, request)
+}
+
+type upstreamMetrics struct{ *upstream }
+
+func (u upstreamMetrics) Export(
+	ctx context.Context, request *otlpmetriccol.ExportMetricsServiceRequest,
+) (*otlpmetriccol.ExportMetricsServiceResponse, error) {
+	return &otlpmetriccol.ExportMetricsServiceResponse{}, u.receive(ctx, request)
+}
+
+type upstreamLogs struct{ *upstream }
+
+func (u upstreamLogs) Export(
+	ctx context.Context, request *otlplogscol.ExportLogsServiceRequest,
+) (*otlplogscol.ExportLogsServiceResponse, error) {
+	return &otlplogscol.ExportLogsServiceResponse{}, u.receive(ctx, request)
+}
+
+// startServer serves the services registered by register in process and
+// returns a connection to it.
+func startServer(t *testing.T, register func(server *grpc.Server)) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	register(server)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial(
+		"bufconn",
+		grpc.WithContextDialer(
+			func(context.Context, string) (net.Conn, error) {
+				return listener.Dial()
+			},
+		),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// startProxy starts the upstream and a proxy that forwards to it. Returns a
+// connection to the proxy.
+func startProxy(t *testing.T, up *upstream, options Options) (*Proxy, *grpc.ClientConn) {
+	upstreamConn := startServer(
+		t, func(server *grpc.Server) {
+			otlptracecol.RegisterTraceServiceServer(server, up)
+			otlpmetriccol.RegisterMetricsServiceServer(server, upstreamMetrics{up})
+			otlplogscol.RegisterLogsServiceServer(server, upstreamLogs{up})
+		},
+	)
+	p := New(compileSchema(t), upstreamConn, options)
+	return p, startServer(t, func(server *grpc.Server) { p.Register(server) })
+}
+
+func compileSchema(t *testing.T) *compiled.Schema {
+	ts, err := schema.Parse("../testdata/schema-example.yaml")
+	require.NoError(t, err)
+	cs, diags := schema.Compile(ts)
+	require.NoError(t, diags.Err(schema.SeverityError))
+	return cs
+}
+
+func attributes(keys ...string) []*otlpcommon.KeyValue {
+	var attrs []*otlpcommon.KeyValue
+	for _, key := range keys {
+		attrs = append(
+			attrs, &otlpcommon.KeyValue{
+				Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: "v"}},
+			},
+		)
+	}
+	return attrs
+}
+
+func traceRequest(spanAttributes ...string) *otlptracecol.ExportTraceServiceRequest {
+	return &otlptracecol.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				Resource:  &otlpresource.Resource{Attributes: attributes("k8s.pod.name")},
+				SchemaUrl: schemaURL100,
+				ScopeSpans: []*otlptrace.ScopeSpans{
+					{
+						Spans: []*otlptrace.Span{
+							{Name: "a", Attributes: attributes(spanAttributes...)},
+							{Name: "b"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestProxyConverts(t *testing.T) {
+	up := &upstream{}
+	_, conn := startProxy(t, up, Options{})
+	ctx := context.Background()
+
+	_, err := otlptracecol.NewTraceServiceClient(conn).Export(ctx, traceRequest("k8s.node.name"))
+	require.NoError(t, err)
+
+	metrics := &otlpmetriccol.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetric.ResourceMetrics{
+			{
+				SchemaUrl: schemaURL100,
+				ScopeMetrics: []*otlpmetric.ScopeMetrics{
+					{
+						Metrics: []*otlpmetric.Metric{
+							{
+								Name: "container.cpu.usage.total",
+								Data: &otlpmetric.Metric_Gauge{
+									Gauge: &otlpmetric.Gauge{
+										DataPoints: []*otlpmetric.NumberDataPoint{
+											{Value: &otlpmetric.NumberDataPoint_AsInt{AsInt: 1}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	_, err = otlpmetriccol.NewMetricsServiceClient(conn).Export(ctx, metrics)
+	require.NoError(t, err)
+
+	logs := &otlplogscol.ExportLogsServiceRequest{
+		ResourceLogs: []*otlplogs.ResourceLogs{
+			{
+				SchemaUrl: schemaURL100,
+				ScopeLogs: []*otlplogs.ScopeLogs{
+					{LogRecords: []*otlplogs.LogRecord{{Attributes: attributes("k8s.pod.name")}}},
+				},
+			},
+		},
+	}
+	_, err = otlplogscol.NewLogsServiceClient(conn).Export(ctx, logs)
+	require.NoError(t, err)
+
+	received := up.receivedRequests()
+	require.Len(t, received, 3)
+
+	traces := received[0].(*otlptracecol.ExportTraceServiceRequest)
+	assert.Equal(t, schemaURL110, traces.ResourceSpans[0].SchemaUrl)
+	assert.Equal(t, "kubernetes.pod.name", traces.ResourceSpans[0].Resource.Attributes[0].Key)
+	assert.Equal(t, "kubernetes.node.name", traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes[0].Key)
+
+	convertedMetrics := received[1].(*otlpmetriccol.ExportMetricsServiceRequest)
+	assert.Equal(t, schemaURL110, convertedMetrics.ResourceMetrics[0].SchemaUrl)
+	assert.Equal(t, "cpu.usage.total", convertedMetrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+
+	convertedLogs := received[2].(*otlplogscol.ExportLogsServiceRequest)
+	assert.Equal(t, schemaURL110, convertedLogs.ResourceLogs[0].SchemaUrl)
+	assert.Equal(
+		t, "kubernetes.pod.name", convertedLogs.ResourceLogs[0].ScopeLogs[0].LogRecords[0].Attributes[0].Key,
+	)
+}
+
+func TestProxyTargetVersion(t *testing.T) {
+	up := &upstream{}
+	_, conn := startProxy(t, up, Options{TargetVersion: "1.0.0"})
+
+	request := traceRequest("k8s.node.name")
+	request.ResourceSpans[0].SchemaUrl = schemaURL110
+	_, err := otlptracecol.NewTraceServiceClient(conn).Export(context.Background(), request)
+	require.NoError(t, err)
+
+	received := up.receivedRequests()
+	require.Len(t, received, 1)
+	traces := received[0].(*otlptracecol.ExportTraceServiceRequest)
+	assert.Equal(t, schemaURL100, traces.ResourceSpans[0].SchemaUrl)
+	assert.Equal(t, "k8s.pod.name", traces.ResourceSpans[0].Resource.Attributes[0].Key)
+}
+
+func TestProxyErrorPolicy(t *testing.T) {
+	// The span attributes conflict after the conversion.
+	conflicting := func() *otlptracecol.ExportTraceServiceRequest {
+		return traceRequest("k8s.pod.name", "kubernetes.pod.name")
+	}
+
+	t.Run(
+		"reject", func(t *testing.T) {
+			up := &upstream{}
+			_, conn := startProxy(t, up, Options{ErrorPolicy: RejectOnError})
+			_, err := otlptracecol.NewTraceServiceClient(conn).Export(context.Background(), conflicting())
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Contains(t, err.Error(), "cannot convert the request: attribute kubernetes.pod.name conflicts")
+			assert.Empty(t, up.receivedRequests())
+		},
+	)
+
+	t.Run(
+		"drop", func(t *testing.T) {
+			up := &upstream{}
+			_, conn := startProxy(t, up, Options{ErrorPolicy: DropOnError})
+			response, err := otlptracecol.NewTraceServiceClient(conn).Export(context.Background(), conflicting())
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), response.PartialSuccess.RejectedSpans)
+			assert.Contains(t, response.PartialSuccess.ErrorMessage, "attribute kubernetes.pod.name conflicts")
+			assert.Empty(t, up.receivedRequests())
+		},
+	)
+
+	t.Run(
+		"forward", func(t *testing.T) {
+			up := &upstream{}
+			_, conn := startProxy(t, up, Options{ErrorPolicy: ForwardOnError})
+			_, err := otlptracecol.NewTraceServiceClient(conn).Export(context.Background(), conflicting())
+			require.NoError(t, err)
+			received := up.receivedRequests()
+			require.Len(t, received, 1)
+			assert.True(t, proto.Equal(conflicting(), received[0]))
+		},
+	)
+}
+
+func TestProxyUpstreamError(t *testing.T) {
+	up := &upstream{err: status.Error(codes.Unavailable, "upstream is down")}
+	_, conn := startProxy(t, up, Options{})
+	_, err := otlptracecol.NewTraceServiceClient(conn).Export(context.Background(), traceRequest())
+	require.Error(t, err)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, err.Error(), "upstream is down")
+}
+
+func TestProxyBackpressure(t *testing.T) {
+	up := &upstream{block: make(chan struct{}), arrived: make(chan struct{}, 2)}
+	p, conn := startProxy(t, up, Options{MaxConcurrent: 1, MaxPending: 1})
+	client := otlptracecol.NewTraceServiceClient(conn)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	export := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = client.Export(context.Background(), traceRequest())
+		}()
+	}
+
+	// The first request is in progress.
+	export(0)
+	<-up.arrived
+
+	// A waiting request gives up at its deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.Export(ctx, traceRequest())
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Eventually(t, func() bool { return len(p.pending) == 1 }, 5*time.Second, time.Millisecond)
+
+	// The second request waits, further requests are rejected.
+	export(1)
+	assert.Eventually(t, func() bool { return len(p.pending) == 2 }, 5*time.Second, time.Millisecond)
+	_, err = client.Export(context.Background(), traceRequest())
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	close(up.block)
+	wg.Wait()
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Len(t, up.receivedRequests(), 2)
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	for _, policy := range []ErrorPolicy{RejectOnError, DropOnError, ForwardOnError} {
+		parsed, err := ParseErrorPolicy(policy.String())
+		require.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+	_, err := ParseErrorPolicy("ignore")
+	assert.EqualError(t, err, `unknown error policy "ignore", must be reject, drop or forward`)
+}
@@ -0,0 +1,236 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+)
+
+const (
+	// DefaultRegistryTTL is the default time after which a cached schema is
+	// loaded again.
+	DefaultRegistryTTL = time.Hour
+
+	// DefaultRegistryNegativeTTL is the default time during which a failure to
+	// load a schema is cached.
+	DefaultRegistryNegativeTTL = time.Minute
+)
+
+// RegistryOptions controls how a Registry loads and caches schemas.
+type RegistryOptions struct {
+	// Loaders are tried in order until one of them returns a result other
+	// than ErrSchemaNotFound.
+	Loaders []Loader
+
+	// TTL is the time after which a cached schema is loaded again. If zero
+	// then DefaultRegistryTTL is used. Negative TTL disables reloading.
+	TTL time.Duration
+
+	// NegativeTTL is the time during which a failure to load or compile
+	// a schema is cached. If zero then DefaultRegistryNegativeTTL is used.
+	// Negative NegativeTTL disables caching of failures.
+	NegativeTTL time.Duration
+
+	// FailOnWarnings makes schemas that compile with warnings fail to load.
+	FailOnWarnings bool
+}
+
+// Registry resolves schema URLs to parsed and compiled schemas. Schemas are
+// cached. Concurrent requests for the same schema URL share a single load.
+// When a cached schema expires it is loaded again. If the reload fails the
+// expired schema continues to be used. Registry is safe for concurrent use.
+type Registry struct {
+	options RegistryOptions
+	now     func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]*registryEntry
+	loads   map[string]*registryLoad
+}
+
+type registryEntry struct {
+	ast      *ast.Schema
+	compiled *compiled.Schema
+	err      error
+	expires  time.Time
+}
+
+// registryLoad is a load in progress. done is closed when the load completes.
+type registryLoad struct {
+	done  chan struct{}
+	entry *registryEntry
+}
+
+// NewRegistry creates a Registry.
+func NewRegistry(options RegistryOptions) *Registry {
+	if options.TTL == 0 {
+		options.TTL = DefaultRegistryTTL
+	}
+	if options.NegativeTTL == 0 {
+		options.NegativeTTL = DefaultRegistryNegativeTTL
+	}
+	return &Registry{
+		options: options,
+		now:     time.Now,
+		entries: map[string]*registryEntry{},
+		loads:   map[string]*registryLoad{},
+	}
+}
+
+// Get returns the compiled schema published at the schema URL.
+func (r *Registry) Get(ctx context.Context, schemaURL string) (*compiled.Schema, error) {
+	entry, err := r.get(ctx, schemaURL, false)
+	if err != nil {
+		return nil, err
+	}
+	return entry.compiled, nil
+}
+
+// GetAST returns the parsed schema published at the schema URL.
+func (r *Registry) GetAST(ctx context.Context, schemaURL string) (*ast.Schema, error) {
+	entry, err := r.get(ctx, schemaURL, false)
+	if err != nil {
+		return nil, err
+	}
+	return entry.ast, nil
+}
+
+// Refresh loads the schema published at the schema URL again, regardless of
+// whether it is cached. If the load fails the previously cached schema, if any,
+// continues to be used and the error is returned.
+func (r *Registry) Refresh(ctx context.Context, schemaURL string) error {
+	_, err := r.get(ctx, schemaURL, true)
+	return err
+}
+
+// Invalidate removes the schema URL from the cache.
+func (r *Registry) Invalidate(schemaURL string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.entries, schemaURL)
+}
+
+func (r *Registry) get(ctx context.Context, schemaURL string, refresh bool) (*registryEntry, error) {
+	for {
+		r.mutex.Lock()
+		cached, exists := r.entries[schemaURL]
+		if exists && !refresh && !r.expired(cached) {
+			r.mutex.Unlock()
+			return cached, cached.err
+		}
+
+		load, loading := r.loads[schemaURL]
+		if !loading {
+			load = &registryLoad{done: make(chan struct{})}
+			r.loads[schemaURL] = load
+		}
+		r.mutex.Unlock()
+
+		if !loading {
+			r.load(ctx, schemaURL, load, cached)
+		}
+
+		select {
+		case <-load.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if loading && isContextError(load.entry.err) && ctx.Err() == nil {
+			// The load was canceled by the context of another caller.
+			continue
+		}
+
+		if load.entry.err != nil && cached != nil && cached.err == nil {
+			if refresh {
+				return cached, load.entry.err
+			}
+			// Keep using the expired schema if it cannot be loaded again.
+			return cached, nil
+		}
+		return load.entry, load.entry.err
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (r *Registry) expired(entry *registryEntry) bool {
+	return !entry.expires.IsZero() && !r.now().Before(entry.expires)
+}
+
+// load loads the schema and completes the load. cached is the entry that was
+// in the cache when the load started.
+func (r *Registry) load(ctx context.Context, schemaURL string, load *registryLoad, cached *registryEntry) {
+	entry := &registryEntry{}
+	entry.ast, entry.compiled, entry.err = r.loadSchema(ctx, schemaURL)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.loads, schemaURL)
+	load.entry = entry
+	close(load.done)
+
+	switch {
+	case entry.err == nil:
+		if r.options.TTL > 0 {
+			entry.expires = r.now().Add(r.options.TTL)
+		}
+		r.entries[schemaURL] = entry
+
+	case cached != nil && cached.err == nil:
+		// Retry the reload of the expired schema not earlier than the failure
+		// would have expired.
+		if r.options.NegativeTTL > 0 {
+			retained := *cached
+			retained.expires = r.now().Add(r.options.NegativeTTL)
+			r.entries[schemaURL] = &retained
+		}
+
+	case r.options.NegativeTTL > 0 && !isContextError(entry.err):
+		entry.expires = r.now().Add(r.options.NegativeTTL)
+		r.entries[schemaURL] = entry
+
+	default:
+		delete(r.entries, schemaURL)
+	}
+}
+
+func (r *Registry) loadSchema(ctx context.Context, schemaURL string) (*ast.Schema, *compiled.Schema, error) {
+	content, err := r.loadContent(ctx, schemaURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ts, err := ParseBytes(schemaURL, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	minSeverity := SeverityError
+	if r.options.FailOnWarnings {
+		minSeverity = SeverityWarning
+	}
+	cs, diags := Compile(ts)
+	if err := diags.Err(minSeverity); err != nil {
+		return nil, nil, fmt.Errorf("schema %s: %w", schemaURL, err)
+	}
+	return ts, cs, nil
+}
+
+func (r *Registry) loadContent(ctx context.Context, schemaURL string) ([]byte, error) {
+	for _, loader := range r.options.Loaders {
+		content, err := loader.Load(ctx, schemaURL)
+		if errors.Is(err, ErrSchemaNotFound) {
+			continue
+		}
+		return content, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, schemaURL)
+}
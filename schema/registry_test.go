@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSchemaServer struct {
+	*httptest.Server
+	requests int32
+
+	mutex   sync.Mutex
+	content []byte
+	status  int
+	block   chan struct{}
+}
+
+func newTestSchemaServer(t *testing.T) *testSchemaServer {
+	content, err := ioutil.ReadFile("testdata/schema-example.yaml")
+	require.NoError(t, err)
+
+	s := &testSchemaServer{content: content, status: http.StatusOK}
+	s.Server = httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&s.requests, 1)
+
+				s.mutex.Lock()
+				status, content, block := s.status, s.content, s.block
+				s.mutex.Unlock()
+
+				if block != nil {
+					<-block
+				}
+				if r.URL.Path != "/schemas/1.1.0" {
+					status = http.StatusNotFound
+				}
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write(content)
+				}
+			},
+		),
+	)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testSchemaServer) setStatus(status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status = status
+}
+
+func (s *testSchemaServer) requestCount() int {
+	return int(atomic.LoadInt32(&s.requests))
+}
+
+func TestRegistryHTTP(t *testing.T) {
+	server := newTestSchemaServer(t)
+	now := time.Unix(1000, 0)
+	registry := NewRegistry(
+		RegistryOptions{
+			Loaders:     []Loader{HTTPLoader{Client: server.Client()}},
+			TTL:         time.Hour,
+			NegativeTTL: time.Minute,
+		},
+	)
+	registry.now = func() time.Time { return now }
+	ctx := context.Background()
+	schemaURL := server.URL + "/schemas/1.1.0"
+
+	cs, err := registry.Get(ctx, schemaURL)
+	require.NoError(t, err)
+	assert.EqualValues(t, "1.1.0", cs.LatestVersion())
+	ts, err := registry.GetAST(ctx, schemaURL)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", ts.FileFormat)
+	assert.Equal(t, 1, server.requestCount())
+
+	// Reload after TTL. Failed reload keeps the expired schema.
+	now = now.Add(time.Hour)
+	server.setStatus(http.StatusInternalServerError)
+	cs2, err := registry.Get(ctx, schemaURL)
+	require.NoError(t, err)
+	assert.Same(t, cs, cs2)
+	assert.Equal(t, 2, server.requestCount())
+
+	// The reload is not retried until the negative TTL expires.
+	_, err = registry.Get(ctx, schemaURL)
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.requestCount())
+
+	now = now.Add(time.Minute)
+	server.setStatus(http.StatusOK)
+	cs2, err = registry.Get(ctx, schemaURL)
+	require.NoError(t, err)
+	assert.NotSame(t, cs, cs2)
+	assert.Equal(t, 3, server.requestCount())
+
+	// Refresh loads regardless of TTL and reports the failure.
+	server.setStatus(http.StatusInternalServerError)
+	err = registry.Refresh(ctx, schemaURL)
+	assert.Error(t, err)
+	cs3, err := registry.Get(ctx, schemaURL)
+	require.NoError(t, err)
+	assert.Same(t, cs2, cs3)
+	assert.Equal(t, 4, server.requestCount())
+}
+
+func TestRegistryNegativeCaching(t *testing.T) {
+	server := newTestSchemaServer(t)
+	now := time.Unix(1000, 0)
+	registry := NewRegistry(RegistryOptions{Loaders: []Loader{HTTPLoader{Client: server.Client()}}})
+	registry.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := registry.Get(ctx, server.URL+"/schemas/9.9.9")
+	assert.True(t, errors.Is(err, ErrSchemaNotFound))
+	_, err = registry.Get(ctx, server.URL+"/schemas/9.9.9")
+	assert.True(t, errors.Is(err, ErrSchemaNotFound))
+	assert.Equal(t, 1, server.requestCount())
+
+	now = now.Add(DefaultRegistryNegativeTTL)
+	_, err = registry.Get(ctx, server.URL+"/schemas/9.9.9")
+	assert.Error(t, err)
+	assert.Equal(t, 2, server.requestCount())
+
+	// Invalid schema content is cached as a failure too.
+	server.mutex.Lock()
+	server.content = []byte("versions: [")
+	server.mutex.Unlock()
+	_, err = registry.Get(ctx, server.URL+"/schemas/1.1.0")
+	assert.Error(t, err)
+	_, err = registry.Get(ctx, server.URL+"/schemas/1.1.0")
+	assert.Error(t, err)
+	assert.Equal(t, 3, server.requestCount())
+
+	registry.Invalidate(server.URL + "/schemas/1.1.0")
+	_, err = registry.Get(ctx, server.URL+"/schemas/1.1.0")
+	assert.Error(t, err)
+	assert.Equal(t, 4, server.requestCount())
+}
+
+func TestRegistryConcurrentGet(t *testing.T) {
+	server := newTestSchemaServer(t)
+	block := make(chan struct{})
+	server.block = block
+	registry := NewRegistry(RegistryOptions{Loaders: []Loader{HTTPLoader{Client: server.Client()}}})
+	schemaURL := server.URL + "/schemas/1.1.0"
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := registry.Get(context.Background(), schemaURL)
+			results <- err
+		}()
+	}
+
+	// Let the callers pile up on the blocked request.
+	require.Eventually(
+		t, func() bool { return server.requestCount() == 1 }, 5*time.Second, time.Millisecond,
+	)
+	time.Sleep(10 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	close(results)
+
+	for err := range results {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, server.requestCount())
+}
+
+func TestRegistryLocalLoaders(t *testing.T) {
+	dir, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	registry := NewRegistry(
+		RegistryOptions{
+			Loaders: []Loader{
+				DirLoader{BaseURL: "https://example.com/schemas", Dir: dir},
+				FileLoader{},
+			},
+		},
+	)
+	ctx := context.Background()
+
+	cs, err := registry.Get(ctx, "https://example.com/schemas/schema-example.yaml")
+	require.NoError(t, err)
+	assert.EqualValues(t, "1.1.0", cs.LatestVersion())
+
+	cs, err = registry.Get(ctx, "file://"+filepath.ToSlash(filepath.Join(dir, "schema-example.yaml")))
+	require.NoError(t, err)
+	assert.EqualValues(t, "1.1.0", cs.LatestVersion())
+
+	for _, schemaURL := range []string{
+		"https://example.com/schemas/1.0.0",
+		"https://example.com/schemas/../compiler.go",
+		"https://other.com/schemas/schema-example.yaml",
+		"file://" + filepath.ToSlash(filepath.Join(dir, "missing.yaml")),
+	} {
+		_, err = registry.Get(ctx, schemaURL)
+		assert.True(t, errors.Is(err, ErrSchemaNotFound), schemaURL)
+	}
+}
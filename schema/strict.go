@@ -0,0 +1,137 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyAliases maps the keys used by older schema drafts to the keys that
+// replaced them.
+var keyAliases = map[string]string{
+	"by_label":           "by_attribute",
+	"labels_to_metrics":  "metrics_from_attributes",
+	"labels_for_metrics": "attributes_for_metrics",
+	"rename_labels":      "rename_attributes",
+}
+
+// checkKnownKeys reports the keys of the mapping nodes that the yaml decoder
+// ignores when decoding node to a value of type t.
+func (p *parser) checkKnownKeys(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		// The anchored node is checked where it is defined.
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			fieldType, exists := fields[keyNode.Value]
+			if !exists {
+				if p.reported[keyNode] {
+					continue
+				}
+				p.errorf(keyNode, "unknown key %q%s", keyNode.Value, suggestKey(keyNode.Value, fields))
+				continue
+			}
+			p.checkKnownKeys(valueNode, fieldType)
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			p.checkKnownKeys(node.Content[i], t.Elem())
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, item := range node.Content {
+			p.checkKnownKeys(item, t.Elem())
+		}
+	}
+}
+
+// yamlFields returns the types of the fields of the struct type by the keys
+// that the yaml decoder maps to them.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name, ok := yamlFieldName(field); ok {
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
+
+// suggestKey returns a suggestion of a known key to use in place of the unknown
+// key or an empty string if there is no good suggestion.
+func suggestKey(unknown string, known map[string]reflect.Type) string {
+	if alias, exists := keyAliases[unknown]; exists {
+		if _, exists := known[alias]; exists {
+			return fmt.Sprintf(", did you mean %q?", alias)
+		}
+	}
+
+	// Suggest the closest key if it is close enough to be a misspelling.
+	maxDistance := len(unknown) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	best, bestDistance := "", maxDistance+1
+	for key := range known {
+		d := levenshtein(strings.ToLower(unknown), key)
+		if d < bestDistance || (d == bestDistance && key < best) {
+			best, bestDistance = key, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitSchemaURL splits a schema URL, such as https://opentelemetry.io/schemas/1.1.0,
+// into the URL of the schema family and the version. The version is the last
+// path segment of the URL and must be a valid semantic version.
+func SplitSchemaURL(schemaURL string) (family string, version TelemetryVersion, err error) {
+	i := strings.LastIndexByte(schemaURL, '/')
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid schema URL %q: no version", schemaURL)
+	}
+	family, version = schemaURL[:i], TelemetryVersion(schemaURL[i+1:])
+	if _, err := version.Parse(); err != nil {
+		return "", "", fmt.Errorf("invalid schema URL %q: %w", schemaURL, err)
+	}
+	return family, version, nil
+}
+
+// JoinSchemaURL returns the schema URL of the version in the schema family.
+func JoinSchemaURL(family string, version TelemetryVersion) string {
+	return family + "/" + string(version)
+}
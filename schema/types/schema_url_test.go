@@ -0,0 +1,23 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSchemaURL(t *testing.T) {
+	family, version, err := SplitSchemaURL("https://opentelemetry.io/schemas/1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "https://opentelemetry.io/schemas", family)
+	assert.EqualValues(t, "1.2.0", version)
+	assert.Equal(t, "https://opentelemetry.io/schemas/1.2.0", JoinSchemaURL(family, version))
+
+	for _, invalid := range []string{
+		"", "1.2.0", "https://opentelemetry.io/schemas/", "https://opentelemetry.io/schemas/v1",
+	} {
+		_, _, err := SplitSchemaURL(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
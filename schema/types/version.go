@@ -0,0 +1,196 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version (https://semver.org/spec/v2.0.0.html).
+// The zero value is version 0.0.0.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+	Build      string
+}
+
+// ParseVersion parses s as a semantic version of the form
+// MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD].
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	rest := s
+
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+		if err := checkIdentifiers(v.Build, false); err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: build metadata %v", s, err)
+		}
+	}
+
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		preRelease := rest[i+1:]
+		rest = rest[:i]
+		if err := checkIdentifiers(preRelease, true); err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: pre-release %v", s, err)
+		}
+		v.PreRelease = strings.Split(preRelease, ".")
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: must be in MAJOR.MINOR.PATCH form", s)
+	}
+
+	nums := [3]*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := parseNumericIdentifier(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %v", s, err)
+		}
+		*nums[i] = n
+	}
+
+	return v, nil
+}
+
+// MustParseVersion is like ParseVersion but panics if s is not a valid version.
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Parse parses the TelemetryVersion as a semantic version.
+func (tv TelemetryVersion) Parse() (Version, error) {
+	return ParseVersion(string(tv))
+}
+
+func parseNumericIdentifier(s string) (uint64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty numeric component")
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return 0, fmt.Errorf("numeric component %q has a leading zero", s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("component %q is not a number", s)
+		}
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func checkIdentifiers(s string, numericLeadingZeros bool) error {
+	for _, ident := range strings.Split(s, ".") {
+		if ident == "" {
+			return fmt.Errorf("has an empty identifier")
+		}
+		numeric := true
+		for i := 0; i < len(ident); i++ {
+			c := ident[i]
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return fmt.Errorf("identifier %q contains invalid character %q", ident, c)
+			}
+		}
+		if numericLeadingZeros && numeric && len(ident) > 1 && ident[0] == '0' {
+			return fmt.Errorf("numeric identifier %q has a leading zero", ident)
+		}
+	}
+	return nil
+}
+
+// Compare returns -1, 0 or +1 depending on whether v is lower than, equal to or
+// higher than other according to semver precedence rules. Build metadata is
+// ignored.
+func (v Version) Compare(other Version) int {
+	if c := compareUint(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+
+	// A version without pre-release has higher precedence than one with it.
+	switch {
+	case len(v.PreRelease) == 0 && len(other.PreRelease) == 0:
+		return 0
+	case len(v.PreRelease) == 0:
+		return 1
+	case len(other.PreRelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.PreRelease) && i < len(other.PreRelease); i++ {
+		if c := comparePreReleaseIdentifier(v.PreRelease[i], other.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(v.PreRelease)), uint64(len(other.PreRelease)))
+}
+
+// Less reports whether v has lower precedence than other.
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+func (v Version) String() string {
+	var sb strings.Builder
+	sb.WriteString(strconv.FormatUint(v.Major, 10))
+	sb.WriteByte('.')
+	sb.WriteString(strconv.FormatUint(v.Minor, 10))
+	sb.WriteByte('.')
+	sb.WriteString(strconv.FormatUint(v.Patch, 10))
+	if len(v.PreRelease) > 0 {
+		sb.WriteByte('-')
+		sb.WriteString(strings.Join(v.PreRelease, "."))
+	}
+	if v.Build != "" {
+		sb.WriteByte('+')
+		sb.WriteString(v.Build)
+	}
+	return sb.String()
+}
+
+// TelemetryVersion returns the version as a TelemetryVersion.
+func (v Version) TelemetryVersion() TelemetryVersion {
+	return TelemetryVersion(v.String())
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func comparePreReleaseIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	aNumeric, bNumeric := aErr == nil, bErr == nil
+
+	switch {
+	case aNumeric && bNumeric:
+		return compareUint(an, bn)
+	case aNumeric:
+		// Numeric identifiers have lower precedence than alphanumeric ones.
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
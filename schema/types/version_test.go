@@ -0,0 +1,72 @@
+package types
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("1.10.2-rc.1+build.5")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, v.Major)
+	assert.EqualValues(t, 10, v.Minor)
+	assert.EqualValues(t, 2, v.Patch)
+	assert.Equal(t, []string{"rc", "1"}, v.PreRelease)
+	assert.Equal(t, "build.5", v.Build)
+	assert.Equal(t, "1.10.2-rc.1+build.5", v.String())
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"1",
+		"1.0",
+		"1.0.0.0",
+		"01.0.0",
+		"1.a.0",
+		"1.0.0-",
+		"1.0.0-rc..1",
+		"1.0.0-01",
+		"1.0.0+",
+		"1.0.0-rc_1",
+		"v1.0.0",
+	}
+	for _, s := range invalid {
+		_, err := ParseVersion(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestVersionOrdering(t *testing.T) {
+	// Sorted in ascending precedence, example from semver spec plus multi-digit
+	// components that do not sort correctly as strings.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.2.0",
+		"1.9.0",
+		"1.10.0",
+		"2.0.0",
+	}
+
+	var versions []Version
+	for i := len(ordered) - 1; i >= 0; i-- {
+		versions = append(versions, MustParseVersion(ordered[i]))
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Less(versions[j]) })
+
+	for i, v := range versions {
+		assert.Equal(t, ordered[i], v.String())
+	}
+
+	assert.Equal(t, 0, MustParseVersion("1.0.0+a").Compare(MustParseVersion("1.0.0+b")))
+}
@@ -0,0 +1,346 @@
+// Package validate checks a parsed schema for renames that are valid YAML and
+// compile, but most likely do not do what the schema author intended.
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/compiled"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// Problem is a problem found in a schema.
+type Problem struct {
+	// Versions are the versions involved, in ascending order.
+	Versions []types.TelemetryVersion
+	// Section is the section the problem is found in, one of compiled.Section*
+	// constants.
+	Section string
+	Message string
+}
+
+func (p Problem) String() string {
+	versions := make([]string, len(p.Versions))
+	for i, v := range p.Versions {
+		versions[i] = string(v)
+	}
+	label := "version"
+	if len(versions) > 1 {
+		label = "versions"
+	}
+	return fmt.Sprintf("%s %s, section %s: %s", label, strings.Join(versions, ", "), p.Section, p.Message)
+}
+
+// Validate checks the schema and returns the problems found:
+//
+//   - two different names renamed to the same new name in a version, including
+//     a rename in "all" section that collides with a section specific rename;
+//   - a name renamed to several different new names in a version;
+//   - a name that is both renamed and a rename target in a version;
+//   - a name renamed back to a name that was renamed away in an earlier version.
+//
+// Versions that are not valid semantic versions are ignored.
+func Validate(schema *ast.Schema) []Problem {
+	var versions []versionRenames
+	for versionNum, def := range schema.Versions {
+		version, err := versionNum.Parse()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, versionRenames{num: versionNum, version: version, namespaces: collectRenames(def)})
+	}
+	sort.Slice(
+		versions, func(i, j int) bool {
+			return versions[i].version.Less(versions[j].version)
+		},
+	)
+
+	var problems []Problem
+	for _, v := range versions {
+		for _, ns := range namespaceOrder {
+			problems = append(problems, checkVersion(v.num, ns, v.renames(ns))...)
+		}
+	}
+	for _, ns := range namespaceOrder {
+		problems = append(problems, checkCycles(versions, ns)...)
+	}
+	return problems
+}
+
+// namespace is a set of names that renames apply to, such as attributes of
+// spans or metric names.
+type namespace struct {
+	section string
+	// kind is the kind of the names, used in messages.
+	kind string
+}
+
+var (
+	allAttributes       = namespace{compiled.SectionAll, "attribute"}
+	resourceAttributes  = namespace{compiled.SectionResources, "attribute"}
+	spanAttributes      = namespace{compiled.SectionSpans, "attribute"}
+	spanEventAttributes = namespace{compiled.SectionSpanEvents, "attribute"}
+	spanEventNames      = namespace{compiled.SectionSpanEvents, "event"}
+	metricAttributes    = namespace{compiled.SectionMetrics, "attribute"}
+	metricNames         = namespace{compiled.SectionMetrics, "metric"}
+	logAttributes       = namespace{compiled.SectionLogs, "attribute"}
+	logNames            = namespace{compiled.SectionLogs, "log"}
+)
+
+var namespaceOrder = []namespace{
+	allAttributes, resourceAttributes, spanAttributes, spanEventAttributes, spanEventNames,
+	metricAttributes, metricNames, logAttributes, logNames,
+}
+
+// allSectionNamespaces are the namespaces that the renames of "all" section
+// apply to.
+var allSectionNamespaces = map[namespace]bool{
+	resourceAttributes:  true,
+	spanAttributes:      true,
+	spanEventAttributes: true,
+	metricAttributes:    true,
+	logAttributes:       true,
+}
+
+type rename struct {
+	from, to string
+	// source is the section the rename is defined in.
+	source string
+	// scope is the set of data the rename is limited to, e.g. the names of
+	// metrics. Nil if the rename applies to all data of the section.
+	scope map[string]bool
+}
+
+func (r rename) describe(ns namespace) string {
+	if r.source != ns.section {
+		return fmt.Sprintf("%s (in %s section)", r.from, r.source)
+	}
+	return r.from
+}
+
+// checkedInAll returns true if both renames are in "all" section and ns is not
+// the namespace of that section. Such renames are checked once, in the
+// namespace of "all" section.
+func checkedInAll(ns namespace, r1, r2 rename) bool {
+	return ns != allAttributes && r1.source == compiled.SectionAll && r2.source == compiled.SectionAll
+}
+
+type versionRenames struct {
+	num        types.TelemetryVersion
+	version    types.Version
+	namespaces map[namespace][]rename
+}
+
+// renames returns the renames of the version in the namespace, including the
+// renames of "all" section that apply to the namespace.
+func (v versionRenames) renames(ns namespace) []rename {
+	if !allSectionNamespaces[ns] {
+		return v.namespaces[ns]
+	}
+	all := v.namespaces[allAttributes]
+	result := make([]rename, 0, len(all)+len(v.namespaces[ns]))
+	result = append(result, all...)
+	return append(result, v.namespaces[ns]...)
+}
+
+func collectRenames(def ast.VersionDef) map[namespace][]rename {
+	result := map[namespace][]rename{}
+	add := func(ns namespace, source string, m map[string]string, scope map[string]bool) {
+		for _, from := range sortedKeys(m) {
+			result[ns] = append(result[ns], rename{from: from, to: m[from], source: source, scope: scope})
+		}
+	}
+
+	for _, action := range def.All.Changes {
+		if action.RenameAttributes != nil {
+			add(allAttributes, compiled.SectionAll, *action.RenameAttributes, nil)
+		}
+	}
+
+	for _, action := range def.Resources.Changes {
+		if action.RenameAttributes != nil {
+			add(resourceAttributes, compiled.SectionResources, *action.RenameAttributes, nil)
+		}
+	}
+
+	for _, action := range def.Spans.Changes {
+		if action.RenameAttributes != nil {
+			add(spanAttributes, compiled.SectionSpans, action.RenameAttributes.AttributeMap, nil)
+		}
+	}
+
+	for _, action := range def.SpanEvents.Changes {
+		if action.RenameEvents != nil {
+			add(spanEventNames, compiled.SectionSpanEvents, action.RenameEvents.EventNameMap, nil)
+		}
+		if action.RenameAttributes != nil {
+			// Renames limited to spans and to events are compared as if
+			// they were limited to events only, which may report a conflict
+			// between renames that apply to different spans.
+			var scope map[string]bool
+			if len(action.RenameAttributes.ApplyToEvents) > 0 {
+				scope = map[string]bool{}
+				for _, name := range action.RenameAttributes.ApplyToEvents {
+					scope[string(name)] = true
+				}
+			}
+			add(spanEventAttributes, compiled.SectionSpanEvents, action.RenameAttributes.AttributeMap, scope)
+		}
+	}
+
+	for _, action := range def.Metrics.Changes {
+		if action.RenameMetrics != nil {
+			names := map[string]string{}
+			for k, v := range action.RenameMetrics {
+				names[string(k)] = string(v)
+			}
+			add(metricNames, compiled.SectionMetrics, names, nil)
+		}
+		if action.RenameLabels != nil {
+			var scope map[string]bool
+			if len(action.RenameLabels.ApplyToMetrics) > 0 {
+				scope = map[string]bool{}
+				for _, name := range action.RenameLabels.ApplyToMetrics {
+					scope[string(name)] = true
+				}
+			}
+			add(metricAttributes, compiled.SectionMetrics, action.RenameLabels.AttributeMap, scope)
+		}
+	}
+
+	for _, action := range def.Logs.Changes {
+		if action.RenameLogs != nil {
+			names := map[string]string{}
+			for k, v := range action.RenameLogs {
+				names[string(k)] = string(v)
+			}
+			add(logNames, compiled.SectionLogs, names, nil)
+		}
+		if action.RenameAttributes != nil {
+			var scope map[string]bool
+			if len(action.RenameAttributes.ApplyToLogs) > 0 {
+				scope = map[string]bool{}
+				for _, name := range action.RenameAttributes.ApplyToLogs {
+					scope[string(name)] = true
+				}
+			}
+			add(logAttributes, compiled.SectionLogs, action.RenameAttributes.AttributeMap, scope)
+		}
+	}
+
+	return result
+}
+
+// scopesOverlap returns true if there is data that both scopes apply to.
+func scopesOverlap(s1, s2 map[string]bool) bool {
+	if s1 == nil || s2 == nil {
+		return true
+	}
+	for name := range s1 {
+		if s2[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func checkVersion(version types.TelemetryVersion, ns namespace, renames []rename) []Problem {
+	var problems []Problem
+	report := func(format string, args ...interface{}) {
+		problems = append(
+			problems, Problem{
+				Versions: []types.TelemetryVersion{version},
+				Section:  ns.section,
+				Message:  fmt.Sprintf(format, args...),
+			},
+		)
+	}
+
+	for i, r1 := range renames {
+		if r1.from == r1.to {
+			continue
+		}
+		for _, r2 := range renames[i+1:] {
+			if r2.from == r2.to || !scopesOverlap(r1.scope, r2.scope) || checkedInAll(ns, r1, r2) {
+				continue
+			}
+			switch {
+			case r1.from != r2.from && r1.to == r2.to:
+				report("%ss %s and %s are both renamed to %s", ns.kind, r1.describe(ns), r2.describe(ns), r1.to)
+			case r1.from == r2.from && r1.to != r2.to:
+				report("%s %s is renamed to both %s and %s", ns.kind, r1.from, r1.to, r2.to)
+			}
+		}
+	}
+
+	// Names that are both renamed and rename targets.
+	for _, r1 := range renames {
+		if r1.from == r1.to {
+			continue
+		}
+		for _, r2 := range renames {
+			if r2.from == r2.to || r1.to != r2.from || !scopesOverlap(r1.scope, r2.scope) ||
+				checkedInAll(ns, r1, r2) {
+				continue
+			}
+			report(
+				"%s %s is both a new name (renamed from %s) and an old name (renamed to %s)",
+				ns.kind, r1.to, r1.from, r2.to,
+			)
+		}
+	}
+
+	return problems
+}
+
+// checkCycles reports renames to names that were renamed away in an earlier
+// version.
+func checkCycles(versions []versionRenames, ns namespace) []Problem {
+	type renamedAwayIn struct {
+		version types.TelemetryVersion
+		rename  rename
+	}
+
+	var problems []Problem
+	renamedAway := map[string]renamedAwayIn{}
+	for _, v := range versions {
+		reported := map[string]bool{}
+		renames := v.renames(ns)
+		for _, r := range renames {
+			if r.from == r.to || reported[r.to] {
+				continue
+			}
+			if earlier, exists := renamedAway[r.to]; exists && !checkedInAll(ns, earlier.rename, r) {
+				reported[r.to] = true
+				problems = append(
+					problems, Problem{
+						Versions: []types.TelemetryVersion{earlier.version, v.num},
+						Section:  ns.section,
+						Message: fmt.Sprintf(
+							"%s %s is renamed to %s, which was renamed away in version %s",
+							ns.kind, r.describe(ns), r.to, earlier.version,
+						),
+					},
+				)
+			}
+		}
+		for _, r := range renames {
+			if r.from != r.to {
+				renamedAway[r.from] = renamedAwayIn{version: v.num, rename: r}
+			}
+		}
+	}
+	return problems
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
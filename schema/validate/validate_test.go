@@ -0,0 +1,168 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+func parse(t *testing.T, content string) []Problem {
+	ts, err := schema.ParseBytes("test.yaml", []byte(content))
+	require.NoError(t, err)
+	return Validate(ts)
+}
+
+func messages(problems []Problem) []string {
+	var msgs []string
+	for _, p := range problems {
+		msgs = append(msgs, p.String())
+	}
+	return msgs
+}
+
+func TestValidateExample(t *testing.T) {
+	ts, err := schema.Parse("../testdata/schema-example.yaml")
+	require.NoError(t, err)
+	assert.Empty(t, messages(Validate(ts)))
+}
+
+func TestValidateCollisions(t *testing.T) {
+	problems := parse(
+		t, `
+file_format: 1.0.0
+versions:
+  1.1.0:
+    all:
+      changes:
+        - rename_attributes:
+            k8s.pod: k8s.pod.name
+    spans:
+      changes:
+        - rename_attributes:
+            attribute_map:
+              pod: k8s.pod.name
+    metrics:
+      changes:
+        - rename_metrics:
+            m1: m3
+            m2: m3
+        - rename_attributes:
+            apply_to_metrics: [m1]
+            label_map:
+              a: b
+        - rename_attributes:
+            apply_to_metrics: [m2]
+            label_map:
+              c: b
+  1.0.0:
+`,
+	)
+	assert.Equal(
+		t, []string{
+			"version 1.1.0, section spans: attributes k8s.pod (in all section) and pod are both renamed to k8s.pod.name",
+			"version 1.1.0, section metrics: metrics m1 and m2 are both renamed to m3",
+		}, messages(problems),
+	)
+	assert.Equal(t, []types.TelemetryVersion{"1.1.0"}, problems[0].Versions)
+	assert.Equal(t, "spans", problems[0].Section)
+}
+
+func TestValidateAllSection(t *testing.T) {
+	problems := parse(
+		t, `
+file_format: 1.0.0
+versions:
+  1.2.0:
+    logs:
+      changes:
+        - rename_attributes:
+            attribute_map:
+              e: d
+  1.1.0:
+    all:
+      changes:
+        - rename_attributes:
+            a: c
+            b: c
+            d: f
+  1.0.0:
+`,
+	)
+
+	// Renames of "all" section are checked once under that section and
+	// against the renames of the other sections.
+	assert.Equal(
+		t, []string{
+			"version 1.1.0, section all: attributes a and b are both renamed to c",
+			"versions 1.1.0, 1.2.0, section logs: attribute e is renamed to d, which was renamed away in version 1.1.0",
+		}, messages(problems),
+	)
+	assert.Equal(t, "all", problems[0].Section)
+}
+
+func TestValidateChainsInVersion(t *testing.T) {
+	problems := parse(
+		t, `
+file_format: 1.0.0
+versions:
+  1.1.0:
+    resources:
+      changes:
+        - rename_attributes:
+            a: b
+        - rename_attributes:
+            a: c
+    logs:
+      changes:
+        - rename_logs:
+            l1: l2
+            l2: l3
+  1.0.0:
+`,
+	)
+	assert.Equal(
+		t, []string{
+			"version 1.1.0, section resources: attribute a is renamed to both b and c",
+			"version 1.1.0, section logs: log l2 is both a new name (renamed from l1) and an old name (renamed to l3)",
+		}, messages(problems),
+	)
+}
+
+func TestValidateCycles(t *testing.T) {
+	problems := parse(
+		t, `
+file_format: 1.0.0
+versions:
+  1.3.0:
+    span_events:
+      changes:
+        - rename_events:
+            name_map:
+              e3: e1
+  1.2.0:
+    span_events:
+      changes:
+        - rename_events:
+            name_map:
+              e2: e3
+  1.1.0:
+    span_events:
+      changes:
+        - rename_events:
+            name_map:
+              e1: e2
+  1.0.0:
+`,
+	)
+	require.Len(t, problems, 1)
+	assert.Equal(
+		t,
+		"versions 1.1.0, 1.3.0, section span_events: event e3 is renamed to e1, which was renamed away in version 1.1.0",
+		problems[0].String(),
+	)
+	assert.Equal(t, []types.TelemetryVersion{"1.1.0", "1.3.0"}, problems[0].Versions)
+}
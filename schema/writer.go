@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+// Marshal returns the schema in the canonical form, see Write.
+func Marshal(schema *ast.Schema) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, schema); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes the schema to w in the canonical form: file_format and
+// schema_url header followed by the versions in reverse semver order, the
+// sections of each version in fixed order, map keys sorted and empty entries
+// omitted. The AST always represents LatestFileFormat so that is the
+// file_format written. Comments are not preserved.
+func Write(w io.Writer, schema *ast.Schema) error {
+	doc, err := schemaNode(schema)
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func schemaNode(schema *ast.Schema) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	addField := func(key string, value *yaml.Node) {
+		doc.Content = append(doc.Content, stringNode(key), value)
+	}
+
+	addField("file_format", stringNode(LatestFileFormat))
+	if schema.SchemaURL != "" {
+		addField("schema_url", stringNode(schema.SchemaURL))
+	}
+
+	versions := &yaml.Node{Kind: yaml.MappingNode}
+	for _, versionNum := range sortedVersionsDesc(schema.Versions) {
+		var def yaml.Node
+		if err := def.Encode(schema.Versions[versionNum]); err != nil {
+			return nil, err
+		}
+		versions.Content = append(versions.Content, stringNode(string(versionNum)), &def)
+	}
+	addField("versions", versions)
+
+	return doc, nil
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// sortedVersionsDesc returns the versions in reverse semver order. Versions
+// that are not valid semantic versions are placed last, sorted as strings.
+func sortedVersionsDesc(versions map[types.TelemetryVersion]ast.VersionDef) []types.TelemetryVersion {
+	type entry struct {
+		num     types.TelemetryVersion
+		version types.Version
+		valid   bool
+	}
+	entries := make([]entry, 0, len(versions))
+	for num := range versions {
+		version, err := num.Parse()
+		entries = append(entries, entry{num: num, version: version, valid: err == nil})
+	}
+	sort.Slice(
+		entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			if a.valid != b.valid {
+				return a.valid
+			}
+			if a.valid {
+				if c := a.version.Compare(b.version); c != 0 {
+					return c > 0
+				}
+			}
+			return a.num < b.num
+		},
+	)
+
+	result := make([]types.TelemetryVersion, len(entries))
+	for i, e := range entries {
+		result[i] = e.num
+	}
+	return result
+}
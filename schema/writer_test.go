@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tigrannajaryan/telemetry-schema/schema/ast"
+	"github.com/tigrannajaryan/telemetry-schema/schema/types"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	ts, err := Parse("testdata/schema-example.yaml")
+	require.NoError(t, err)
+
+	content, err := Marshal(ts)
+	require.NoError(t, err)
+
+	ts2, err := ParseBytesWithOptions("marshaled.yaml", content, ParseOptions{Strict: true})
+	require.NoError(t, err)
+	assert.Equal(t, ts, ts2)
+
+	// The canonical form does not change when written again.
+	content2, err := Marshal(ts2)
+	require.NoError(t, err)
+	assert.Equal(t, string(content), string(content2))
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	ts := &ast.Schema{
+		FileFormat: FileFormat100,
+		SchemaURL:  "https://example.com/schemas/1.10.0",
+		Versions: map[types.TelemetryVersion]ast.VersionDef{
+			"1.0.0": {},
+			"1.2.0": {
+				Logs: ast.VersionOfLogs{
+					Changes: []ast.LogTranslationAction{
+						{RenameLogs: map[types.LogName]types.LogName{"b": "c", "a": "d"}},
+					},
+				},
+				Resources: ast.VersionOfAttributes{
+					Changes: []ast.AttributeTranslationAction{
+						{RenameAttributes: &ast.MappingOfAttributes{"old": "new"}},
+					},
+				},
+			},
+			"1.10.0": {},
+		},
+	}
+
+	content, err := Marshal(ts)
+	require.NoError(t, err)
+	assert.Equal(
+		t, strings.Join(
+			[]string{
+				"file_format: 1.1.0",
+				"schema_url: https://example.com/schemas/1.10.0",
+				"versions:",
+				"  1.10.0: {}",
+				"  1.2.0:",
+				"    resources:",
+				"      changes:",
+				"        - rename_attributes:",
+				"            old: new",
+				"    logs:",
+				"      changes:",
+				"        - rename_logs:",
+				"            a: d",
+				"            b: c",
+				"  1.0.0: {}",
+				"",
+			}, "\n",
+		), string(content),
+	)
+}